@@ -0,0 +1,228 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPAnonymizationMode controls how client IPs are anonymized
+type IPAnonymizationMode int
+
+const (
+	// IPAnonymizeNone keeps IPs as is
+	IPAnonymizeNone IPAnonymizationMode = iota
+
+	// IPAnonymizeTruncate zeroes the host part of IPs: 203.0.113.7 -> 203.0.113.0
+	IPAnonymizeTruncate
+
+	// IPAnonymizeHash replaces IPs with keyed hash pseudonyms, which are stable within one salt rotation period
+	IPAnonymizeHash
+
+	// IPAnonymizeRemove removes IPs completely
+	IPAnonymizeRemove
+)
+
+// Default IP anonymization values
+const (
+	DefaultIPv4PrefixLen = 24
+	DefaultIPv6PrefixLen = 48
+	DefaultSaltRotation  = 24 * time.Hour
+)
+
+// IPAnonymization configures anonymization of client IPs for GDPR-compliant logs.
+// It is applied to ClientIP, to IPs inside proxy headers (X-Forwarded-For, X-Real-IP, Forwarded, etc.)
+// in RequestHeader and to Fields values, which are IPs (string or net.IP), so every formatter gets anonymized data.
+// ForwardedHost, Host and FullURL are the host the client requested, not the client's one, and are kept as is,
+// as well as IPs inside other headers, bodies and longer Fields values.
+type IPAnonymization struct {
+	// Mode is anonymization mode.
+	// Default: IPAnonymizeNone
+	Mode IPAnonymizationMode
+
+	// IPv4PrefixLen is the number of bits kept for IPv4 in IPAnonymizeTruncate mode.
+	// 0 means unset and is replaced with the default, use IPAnonymizeRemove to drop IPs completely.
+	// Default: 24
+	IPv4PrefixLen int
+
+	// IPv6PrefixLen is the number of bits kept for IPv6 in IPAnonymizeTruncate mode.
+	// 0 means unset and is replaced with the default, use IPAnonymizeRemove to drop IPs completely.
+	// Default: 48
+	IPv6PrefixLen int
+
+	// Key is a secret for IPAnonymizeHash mode. Instances with the same key produce the same pseudonyms.
+	// Optional. Default: random key generated on start
+	Key []byte
+
+	// SaltRotation is a period after which the hash salt is changed,
+	// so pseudonyms can't be linked between periods.
+	// Default: 24h
+	SaltRotation time.Duration
+
+	// Headers is a list of request headers which values are anonymized.
+	// Optional. Default: X-Forwarded-For, X-Real-IP, Forwarded and ProxyHandler headers
+	Headers []string
+}
+
+// ipAnonymizer applies IPAnonymization
+type ipAnonymizer struct {
+	conf    IPAnonymization
+	headers []string
+	now     func() time.Time
+
+	mu     sync.Mutex
+	period int64
+	salt   []byte
+}
+
+func newIPAnonymizer(conf IPAnonymization, proxy *Proxy) *ipAnonymizer {
+	// zero prefixes are unset, see IPAnonymization
+	if conf.IPv4PrefixLen == 0 {
+		conf.IPv4PrefixLen = DefaultIPv4PrefixLen
+	}
+	if conf.IPv6PrefixLen == 0 {
+		conf.IPv6PrefixLen = DefaultIPv6PrefixLen
+	}
+	if conf.SaltRotation == 0 {
+		conf.SaltRotation = DefaultSaltRotation
+	}
+	if conf.Mode == IPAnonymizeHash && len(conf.Key) == 0 {
+		conf.Key = make([]byte, 32)
+		_, _ = rand.Read(conf.Key)
+	}
+
+	headers := conf.Headers
+	if headers == nil {
+		headers = append([]string{"X-Forwarded-For", "X-Real-Ip", "Forwarded"}, proxy.RemoteIPHeaders...)
+		if proxy.ptype != "" {
+			headers = append(headers, proxy.ptype.String())
+		}
+	}
+
+	return &ipAnonymizer{
+		conf:    conf,
+		headers: headers,
+		now:     time.Now,
+		period:  -1,
+	}
+}
+
+// anonymize returns anonymized ip, values which are not IPs are returned as is
+func (a *ipAnonymizer) anonymize(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return s
+	}
+	switch a.conf.Mode {
+	case IPAnonymizeTruncate:
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(net.CIDRMask(a.conf.IPv4PrefixLen, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(a.conf.IPv6PrefixLen, 128)).String()
+	case IPAnonymizeHash:
+		mac := hmac.New(sha256.New, a.currentSalt())
+		mac.Write([]byte(ip.String()))
+		return hex.EncodeToString(mac.Sum(nil)[:8])
+	case IPAnonymizeRemove:
+		return ""
+	}
+	return s
+}
+
+// currentSalt derives salt for current rotation period from the key
+func (a *ipAnonymizer) currentSalt() []byte {
+	period := a.now().UnixNano() / int64(a.conf.SaltRotation)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if period != a.period {
+		mac := hmac.New(sha256.New, a.conf.Key)
+		mac.Write(binary.BigEndian.AppendUint64(nil, uint64(period)))
+		a.salt = mac.Sum(nil)
+		a.period = period
+	}
+	return a.salt
+}
+
+// anonymizeHeader replaces IPs in configured headers in place, removes these headers in IPAnonymizeRemove mode
+func (a *ipAnonymizer) anonymizeHeader(h http.Header) {
+	for _, name := range a.headers {
+		key := http.CanonicalHeaderKey(name)
+		values, ok := h[key]
+		if !ok {
+			continue
+		}
+		if a.conf.Mode == IPAnonymizeRemove {
+			delete(h, key)
+			continue
+		}
+		for i := range values {
+			values[i] = a.anonymizeText(values[i])
+		}
+	}
+}
+
+// anonymizeFields replaces IP values of fields in place
+func (a *ipAnonymizer) anonymizeFields(fields []Field) {
+	for i, f := range fields {
+		switch v := f.Value.(type) {
+		case string:
+			fields[i].Value = a.anonymize(v)
+		case net.IP:
+			if v != nil {
+				fields[i].Value = a.anonymize(v.String())
+			}
+		}
+	}
+}
+
+// anonymizeText replaces all IP looking tokens in s, handles lists, ip:port pairs and bracketed IPv6
+func (a *ipAnonymizer) anonymizeText(s string) string {
+	var b strings.Builder
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		b.WriteString(a.anonymizeToken(s[start:end]))
+		start = -1
+	}
+	for i := 0; i < len(s); i++ {
+		if isIPChar(s[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+		b.WriteByte(s[i])
+	}
+	flush(len(s))
+	return b.String()
+}
+
+func (a *ipAnonymizer) anonymizeToken(token string) string {
+	if net.ParseIP(token) != nil {
+		return a.anonymize(token)
+	}
+	// IPv4 with port
+	if host, port, found := strings.Cut(token, ":"); found && !strings.Contains(port, ":") && net.ParseIP(host) != nil {
+		return a.anonymize(host) + ":" + port
+	}
+	return token
+}
+
+func isIPChar(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') || c == '.' || c == ':'
+}
@@ -0,0 +1,105 @@
+package httplog
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPAnonymizerTruncate(t *testing.T) {
+	a := newIPAnonymizer(IPAnonymization{Mode: IPAnonymizeTruncate}, NewProxy())
+	assert.Equal(t, "203.0.113.0", a.anonymize("203.0.113.7"))
+	assert.Equal(t, "2001:db8:cafe::", a.anonymize("2001:db8:cafe:1::17"))
+	assert.Equal(t, "not an ip", a.anonymize("not an ip"))
+
+	a = newIPAnonymizer(IPAnonymization{Mode: IPAnonymizeTruncate, IPv4PrefixLen: 16, IPv6PrefixLen: 32}, NewProxy())
+	assert.Equal(t, "203.0.0.0", a.anonymize("203.0.113.7"))
+	assert.Equal(t, "2001:db8::", a.anonymize("2001:db8:cafe:1::17"))
+}
+
+func TestIPAnonymizerHash(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	a := newIPAnonymizer(IPAnonymization{Mode: IPAnonymizeHash, Key: []byte("secret")}, NewProxy())
+	a.now = func() time.Time { return now }
+
+	first := a.anonymize("203.0.113.7")
+	assert.Len(t, first, 16)
+	assert.NotContains(t, first, "203")
+	assert.Equal(t, first, a.anonymize("203.0.113.7"))
+	assert.NotEqual(t, first, a.anonymize("203.0.113.8"))
+
+	// another instance with the same key gives the same pseudonym
+	b := newIPAnonymizer(IPAnonymization{Mode: IPAnonymizeHash, Key: []byte("secret")}, NewProxy())
+	b.now = a.now
+	assert.Equal(t, first, b.anonymize("203.0.113.7"))
+
+	// salt is rotated
+	now = now.Add(DefaultSaltRotation)
+	assert.NotEqual(t, first, a.anonymize("203.0.113.7"))
+}
+
+func TestIPAnonymizerHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1:8080")
+	h.Set("X-Real-IP", "203.0.113.7")
+	h.Set("Forwarded", `for="[2001:db8:cafe:1::17]:4711";proto=https, for=_hidden`)
+	h.Set("CF-Connecting-IP", "198.51.100.1")
+	h.Set("User-Agent", "curl/8.0 198.51.100.1")
+
+	a := newIPAnonymizer(IPAnonymization{Mode: IPAnonymizeTruncate}, NewProxyWithType(ProxyCloudflare))
+	a.anonymizeHeader(h)
+	assert.Equal(t, "203.0.113.0, 10.0.0.0:8080", h.Get("X-Forwarded-For"))
+	assert.Equal(t, "203.0.113.0", h.Get("X-Real-IP"))
+	assert.Equal(t, `for="[2001:db8:cafe::]:4711";proto=https, for=_hidden`, h.Get("Forwarded"))
+	assert.Equal(t, "198.51.100.0", h.Get("CF-Connecting-IP"))
+	assert.Equal(t, "curl/8.0 198.51.100.1", h.Get("User-Agent"))
+
+	a = newIPAnonymizer(IPAnonymization{Mode: IPAnonymizeRemove}, NewProxy())
+	a.anonymizeHeader(h)
+	assert.Empty(t, h.Values("X-Forwarded-For"))
+	assert.Empty(t, h.Values("Forwarded"))
+	assert.NotEmpty(t, h.Values("User-Agent"))
+}
+
+func TestLoggerWithConfigIPAnonymization(t *testing.T) {
+	var gotParam LogFormatterParams
+	buffer := new(bytes.Buffer)
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output:          buffer,
+		IPAnonymization: IPAnonymization{Mode: IPAnonymizeTruncate},
+		Enrichers: []Enricher{func(p *LogFormatterParams) {
+			p.AddField("ip", p.ClientIP)
+			p.AddField("peer", net.ParseIP("198.51.100.1"))
+			p.AddField("region", "eu-west-1")
+		}},
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return ChainLogFormatter(DefaultLogFormatter, RequestHeaderLogFormatter)(param)
+		},
+	}, testHandler200("ok"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 198.51.100.1")
+	PerformRequestWithRequest(logger, req)
+
+	assert.Equal(t, "203.0.113.0", gotParam.ClientIP)
+	assert.Equal(t, "203.0.113.0, 198.51.100.0", gotParam.RequestHeader.Get("X-Forwarded-For"))
+	assert.Equal(t, []Field{{"ip", "203.0.113.0"}, {"peer", "198.51.100.0"}, {"region", "eu-west-1"}}, gotParam.Fields)
+	assert.NotContains(t, buffer.String(), "203.0.113.7")
+	assert.NotContains(t, buffer.String(), "198.51.100.1")
+	// original request is not modified
+	assert.Equal(t, "203.0.113.7, 198.51.100.1", req.Header.Get("X-Forwarded-For"))
+}
+
+func TestValidateConfig_RejectsInvalidIPAnonymization(t *testing.T) {
+	assert.Error(t, ValidateConfig(LoggerConfig{IPAnonymization: IPAnonymization{Mode: 42}}))
+	assert.Error(t, ValidateConfig(LoggerConfig{IPAnonymization: IPAnonymization{IPv4PrefixLen: 33}}))
+	assert.Error(t, ValidateConfig(LoggerConfig{IPAnonymization: IPAnonymization{IPv6PrefixLen: -1}}))
+	assert.Error(t, ValidateConfig(LoggerConfig{IPAnonymization: IPAnonymization{SaltRotation: -time.Second}}))
+	assert.NoError(t, ValidateConfig(LoggerConfig{IPAnonymization: IPAnonymization{Mode: IPAnonymizeHash}}))
+}
@@ -0,0 +1,109 @@
+package httplog
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Benchmarks of the middleware hot path, run with:
+//
+//	go test -run '^$' -bench . -benchmem
+//
+// Allocations reported are per request, including the handler and formatter ones.
+
+var benchHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+var emptyFormatter = func(param LogFormatterParams) string { return "" }
+
+func benchmarkMiddleware(b *testing.B, conf LoggerConfig, path string) {
+	b.Helper()
+	if conf.Output == nil {
+		conf.Output = io.Discard
+	}
+	logger, err := LoggerWithConfig(conf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer logger.Close()
+	handler := logger.Handler(benchHandler)
+
+	r := httptest.NewRequest("GET", path, nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("Authorization", "Bearer secret-token-value")
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkMiddlewareBaseline(b *testing.B) {
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchHandler.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkMiddlewareSkipped(b *testing.B) {
+	benchmarkMiddleware(b, LoggerConfig{SkipPaths: []string{"^/healthz$"}}, "/healthz")
+}
+
+func BenchmarkMiddlewareFilteredByLevel(b *testing.B) {
+	benchmarkMiddleware(b, LoggerConfig{MinLevel: LevelWarn}, "/users")
+}
+
+func BenchmarkMiddlewareEmptyFormatter(b *testing.B) {
+	benchmarkMiddleware(b, LoggerConfig{Formatter: emptyFormatter}, "/users")
+}
+
+func BenchmarkMiddlewareMaskedHeaders(b *testing.B) {
+	benchmarkMiddleware(b, LoggerConfig{
+		Formatter:      emptyFormatter,
+		HideHeaderKeys: []string{"Authorization"},
+	}, "/users")
+}
+
+func BenchmarkMiddlewareDefaultFormatter(b *testing.B) {
+	benchmarkMiddleware(b, LoggerConfig{ColorMode: ColorDisable}, "/users?page=2")
+}
+
+func BenchmarkMiddlewareDefaultEncoder(b *testing.B) {
+	benchmarkMiddleware(b, LoggerConfig{Encoder: DefaultEncoder, ColorMode: ColorDisable}, "/users?page=2")
+}
+
+func BenchmarkMiddlewareRequestHeaderFormatter(b *testing.B) {
+	benchmarkMiddleware(b, LoggerConfig{
+		Formatter:      RequestHeaderLogFormatter,
+		ColorMode:      ColorDisable,
+		HideHeaderKeys: []string{"Authorization"},
+	}, "/users")
+}
+
+func BenchmarkMiddlewareAsync(b *testing.B) {
+	benchmarkMiddleware(b, LoggerConfig{
+		Formatter:    emptyFormatter,
+		AsyncLogging: true,
+	}, "/users")
+}
+
+func BenchmarkMiddlewareParallel(b *testing.B) {
+	logger, _ := LoggerWithConfig(LoggerConfig{Output: io.Discard, ColorMode: ColorDisable})
+	handler := logger.Handler(benchHandler)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		r := httptest.NewRequest("GET", "/users", nil)
+		w := httptest.NewRecorder()
+		for pb.Next() {
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package httplog
 
-import "io"
+import (
+	"io"
+	"net/http"
+)
 
 // Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
 // Use of this source code is governed by a MIT style
@@ -32,6 +35,30 @@ func (b *ConfigBuilder) WithFormatter(f LogFormatter) *ConfigBuilder {
 	return b
 }
 
+// WithEncoder sets the log encoder, it takes precedence over formatter
+func (b *ConfigBuilder) WithEncoder(e Encoder) *ConfigBuilder {
+	b.config.Encoder = e
+	return b
+}
+
+// WithPattern sets Apache mod_log_config style layout, see LoggerConfig.Pattern
+func (b *ConfigBuilder) WithPattern(pattern string) *ConfigBuilder {
+	b.config.Pattern = pattern
+	return b
+}
+
+// WithTemplate sets text/template layout, see LoggerConfig.Template
+func (b *ConfigBuilder) WithTemplate(layout string) *ConfigBuilder {
+	b.config.Template = layout
+	return b
+}
+
+// WithSink adds a log destination, see LoggerConfig.Sinks
+func (b *ConfigBuilder) WithSink(s Sink) *ConfigBuilder {
+	b.config.Sinks = append(b.config.Sinks, s)
+	return b
+}
+
 // WithOutput sets the output writer
 func (b *ConfigBuilder) WithOutput(w io.Writer) *ConfigBuilder {
 	b.config.Output = w
@@ -44,6 +71,18 @@ func (b *ConfigBuilder) WithColorMode(mode ColorMode) *ConfigBuilder {
 	return b
 }
 
+// WithTheme sets the colors of formatters
+func (b *ConfigBuilder) WithTheme(theme *Theme) *ConfigBuilder {
+	b.config.Theme = theme
+	return b
+}
+
+// WithSanitizeMode sets escaping mode for user-controlled fields
+func (b *ConfigBuilder) WithSanitizeMode(mode SanitizeMode) *ConfigBuilder {
+	b.config.Sanitize = mode
+	return b
+}
+
 // WithRouterName sets the router name prefix
 func (b *ConfigBuilder) WithRouterName(name string) *ConfigBuilder {
 	b.config.RouterName = name
@@ -62,12 +101,76 @@ func (b *ConfigBuilder) WithHideHeaderKeys(keys ...string) *ConfigBuilder {
 	return b
 }
 
+// WithPIIScrubbing enables PII scrubbing, with DefaultPIIDetectors if no detectors passed
+func (b *ConfigBuilder) WithPIIScrubbing(detectors ...PIIDetector) *ConfigBuilder {
+	b.config.ScrubPII = true
+	b.config.PIIDetectors = append(b.config.PIIDetectors, detectors...)
+	return b
+}
+
 // WithProxyHandler sets the proxy handler
 func (b *ConfigBuilder) WithProxyHandler(proxy *Proxy) *ConfigBuilder {
 	b.config.ProxyHandler = proxy
 	return b
 }
 
+// WithTrustedProxies adds trusted proxy networks (CIDR or single IP)
+func (b *ConfigBuilder) WithTrustedProxies(proxies ...string) *ConfigBuilder {
+	b.config.TrustedProxies = append(b.config.TrustedProxies, proxies...)
+	return b
+}
+
+// WithSkipMethods adds HTTP methods to skip logging
+func (b *ConfigBuilder) WithSkipMethods(methods ...string) *ConfigBuilder {
+	b.config.SkipMethods = append(b.config.SkipMethods, methods...)
+	return b
+}
+
+// WithSkipHosts adds hosts to skip logging
+func (b *ConfigBuilder) WithSkipHosts(hosts ...string) *ConfigBuilder {
+	b.config.SkipHosts = append(b.config.SkipHosts, hosts...)
+	return b
+}
+
+// WithSkipHeader skips logging of requests with header value matching pattern
+func (b *ConfigBuilder) WithSkipHeader(name, pattern string) *ConfigBuilder {
+	if b.config.SkipHeaders == nil {
+		b.config.SkipHeaders = map[string]string{}
+	}
+	b.config.SkipHeaders[name] = pattern
+	return b
+}
+
+// WithSkipFunc sets request predicate to skip logging
+func (b *ConfigBuilder) WithSkipFunc(fn func(r *http.Request) bool) *ConfigBuilder {
+	b.config.SkipFunc = fn
+	return b
+}
+
+// WithDropFunc sets predicate to drop log entries after the response
+func (b *ConfigBuilder) WithDropFunc(fn func(param LogFormatterParams) bool) *ConfigBuilder {
+	b.config.DropFunc = fn
+	return b
+}
+
+// WithSkipUserAgents adds client classes which requests are not logged
+func (b *ConfigBuilder) WithSkipUserAgents(classes ...UserAgentClass) *ConfigBuilder {
+	b.config.SkipUserAgents = append(b.config.SkipUserAgents, classes...)
+	return b
+}
+
+// WithDebugUserAgents adds client classes which successful requests are logged with LevelDebug
+func (b *ConfigBuilder) WithDebugUserAgents(classes ...UserAgentClass) *ConfigBuilder {
+	b.config.DebugUserAgents = append(b.config.DebugUserAgents, classes...)
+	return b
+}
+
+// WithIPAnonymization sets client IP anonymization
+func (b *ConfigBuilder) WithIPAnonymization(anonymization IPAnonymization) *ConfigBuilder {
+	b.config.IPAnonymization = anonymization
+	return b
+}
+
 // WithCaptureResponseBody enables response body capture
 func (b *ConfigBuilder) WithCaptureResponseBody(capture bool) *ConfigBuilder {
 	b.config.CaptureResponseBody = capture
@@ -0,0 +1,142 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// Encoder appends a log entry to buf and returns the extended buffer.
+// It is the allocation free alternative to LogFormatter: middleware passes pooled buffers,
+// so no intermediate strings are created. Encoder must not keep buf or p after the call.
+type Encoder interface {
+	Encode(buf []byte, p *LogFormatterParams) []byte
+}
+
+// EncoderFunc is an adapter to use ordinary functions as Encoder
+type EncoderFunc func(buf []byte, p *LogFormatterParams) []byte
+
+// Encode calls f(buf, p)
+func (f EncoderFunc) Encode(buf []byte, p *LogFormatterParams) []byte {
+	return f(buf, p)
+}
+
+// FormatterEncoder adapts LogFormatter to Encoder
+func FormatterEncoder(f LogFormatter) Encoder {
+	return EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+		return append(buf, f(*p)...)
+	})
+}
+
+// EncoderFormatter adapts Encoder to LogFormatter, for example to use it in ChainLogFormatter
+func EncoderFormatter(e Encoder) LogFormatter {
+	return func(param LogFormatterParams) string {
+		return encodeToString(e, &param)
+	}
+}
+
+// ChainEncoder chain a list of encoders.
+// Like ChainLogFormatter, it supports When and Else formatters adapted with FormatterEncoder.
+func ChainEncoder(encoders ...Encoder) Encoder {
+	return EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+		outer, outerMatched := p.matched, p.chainMatched
+		p.matched, p.chainMatched = &p.chainMatched, false
+		for _, e := range encoders {
+			buf = e.Encode(buf, p)
+		}
+		matched := p.chainMatched
+		p.matched, p.chainMatched = outer, outerMatched
+
+		// nested chain matched, if any of its encoders did
+		if matched && outer != nil {
+			*outer = true
+		}
+		return buf
+	})
+}
+
+// Built-in encoders, LogFormatter versions of them use the same code
+var (
+	DefaultEncoder        Encoder = EncoderFunc(appendDefault)
+	ShortEncoder          Encoder = EncoderFunc(appendShort)
+	RequestHeaderEncoder  Encoder = EncoderFunc(appendRequestHeader)
+	ResponseHeaderEncoder Encoder = EncoderFunc(appendResponseHeader)
+	RequestBodyEncoder    Encoder = EncoderFunc(appendRequestBody)
+	ResponseBodyEncoder   Encoder = EncoderFunc(appendResponseBody)
+
+	DefaultEncoderWithRequestHeader                 = ChainEncoder(DefaultEncoder, RequestHeaderEncoder)
+	DefaultEncoderWithRequestHeadersAndBody         = ChainEncoder(DefaultEncoder, RequestHeaderEncoder, RequestBodyEncoder)
+	DefaultEncoderWithResponseHeader                = ChainEncoder(DefaultEncoder, ResponseHeaderEncoder)
+	DefaultEncoderWithResponseHeadersAndBody        = ChainEncoder(DefaultEncoder, ResponseHeaderEncoder, ResponseBodyEncoder)
+	FullEncoderWithRequestAndResponseHeadersAndBody = ChainEncoder(DefaultEncoder, RequestHeaderEncoder,
+		RequestBodyEncoder, ResponseHeaderEncoder, ResponseBodyEncoder)
+)
+
+// maxPooledBufferSize limits buffers returned to the pool, so a single huge entry doesn't stay in memory
+const maxPooledBufferSize = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+func acquireBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func releaseBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBufferSize {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+func encodeToString(e Encoder, p *LogFormatterParams) string {
+	buf := acquireBuffer()
+	*buf = e.Encode(*buf, p)
+	s := string(*buf)
+	releaseBuffer(buf)
+	return s
+}
+
+// appendPadLeft appends s right aligned to width runes, like fmt %10s
+func appendPadLeft(buf []byte, s string, width int) []byte {
+	for n := utf8.RuneCountInString(s); n < width; n++ {
+		buf = append(buf, ' ')
+	}
+	return append(buf, s...)
+}
+
+// appendPadRight appends s left aligned to width runes, like fmt %-10s
+func appendPadRight(buf []byte, s string, width int) []byte {
+	buf = append(buf, s...)
+	for n := utf8.RuneCountInString(s); n < width; n++ {
+		buf = append(buf, ' ')
+	}
+	return buf
+}
+
+// appendIntPad appends i right aligned to width, like fmt %3d
+func appendIntPad(buf []byte, i int, width int) []byte {
+	var tmp [20]byte
+	return appendPadLeft(buf, string(strconv.AppendInt(tmp[:0], int64(i), 10)), width)
+}
+
+// appendStrings appends values like fmt %s does for []string: [a b]
+func appendStrings(buf []byte, values []string) []byte {
+	buf = append(buf, '[')
+	for i, v := range values {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, v...)
+	}
+	return append(buf, ']')
+}
@@ -0,0 +1,117 @@
+package httplog
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodersMatchFormatters(t *testing.T) {
+	tests := []struct {
+		name      string
+		encoder   Encoder
+		formatter LogFormatter
+	}{
+		{"default", DefaultEncoder, DefaultLogFormatter},
+		{"short", ShortEncoder, ShortLogFormatter},
+		{"request header", RequestHeaderEncoder, RequestHeaderLogFormatter},
+		{"response header", ResponseHeaderEncoder, ResponseHeaderLogFormatter},
+		{"request body", RequestBodyEncoder, RequestBodyLogFormatter},
+		{"response body", ResponseBodyEncoder, ResponseBodyLogFormatter},
+		{"full", FullEncoderWithRequestAndResponseHeadersAndBody, FullFormatterWithRequestAndResponseHeadersAndBody},
+	}
+	param := LogFormatterParams{
+		RouterName:     "TEST",
+		TimeStamp:      time.Unix(1544173902, 0).UTC(),
+		StatusCode:     200,
+		Latency:        time.Millisecond * 9876543210,
+		ClientIP:       "20.20.20.20",
+		Method:         "GET",
+		Path:           "/ü\"path",
+		RequestHeader:  http.Header{"Accept": {"application/json", "text/plain"}},
+		ResponseHeader: http.Header{"Content-Type": {"application/json"}},
+		RequestBody:    []byte("plain text"),
+		ResponseBody:   []byte(`{"ok":true}`),
+		Error:          errors.New("write: broken pipe"),
+		Geo:            &GeoInfo{CountryCode: "NZ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mode := range []ColorMode{ColorForce, ColorDisable} {
+				p := param
+				p.colorMode = mode
+				assert.Equal(t, tt.formatter(p), string(tt.encoder.Encode(nil, &p)))
+			}
+		})
+	}
+}
+
+func TestEncoderAppendsToBuffer(t *testing.T) {
+	p := LogFormatterParams{
+		RouterName: "TEST",
+		StatusCode: 200,
+		Method:     "GET",
+		Path:       "/ü\"path",
+		colorMode:  ColorDisable,
+	}
+	buf := ShortEncoder.Encode([]byte("prefix "), &p)
+	assert.Equal(t, "prefix [TEST]  200 | \"/ü\\\"path\"\n", string(buf))
+}
+
+func TestEncoderAdapters(t *testing.T) {
+	p := LogFormatterParams{
+		RouterName: "TEST",
+		StatusCode: 200,
+		Method:     "GET",
+		Path:       "/users",
+		colorMode:  ColorDisable,
+	}
+
+	custom := func(param LogFormatterParams) string { return param.Method + "\n" }
+	assert.Equal(t, "GET\n", string(FormatterEncoder(custom).Encode(nil, &p)))
+	assert.Equal(t, ShortLogFormatter(p), EncoderFormatter(ShortEncoder)(p))
+
+	chained := ChainEncoder(ShortEncoder, FormatterEncoder(custom))
+	assert.Equal(t, ShortLogFormatter(p)+"GET\n", string(chained.Encode(nil, &p)))
+}
+
+func TestLoggerWithConfigEncoder(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger, err := LoggerWithConfig(LoggerConfig{
+		Output:    buffer,
+		Formatter: func(param LogFormatterParams) string { return "formatter\n" },
+		Encoder: EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+			return append(buf, p.Method+" "+p.Path+"\n"...)
+		}),
+	})
+	assert.NoError(t, err)
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/example", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/other", nil))
+	assert.Equal(t, "GET /example\nPOST /other\n", buffer.String())
+}
+
+func TestLoggerWithConfigEncoderSkipsEmptyOutput(t *testing.T) {
+	w := &countingWriter{}
+	logger, err := LoggerWithConfig(LoggerConfig{
+		Output:  w,
+		Encoder: EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte { return buf }),
+	})
+	assert.NoError(t, err)
+	logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 0, w.writes)
+}
+
+type countingWriter struct{ writes int }
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return len(b), nil
+}
@@ -1,7 +1,7 @@
 package httplog
 
 import (
-	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -11,23 +11,72 @@ import (
 
 // DefaultLogFormatter is the default log format function Logger middleware uses.
 func DefaultLogFormatter(param LogFormatterParams) string {
-	var statusColor, methodColor, resetColor string
+	return encodeToString(DefaultEncoder, &param)
+}
+
+func appendDefault(buf []byte, param *LogFormatterParams) []byte {
+	var statusColor, methodColor, latencyColor, resetColor string
 	if param.IsOutputColor() {
 		statusColor = param.StatusCodeColor()
 		methodColor = param.MethodColor()
+		latencyColor = param.LatencyColor()
 		resetColor = param.ResetColor()
 	}
 
-	if param.Latency > time.Minute {
-		param.Latency = param.Latency.Truncate(time.Second)
+	latency := param.Latency
+	if latency > time.Minute {
+		latency = latency.Truncate(time.Second)
+	}
+
+	// show where the client went, if proxy told us it differs from the request
+	path := param.Path
+	if param.FullURL != "" && param.forwardedOrigin {
+		path = param.FullURL
+	}
+
+	buf = append(buf, '[')
+	buf = append(buf, param.RouterName...)
+	buf = append(buf, "] "...)
+	buf = param.TimeStamp.AppendFormat(buf, "2006/01/02 - 15:04:05")
+	buf = append(buf, " |"...)
+	buf = append(buf, statusColor...)
+	buf = append(buf, ' ')
+	buf = appendIntPad(buf, param.StatusCode, 3)
+	buf = append(buf, ' ')
+	buf = append(buf, resetColor...)
+	buf = append(buf, "| "...)
+	buf = append(buf, latencyColor...)
+	buf = appendPadLeft(buf, latency.String(), 13)
+	if latencyColor != "" {
+		buf = append(buf, resetColor...)
+	}
+	buf = append(buf, " | "...)
+
+	// show where the client came from, if we know it
+	if param.Geo != nil && param.Geo.CountryCode != "" {
+		for n := len(param.ClientIP) + 1 + len(param.Geo.CountryCode); n < 15; n++ {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, param.ClientIP...)
+		buf = append(buf, ' ')
+		buf = append(buf, param.Geo.CountryCode...)
+	} else {
+		buf = appendPadLeft(buf, param.ClientIP, 15)
+	}
+
+	buf = append(buf, " |"...)
+	buf = append(buf, methodColor...)
+	buf = append(buf, ' ')
+	buf = appendPadRight(buf, param.Method, 7)
+	buf = append(buf, ' ')
+	buf = append(buf, resetColor...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendQuote(buf, path)
+
+	// show why the request failed, if it did
+	if param.Error != nil {
+		buf = append(buf, " | "...)
+		buf = append(buf, param.Error.Error()...)
 	}
-	return fmt.Sprintf("[%s] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n",
-		param.RouterName,
-		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
-		statusColor, param.StatusCode, resetColor,
-		param.Latency,
-		param.ClientIP,
-		methodColor, param.Method, resetColor,
-		param.Path,
-	)
+	return append(buf, '\n')
 }
@@ -1,14 +1,154 @@
 package httplog
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
 
-// ChainLogFormatter chain a list of log formatters
+// ChainLogFormatter chain a list of log formatters.
+// Else formatters of the chain write only if none of When formatters before them matched.
 func ChainLogFormatter(formatters ...LogFormatter) LogFormatter {
 	return func(params LogFormatterParams) string {
+		outer := params.matched
+		var matched bool
+		params.matched = &matched
+
 		var output strings.Builder
 		for _, f := range formatters {
 			output.WriteString(f(params))
 		}
+
+		// nested chain matched, if any of its formatters did
+		if matched && outer != nil {
+			*outer = true
+		}
+		return output.String()
+	}
+}
+
+// When returns formatter writing entries with f if match returns true, and nothing otherwise.
+// Combine conditional formatters and Else with ChainLogFormatter:
+//
+//	ChainLogFormatter(
+//		WhenStatus(Status5xx, FullFormatterWithRequestAndResponseHeadersAndBody),
+//		Else(ShortLogFormatter),
+//	)
+func When(match func(param LogFormatterParams) bool, f LogFormatter) LogFormatter {
+	return func(params LogFormatterParams) string {
+		if !match(params) {
+			return ""
+		}
+		if params.matched != nil {
+			*params.matched = true
+		}
+		return f(params)
+	}
+}
+
+// WhenLevel returns formatter writing entries of level and above with f
+func WhenLevel(level Level, f LogFormatter) LogFormatter {
+	return When(func(param LogFormatterParams) bool {
+		return param.Level >= level
+	}, f)
+}
+
+// WhenPath returns formatter writing entries with f if URL path without query matches re
+func WhenPath(re *regexp.Regexp, f LogFormatter) LogFormatter {
+	return When(func(param LogFormatterParams) bool {
+		path, _, _ := strings.Cut(param.Path, "?")
+		if param.Request != nil {
+			path = param.Request.URL.Path
+		}
+		return re.MatchString(path)
+	}, f)
+}
+
+// WhenStatus returns formatter writing entries with status code in r with f
+func WhenStatus(r StatusRange, f LogFormatter) LogFormatter {
+	return When(func(param LogFormatterParams) bool {
+		return r.Contains(param.StatusCode)
+	}, f)
+}
+
+// Else returns formatter writing entries with f if none of When formatters before it
+// in ChainLogFormatter matched. Outside of chain it always writes.
+func Else(f LogFormatter) LogFormatter {
+	return func(params LogFormatterParams) string {
+		if params.matched != nil && *params.matched {
+			return ""
+		}
+		return f(params)
+	}
+}
+
+// StatusRange is an inclusive range of HTTP status codes
+type StatusRange struct {
+	Min, Max int
+}
+
+// Status code classes
+var (
+	Status1xx = StatusRange{100, 199}
+	Status2xx = StatusRange{200, 299}
+	Status3xx = StatusRange{300, 399}
+	Status4xx = StatusRange{400, 499}
+	Status5xx = StatusRange{500, 599}
+)
+
+// Contains returns true if code is in the range
+func (r StatusRange) Contains(code int) bool {
+	return code >= r.Min && code <= r.Max
+}
+
+// MaxLength returns formatter cutting entries of f longer than n bytes, trailing newline is not counted.
+// Cut entries end with "…", UTF-8 characters and color escape sequences are never split.
+func MaxLength(n int, f LogFormatter) LogFormatter {
+	return func(params LogFormatterParams) string {
+		s := f(params)
+		body, newline := strings.CutSuffix(s, "\n")
+		if len(body) <= max(n, 0) {
+			return s
+		}
+
+		cut := max(n, 0)
+		for cut > 0 && !utf8.RuneStart(body[cut]) {
+			cut--
+		}
+		if esc := strings.LastIndexByte(body[:cut], '\033'); esc >= 0 && strings.IndexByte(body[esc:cut], 'm') < 0 {
+			cut = esc
+		}
+
+		var output strings.Builder
+		output.WriteString(body[:cut])
+		if strings.IndexByte(body[:cut], '\033') >= 0 {
+			output.WriteString(params.ResetColor())
+		}
+		output.WriteString("…")
+		if newline {
+			output.WriteByte('\n')
+		}
+		return output.String()
+	}
+}
+
+// Indent returns formatter indenting every non-empty line of f with two spaces,
+// e.g. to tell headers and bodies from request lines
+func Indent(f LogFormatter) LogFormatter {
+	return func(params LogFormatterParams) string {
+		s := f(params)
+		var output strings.Builder
+		for len(s) > 0 {
+			line, rest, found := strings.Cut(s, "\n")
+			if line != "" {
+				output.WriteString("  ")
+				output.WriteString(line)
+			}
+			if found {
+				output.WriteByte('\n')
+			}
+			s = rest
+		}
 		return output.String()
 	}
 }
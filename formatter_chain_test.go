@@ -1,6 +1,7 @@
 package httplog
 
 import (
+	"regexp"
 	"testing"
 	"time"
 
@@ -31,3 +32,69 @@ func TestChainLogFormatter(t *testing.T) {
 		result,
 	)
 }
+
+func TestConditionalFormatters(t *testing.T) {
+	formatter := ChainLogFormatter(
+		WhenStatus(Status5xx, func(LogFormatterParams) string { return "server error\n" }),
+		WhenLevel(LevelWarn, func(LogFormatterParams) string { return "warn and above\n" }),
+		WhenPath(regexp.MustCompile(`^/admin/`), func(LogFormatterParams) string { return "admin\n" }),
+		Else(func(LogFormatterParams) string { return "else\n" }),
+	)
+
+	assert.Equal(t, "else\n", formatter(LogFormatterParams{StatusCode: 200, Level: LevelInfo, Path: "/"}))
+	assert.Equal(t, "warn and above\n", formatter(LogFormatterParams{StatusCode: 404, Level: LevelWarn, Path: "/"}))
+	assert.Equal(t, "server error\nwarn and above\n", formatter(LogFormatterParams{StatusCode: 503, Level: LevelError, Path: "/"}))
+	assert.Equal(t, "admin\n", formatter(LogFormatterParams{StatusCode: 200, Level: LevelInfo, Path: "/admin/users?page=2"}))
+	assert.Equal(t, "else\n", formatter(LogFormatterParams{StatusCode: 200, Level: LevelInfo, Path: "/users?next=/admin/"}))
+
+	// Else outside of chain always writes
+	assert.Equal(t, "else\n", Else(func(LogFormatterParams) string { return "else\n" })(LogFormatterParams{}))
+}
+
+func TestConditionalFormattersNested(t *testing.T) {
+	short := func(LogFormatterParams) string { return "short\n" }
+	full := func(LogFormatterParams) string { return "full\n" }
+	formatter := ChainLogFormatter(
+		ChainLogFormatter(WhenStatus(Status5xx, full), WhenStatus(Status4xx, short)),
+		Else(func(LogFormatterParams) string { return "ok\n" }),
+	)
+	assert.Equal(t, "full\n", formatter(LogFormatterParams{StatusCode: 500}))
+	assert.Equal(t, "short\n", formatter(LogFormatterParams{StatusCode: 400}))
+	assert.Equal(t, "ok\n", formatter(LogFormatterParams{StatusCode: 200}))
+
+	// encoder chains support conditional formatters too
+	encoder := ChainEncoder(
+		FormatterEncoder(WhenStatus(Status5xx, full)),
+		ChainEncoder(FormatterEncoder(WhenStatus(Status4xx, short))),
+		FormatterEncoder(Else(func(LogFormatterParams) string { return "ok\n" })),
+	)
+	for status, want := range map[int]string{500: "full\n", 400: "short\n", 200: "ok\n"} {
+		p := &LogFormatterParams{StatusCode: status}
+		assert.Equal(t, want, string(encoder.Encode(nil, p)))
+		assert.Nil(t, p.matched)
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	text := func(s string) LogFormatter {
+		return func(LogFormatterParams) string { return s }
+	}
+	assert.Equal(t, "short\n", MaxLength(10, text("short\n"))(LogFormatterParams{}))
+	assert.Equal(t, "exactly10!\n", MaxLength(10, text("exactly10!\n"))(LogFormatterParams{}))
+	assert.Equal(t, "too long l…\n", MaxLength(10, text("too long line\n"))(LogFormatterParams{}))
+	assert.Equal(t, "no newl…", MaxLength(7, text("no newline"))(LogFormatterParams{}))
+
+	// UTF-8 characters are not split
+	assert.Equal(t, "привет …", MaxLength(14, text("привет мир"))(LogFormatterParams{}))
+
+	// color sequences are not split and reset
+	colored := LogFormatterParams{colorMode: ColorForce}
+	assert.Equal(t, "ab…\n", MaxLength(5, text("ab\x1b[97;42m 200 \x1b[0m\n"))(colored))
+	assert.Equal(t, "ab\x1b[97;42m 2\x1b[0m…\n", MaxLength(12, text("ab\x1b[97;42m 200 \x1b[0m\n"))(colored))
+}
+
+func TestIndent(t *testing.T) {
+	f := Indent(func(LogFormatterParams) string { return "first\n\nsecond\n" })
+	assert.Equal(t, "  first\n\n  second\n", f(LogFormatterParams{}))
+	assert.Equal(t, "  line", Indent(func(LogFormatterParams) string { return "line" })(LogFormatterParams{}))
+}
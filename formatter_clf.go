@@ -0,0 +1,142 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// clfTimeFormat is the time layout of NCSA Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// CommonLogFormatter writes NCSA Common Log Format, the default access log of Apache and nginx:
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+func CommonLogFormatter(param LogFormatterParams) string {
+	return encodeToString(CommonLogEncoder, &param)
+}
+
+// CombinedLogFormatter writes NCSA Combined Log Format, Common Log Format with Referer and User-Agent:
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://example.com/start.html" "Mozilla/5.0"
+func CombinedLogFormatter(param LogFormatterParams) string {
+	return encodeToString(CombinedLogEncoder, &param)
+}
+
+// Encoder versions of CommonLogFormatter and CombinedLogFormatter
+var (
+	CommonLogEncoder   Encoder = EncoderFunc(appendCommonLog)
+	CombinedLogEncoder Encoder = EncoderFunc(appendCombinedLog)
+)
+
+func appendCommonLog(buf []byte, param *LogFormatterParams) []byte {
+	return append(appendCLF(buf, param), '\n')
+}
+
+func appendCombinedLog(buf []byte, param *LogFormatterParams) []byte {
+	buf = appendCLF(buf, param)
+	buf = append(buf, ' ')
+	buf = appendCLFQuoted(buf, headerValue(param.RequestHeader, "Referer"))
+	buf = append(buf, ' ')
+	buf = appendCLFQuoted(buf, headerValue(param.RequestHeader, "User-Agent"))
+	return append(buf, '\n')
+}
+
+// appendCLF appends common part of the formats: host ident authuser [date] "request" status bytes
+func appendCLF(buf []byte, param *LogFormatterParams) []byte {
+	buf = appendCLFValue(buf, param.ClientIP)
+	buf = append(buf, " - "...)
+	buf = appendCLFValue(buf, basicAuthUser(param.RequestHeader))
+
+	// time the request was received, like Apache %t
+	buf = append(buf, " ["...)
+	buf = param.TimeStamp.Add(-param.Latency).AppendFormat(buf, clfTimeFormat)
+	buf = append(buf, "] "...)
+
+	buf = append(buf, '"')
+	buf = appendCLFEscaped(buf, param.Method)
+	buf = append(buf, ' ')
+	buf = appendCLFEscaped(buf, param.Path)
+	if param.Request != nil && param.Request.Proto != "" {
+		buf = append(buf, ' ')
+		buf = appendCLFEscaped(buf, param.Request.Proto)
+	}
+	buf = append(buf, "\" "...)
+
+	buf = strconv.AppendInt(buf, int64(param.StatusCode), 10)
+	buf = append(buf, ' ')
+	if param.BodySize == 0 {
+		return append(buf, '-')
+	}
+	return strconv.AppendInt(buf, int64(param.BodySize), 10)
+}
+
+// basicAuthUser returns user name of Basic authorization header, empty if the header is masked
+func basicAuthUser(h http.Header) string {
+	auth, ok := strings.CutPrefix(headerValue(h, "Authorization"), "Basic ")
+	if !ok {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return ""
+	}
+	user, _, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return ""
+	}
+	return user
+}
+
+// appendCLFValue appends unquoted value, "-" if it is empty
+func appendCLFValue(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	for i := 0; i < len(s); i++ {
+		// unquoted values are space separated
+		if s[i] == ' ' {
+			buf = append(buf, "\\x20"...)
+			continue
+		}
+		buf = appendCLFByte(buf, s[i])
+	}
+	return buf
+}
+
+// appendCLFQuoted appends quoted value, "-" if it is empty
+func appendCLFQuoted(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	if s == "" {
+		buf = append(buf, '-')
+	} else {
+		buf = appendCLFEscaped(buf, s)
+	}
+	return append(buf, '"')
+}
+
+// appendCLFEscaped escapes value like Apache does: quotes and backslashes with backslash,
+// control and non-ASCII bytes as \xhh
+func appendCLFEscaped(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		buf = appendCLFByte(buf, s[i])
+	}
+	return buf
+}
+
+func appendCLFByte(buf []byte, c byte) []byte {
+	const hexDigits = "0123456789abcdef"
+	switch {
+	case c == '"' || c == '\\':
+		return append(buf, '\\', c)
+	case c < 0x20 || c >= 0x7f:
+		return append(buf, '\\', 'x', hexDigits[c>>4], hexDigits[c&0xf])
+	default:
+		return append(buf, c)
+	}
+}
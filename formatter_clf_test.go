@@ -0,0 +1,59 @@
+package httplog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clfTestParams is the request of Apache docs examples, shared by access log, pattern and template tests
+func clfTestParams() LogFormatterParams {
+	r := httptest.NewRequest("GET", "/apache_pb.gif", nil)
+	r.Proto = "HTTP/1.0"
+	r.SetBasicAuth("frank", "secret")
+	r.Header.Set("Referer", "http://example.com/start.html")
+	r.Header.Set("User-Agent", "Mozilla/4.08 [en] (Win98; I ;Nav)")
+	return LogFormatterParams{
+		Request:       r,
+		TimeStamp:     time.Date(2000, 10, 10, 13, 55, 37, 0, time.FixedZone("", -7*3600)),
+		Latency:       time.Second,
+		ClientIP:      "127.0.0.1",
+		Method:        "GET",
+		Path:          "/apache_pb.gif",
+		StatusCode:    200,
+		BodySize:      2326,
+		RequestHeader: r.Header,
+	}
+}
+
+func TestCommonLogFormatter(t *testing.T) {
+	p := clfTestParams()
+	assert.Equal(t,
+		`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`+"\n",
+		CommonLogFormatter(p))
+
+	// masked credentials and empty values
+	p.RequestHeader = http.Header{"Authorization": {"****"}}
+	p.ClientIP = ""
+	p.BodySize = 0
+	p.StatusCode = 304
+	assert.Equal(t,
+		`- - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 304 -`+"\n",
+		CommonLogFormatter(p))
+}
+
+func TestCombinedLogFormatter(t *testing.T) {
+	p := clfTestParams()
+	assert.Equal(t,
+		`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`+"\n",
+		CombinedLogFormatter(p))
+
+	p.RequestHeader = http.Header{"User-Agent": {"evil\" agent\n\xc3\xbc\\"}}
+	p.Path = `/a"b`
+	assert.Equal(t,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a\"b HTTP/1.0" 200 2326 "-" "evil\" agent\x0a\xc3\xbc\\"`+"\n",
+		CombinedLogFormatter(p))
+}
@@ -0,0 +1,208 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+)
+
+// CurlOptions configures CurlLogFormatter
+type CurlOptions struct {
+	// HTTPie writes `http` command of HTTPie 3.0+ instead of curl
+	// Default: false
+	HTTPie bool
+
+	// Multiline splits the command into lines with backslash continuations
+	// Default: false (single line)
+	Multiline bool
+}
+
+// curlSkipHeaders are set by the client from the command itself
+var curlSkipHeaders = map[string]bool{
+	"Host":           true,
+	"Content-Length": true,
+	"Connection":     true,
+}
+
+// CurlLogFormatter returns formatter writing copy-pasteable curl command, which repeats the request:
+//
+//	curl -X POST 'https://example.com/users?page=2' -H 'Content-Type: application/json' --data-raw '{"name":"Jack"}'
+//
+// The command has the method, the original URL, request headers and RequestBody,
+// so enable CaptureRequestBody to replay requests with bodies.
+// Masked headers and scrubbed bodies stay masked, values are quoted for POSIX shells,
+// values with control characters use $'...' quoting of bash and zsh.
+// Use CurlSink to repeat requests byte for byte, LoggerConfig.Sanitize escapes values of other sinks.
+func CurlLogFormatter(opts CurlOptions) LogFormatter {
+	return EncoderFormatter(CurlEncoder(opts))
+}
+
+// CurlEncoder is the Encoder version of CurlLogFormatter
+func CurlEncoder(opts CurlOptions) Encoder {
+	sep := " "
+	if opts.Multiline {
+		sep = " \\\n  "
+	}
+	return EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+		if opts.HTTPie {
+			return append(appendHTTPie(buf, p, sep), '\n')
+		}
+		return append(appendCurl(buf, p, sep), '\n')
+	})
+}
+
+// CurlSink returns Raw sink writing CurlEncoder commands to out, use it in LoggerConfig.Sinks.
+// Values are not sanitized for it, as shell quoting escapes control characters and invalid UTF-8 itself.
+func CurlSink(opts CurlOptions, out io.Writer) Sink {
+	return Sink{
+		Name:      "curl",
+		Encoder:   CurlEncoder(opts),
+		Output:    out,
+		ColorMode: ColorDisable,
+		Raw:       true,
+	}
+}
+
+func appendCurl(buf []byte, p *LogFormatterParams, sep string) []byte {
+	buf = append(buf, "curl"...)
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	switch {
+	case method == http.MethodHead:
+		buf = append(buf, " --head"...)
+	case method != http.MethodGet || len(p.RequestBody) > 0:
+		// --data-raw switches curl to POST, so GET with body needs the method as well
+		buf = append(buf, " -X "...)
+		buf = appendShellQuoted(buf, method)
+	}
+	buf = append(buf, ' ')
+	buf = appendShellQuoted(buf, requestURL(p))
+
+	for _, key := range curlHeaderKeys(p.RequestHeader) {
+		for _, v := range p.RequestHeader[key] {
+			buf = append(buf, sep...)
+			buf = append(buf, "-H "...)
+			buf = appendShellQuoted(buf, key+": "+v)
+		}
+	}
+	// curl writes compressed response as is, unless it is asked to decode it
+	if p.RequestHeader.Get("Accept-Encoding") != "" {
+		buf = append(buf, sep...)
+		buf = append(buf, "--compressed"...)
+	}
+	if len(p.RequestBody) > 0 {
+		buf = append(buf, sep...)
+		buf = append(buf, "--data-raw "...)
+		buf = appendShellQuoted(buf, string(p.RequestBody))
+	}
+	return buf
+}
+
+func appendHTTPie(buf []byte, p *LogFormatterParams, sep string) []byte {
+	buf = append(buf, "http"...)
+	if len(p.RequestBody) > 0 {
+		buf = append(buf, " --raw "...)
+		buf = appendShellQuoted(buf, string(p.RequestBody))
+	}
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	buf = append(buf, ' ')
+	buf = appendShellQuoted(buf, method)
+	buf = append(buf, ' ')
+	buf = appendShellQuoted(buf, requestURL(p))
+
+	for _, key := range curlHeaderKeys(p.RequestHeader) {
+		for _, v := range p.RequestHeader[key] {
+			buf = append(buf, sep...)
+			// Header; sends the header with empty value
+			if v == "" {
+				buf = appendShellQuoted(buf, key+";")
+			} else {
+				buf = appendShellQuoted(buf, key+":"+v)
+			}
+		}
+	}
+	return buf
+}
+
+// curlHeaderKeys returns sorted header keys the command should send
+func curlHeaderKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		if !curlSkipHeaders[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendShellQuoted appends s as a single shell word: as is if it is safe,
+// in single quotes, or in $'...' if it has control characters or invalid UTF-8
+func appendShellQuoted(buf []byte, s string) []byte {
+	safe, printable := s != "", utf8.ValidString(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c < 0x20 || c == 0x7f:
+			printable = false
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == '/' || c == ':' || c == ',' || c == '@' || c == '%' || c == '+' || c == '=':
+		default:
+			safe = false
+		}
+	}
+	if !printable {
+		return appendANSICQuoted(buf, s)
+	}
+	if safe {
+		return append(buf, s...)
+	}
+
+	buf = append(buf, '\'')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' {
+			// close quote, escaped quote, open quote
+			buf = append(buf, `'\''`...)
+			continue
+		}
+		buf = append(buf, s[i])
+	}
+	return append(buf, '\'')
+}
+
+// appendANSICQuoted appends s in $'...' quotes with backslash escapes
+func appendANSICQuoted(buf []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	buf = append(buf, "$'"...)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			buf = append(buf, '\\', 'x', hexDigits[s[i]>>4], hexDigits[s[i]&0xf])
+		case r == '\n':
+			buf = append(buf, `\n`...)
+		case r == '\r':
+			buf = append(buf, `\r`...)
+		case r == '\t':
+			buf = append(buf, `\t`...)
+		case r == '\'' || r == '\\':
+			buf = append(buf, '\\', byte(r))
+		case r < 0x20 || r == 0x7f:
+			buf = append(buf, '\\', 'x', hexDigits[r>>4], hexDigits[r&0xf])
+		default:
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '\'')
+}
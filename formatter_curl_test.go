@@ -0,0 +1,129 @@
+package httplog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurlLogFormatter(t *testing.T) {
+	p := LogFormatterParams{
+		Method:  "POST",
+		Path:    "/users?page=2",
+		FullURL: "https://api.example.com/users?page=2",
+		RequestHeader: http.Header{
+			"Content-Type":   {"application/json"},
+			"Content-Length": {"24"},
+			"Host":           {"backend:8080"},
+			"X-Note":         {"it's fine"},
+		},
+		RequestBody: []byte(`{"name":"Jack O'Neill"}`),
+	}
+	tests := []struct {
+		opts CurlOptions
+		want string
+	}{
+		{
+			CurlOptions{},
+			`curl -X POST 'https://api.example.com/users?page=2' -H 'Content-Type: application/json' -H 'X-Note: it'\''s fine' --data-raw '{"name":"Jack O'\''Neill"}'` + "\n",
+		},
+		{
+			CurlOptions{Multiline: true},
+			"curl -X POST 'https://api.example.com/users?page=2' \\\n  -H 'Content-Type: application/json' \\\n  -H 'X-Note: it'\\''s fine' \\\n  --data-raw '{\"name\":\"Jack O'\\''Neill\"}'\n",
+		},
+		{
+			CurlOptions{HTTPie: true},
+			`http --raw '{"name":"Jack O'\''Neill"}' POST 'https://api.example.com/users?page=2' Content-Type:application/json 'X-Note:it'\''s fine'` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CurlLogFormatter(tt.opts)(p))
+	}
+
+	// GET doesn't need method, HEAD needs --head, so curl doesn't wait for body
+	assert.Equal(t, "curl 'http://example.com/search?q=a b&x=$(id)'\n",
+		CurlLogFormatter(CurlOptions{})(LogFormatterParams{Method: "GET", FullURL: "http://example.com/search?q=a b&x=$(id)"}))
+	assert.Equal(t, "curl --head http://example.com/\n",
+		CurlLogFormatter(CurlOptions{})(LogFormatterParams{Method: "HEAD", FullURL: "http://example.com/"}))
+	// --data-raw alone would send GET with body as POST
+	assert.Equal(t, "curl -X GET http://example.com/search --data-raw '{\"q\":\"a\"}'\n",
+		CurlLogFormatter(CurlOptions{})(LogFormatterParams{Method: "GET", FullURL: "http://example.com/search", RequestBody: []byte(`{"q":"a"}`)}))
+	// --compressed decodes response the replayed Accept-Encoding asks for
+	assert.Equal(t, "curl http://example.com/ -H 'Accept-Encoding: gzip, br' --compressed\n",
+		CurlLogFormatter(CurlOptions{})(LogFormatterParams{Method: "GET", FullURL: "http://example.com/", RequestHeader: http.Header{"Accept-Encoding": {"gzip, br"}}}))
+}
+
+func TestCurlLogFormatterHTTPie(t *testing.T) {
+	p := LogFormatterParams{Method: "DELETE", FullURL: "http://example.com/users/1", RequestHeader: http.Header{"X-Empty": {""}}}
+	assert.Equal(t, "http DELETE http://example.com/users/1 'X-Empty;'\n", CurlLogFormatter(CurlOptions{HTTPie: true})(p))
+}
+
+func TestShellQuoting(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain-value_1.2/3:4,5@6%7+8=9", "plain-value_1.2/3:4,5@6%7+8=9"},
+		{"", "''"},
+		{"two words", "'two words'"},
+		{"$HOME `id` \"x\" \\", `'$HOME ` + "`id`" + ` "x" \'`},
+		{"it's", `'it'\''s'`},
+		{"привет", "'привет'"},
+		{"line1\nline2\t'q'\\", `$'line1\nline2\t\'q\'\\'`},
+		{"bell\a\x7f", `$'bell\x07\x7f'`},
+		{"bin\xff\xfe", `$'bin\xff\xfe'`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, string(appendShellQuoted(nil, tt.in)), tt.in)
+	}
+}
+
+func TestCurlLogFormatterKeepsMasking(t *testing.T) {
+	out := new(bytes.Buffer)
+	logger, err := LoggerWithConfig(LoggerConfig{
+		Output:             out,
+		Formatter:          CurlLogFormatter(CurlOptions{}),
+		HideHeaderKeys:     []string{"Authorization"},
+		CaptureRequestBody: true,
+	})
+	assert.NoError(t, err)
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	r := httptest.NewRequest("PUT", "/items/1?force=true", strings.NewReader("name=box"))
+	r.Header.Set("Authorization", "Bearer secret-token")
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t,
+		"curl -X PUT 'http://example.com/items/1?force=true' -H 'Authorization: B**********n' -H 'Content-Type: application/x-www-form-urlencoded' --data-raw name=box\n",
+		out.String())
+	assert.NotContains(t, out.String(), "secret-token")
+}
+
+func TestCurlSinkGetsRawValues(t *testing.T) {
+	out, text := new(bytes.Buffer), new(bytes.Buffer)
+	logger, err := LoggerWithConfig(LoggerConfig{
+		CaptureRequestBody: true,
+		Sinks: []Sink{
+			{Output: text, Encoder: FormatterEncoder(RequestBodyLogFormatter), ColorMode: ColorDisable},
+			CurlSink(CurlOptions{}, out),
+		},
+	})
+	assert.NoError(t, err)
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("POST", "/upload", strings.NewReader("a\r\nb\xff"))
+	r.Header.Set("Content-Type", "application/octet-stream")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t,
+		`curl -X POST http://example.com/upload -H 'Content-Type: application/octet-stream' --data-raw $'a\r\nb\xff'`+"\n",
+		out.String())
+	// other sinks get sanitized body
+	assert.Contains(t, text.String(), `a\r`)
+}
@@ -0,0 +1,985 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONField is a value of LogFormatterParams written by JSONLogFormatter
+type JSONField int
+
+const (
+	// JSONTimestamp is the time the response was completed, formatted with JSONSchema.TimeFormat
+	JSONTimestamp JSONField = iota
+	// JSONLevel is the log level, formatted with JSONSchema.LevelFormat
+	JSONLevel
+	// JSONMessage is a short summary: method, path and status code
+	JSONMessage
+	// JSONRouter is the router name
+	JSONRouter
+	// JSONMethod is the request method
+	JSONMethod
+	// JSONURL is the full URL the client requested, or path when the host is unknown
+	JSONURL
+	// JSONPath is the request path with query
+	JSONPath
+	// JSONScheme is the original scheme the client requested
+	JSONScheme
+	// JSONHost is the original host the client requested
+	JSONHost
+	// JSONStatus is the response status code
+	JSONStatus
+	// JSONLatency is the request duration, formatted with JSONSchema.DurationUnit
+	JSONLatency
+	// JSONTTFB is time to first byte, formatted with JSONSchema.DurationUnit
+	JSONTTFB
+	// JSONClientIP is the real client IP
+	JSONClientIP
+	// JSONUserAgent is the User-Agent request header
+	JSONUserAgent
+	// JSONReferer is the Referer request header
+	JSONReferer
+	// JSONProtocol is the request protocol, e.g. HTTP/1.1
+	JSONProtocol
+	// JSONProtocolVersion is the request protocol version, e.g. 1.1
+	JSONProtocolVersion
+	// JSONRequestSize is the request Content-Length, or the size of the captured request body
+	JSONRequestSize
+	// JSONResponseSize is the size of the response body
+	JSONResponseSize
+	// JSONRequestHeaders is the request headers object (masked if configured)
+	JSONRequestHeaders
+	// JSONResponseHeaders is the response headers object (masked if configured)
+	JSONResponseHeaders
+	// JSONRequestBody is the captured request body
+	JSONRequestBody
+	// JSONResponseBody is the captured response body
+	JSONResponseBody
+	// JSONTraceID is the trace ID from W3C traceparent request header
+	JSONTraceID
+	// JSONSpanID is the parent span ID from W3C traceparent request header
+	JSONSpanID
+	// JSONRequestID is the request ID from JSONSchema.RequestIDHeader
+	JSONRequestID
+	// JSONError is why the request didn't complete normally
+	JSONError
+	// JSONClientCanceled is true when the client went away before the response was complete
+	JSONClientCanceled
+	// JSONBytesExpected is the response Content-Length of the failed request
+	JSONBytesExpected
+	// JSONBytesWritten is the number of response body bytes written to the client of the failed request
+	JSONBytesWritten
+	// JSONFlushes is the number of response flushes
+	JSONFlushes
+	// JSONInformational is 1xx status codes sent before the final response
+	JSONInformational
+	// JSONCountryCode is ISO 3166-1 country code of the client (if GeoIP enricher is configured)
+	JSONCountryCode
+	// JSONCountry is the country name of the client
+	JSONCountry
+	// JSONCity is the city name of the client
+	JSONCity
+	// JSONASN is the autonomous system number of the client network
+	JSONASN
+	// JSONASOrg is the autonomous system organization of the client network
+	JSONASOrg
+	// JSONUAName is the browser, bot or tool name parsed from User-Agent (if UserAgentEnricher is configured)
+	JSONUAName
+	// JSONUAVersion is the browser, bot or tool version
+	JSONUAVersion
+	// JSONUAOS is the client operating system name
+	JSONUAOS
+	// JSONUAOSVersion is the client operating system version
+	JSONUAOSVersion
+	// JSONUADevice is the client device type
+	JSONUADevice
+	// JSONUAClass is the kind of client, e.g. browser or crawler
+	JSONUAClass
+	// JSONRedactions is the object of PII values masked per detector name
+	JSONRedactions
+	// JSONFields is the object of extra fields added by enrichers with AddField
+	JSONFields
+
+	jsonFieldCount
+)
+
+// JSONDurationUnit controls how latency is written
+type JSONDurationUnit int
+
+const (
+	// JSONDurationNanos writes integer nanoseconds
+	JSONDurationNanos JSONDurationUnit = iota
+	// JSONDurationMillis writes float milliseconds
+	JSONDurationMillis
+	// JSONDurationSeconds writes float seconds
+	JSONDurationSeconds
+	// JSONDurationString writes seconds with "s" suffix, e.g. "0.015s", like protobuf Duration
+	JSONDurationString
+)
+
+// JSONSchema defines field names and value formats of JSONLogFormatter.
+// Use one of presets: JSONSchemaDefault, JSONSchemaECS, JSONSchemaOTel, JSONSchemaGCP, JSONSchemaDatadog,
+// and modify it if needed.
+type JSONSchema struct {
+	// Names maps fields to JSON names, fields without a name are not written.
+	// Empty values are omitted.
+	Names map[JSONField]string
+
+	// Nested splits names by dots into nested objects, e.g. "http.request.method".
+	// Escape literal dots with backslash: "logging\\.googleapis\\.com/trace".
+	// Names conflicting with other nested names are ignored.
+	// Default: false (dots are part of names)
+	Nested bool
+
+	// TimeFormat is a layout of JSONTimestamp
+	// Default: time.RFC3339Nano
+	TimeFormat string
+
+	// DurationUnit is a format of JSONLatency, JSONTTFB and duration values of JSONFields
+	// Default: JSONDurationNanos
+	DurationUnit JSONDurationUnit
+
+	// LevelFormat returns the name of the level
+	// Optional. Default: lower case Level.String()
+	LevelFormat func(Level) string
+
+	// EmbedJSONBody writes valid JSON bodies as embedded JSON, not as strings.
+	// Default: false
+	EmbedJSONBody bool
+
+	// FlattenHeaders writes every header as a separate field, named by header name prefix,
+	// a dot and lower case header key, like OpenTelemetry http.request.header.<key>.
+	// Default: false (headers are written as an object)
+	FlattenHeaders bool
+
+	// RequestIDHeader is a request header with the request ID
+	// Default: X-Request-Id
+	RequestIDHeader string
+
+	// TracePrefix is prepended to JSONTraceID, e.g. "projects/my-project/traces/" for Google Cloud.
+	// Optional.
+	TracePrefix string
+
+	// DecimalTraceIDs writes trace and span IDs as decimal lower 64 bits, like Datadog does.
+	// Default: false (lower case hex)
+	DecimalTraceIDs bool
+}
+
+// JSONSchemaDefault is a flat schema with short snake case names, bodies are embedded when valid JSON
+func JSONSchemaDefault() JSONSchema {
+	return JSONSchema{
+		Names: map[JSONField]string{
+			JSONTimestamp:       "time",
+			JSONLevel:           "level",
+			JSONMessage:         "msg",
+			JSONRouter:          "router",
+			JSONMethod:          "method",
+			JSONURL:             "url",
+			JSONPath:            "path",
+			JSONStatus:          "status",
+			JSONLatency:         "latency",
+			JSONTTFB:            "ttfb",
+			JSONClientIP:        "client_ip",
+			JSONUserAgent:       "user_agent",
+			JSONReferer:         "referer",
+			JSONProtocol:        "proto",
+			JSONRequestSize:     "request_size",
+			JSONResponseSize:    "body_size",
+			JSONRequestHeaders:  "request_headers",
+			JSONResponseHeaders: "response_headers",
+			JSONRequestBody:     "request_body",
+			JSONResponseBody:    "response_body",
+			JSONTraceID:         "trace_id",
+			JSONSpanID:          "span_id",
+			JSONRequestID:       "request_id",
+			JSONError:           "error",
+			JSONClientCanceled:  "client_canceled",
+			JSONBytesExpected:   "bytes_expected",
+			JSONBytesWritten:    "bytes_written",
+			JSONFlushes:         "flushes",
+			JSONInformational:   "informational",
+			JSONCountryCode:     "country_code",
+			JSONCountry:         "country",
+			JSONCity:            "city",
+			JSONASN:             "asn",
+			JSONASOrg:           "as_org",
+			JSONUAName:          "ua_name",
+			JSONUAVersion:       "ua_version",
+			JSONUAOS:            "os",
+			JSONUAOSVersion:     "os_version",
+			JSONUADevice:        "device",
+			JSONUAClass:         "client_class",
+			JSONRedactions:      "redactions",
+			JSONFields:          "fields",
+		},
+		EmbedJSONBody: true,
+	}
+}
+
+// JSONSchemaECS is Elastic Common Schema
+func JSONSchemaECS() JSONSchema {
+	return JSONSchema{
+		Names: map[JSONField]string{
+			JSONTimestamp:       "@timestamp",
+			JSONLevel:           "log.level",
+			JSONMessage:         "message",
+			JSONRouter:          "labels.router",
+			JSONMethod:          "http.request.method",
+			JSONURL:             "url.full",
+			JSONPath:            "url.original",
+			JSONScheme:          "url.scheme",
+			JSONHost:            "url.domain",
+			JSONStatus:          "http.response.status_code",
+			JSONLatency:         "event.duration",
+			JSONClientIP:        "client.ip",
+			JSONUserAgent:       "user_agent.original",
+			JSONReferer:         "http.request.referrer",
+			JSONProtocolVersion: "http.version",
+			JSONRequestSize:     "http.request.body.bytes",
+			JSONResponseSize:    "http.response.body.bytes",
+			JSONRequestHeaders:  "http.request.headers",
+			JSONResponseHeaders: "http.response.headers",
+			JSONRequestBody:     "http.request.body.content",
+			JSONResponseBody:    "http.response.body.content",
+			JSONTraceID:         "trace.id",
+			JSONSpanID:          "span.id",
+			JSONRequestID:       "http.request.id",
+			JSONError:           "error.message",
+			JSONTTFB:            "httplog.response.ttfb",
+			JSONClientCanceled:  "httplog.client_canceled",
+			JSONBytesExpected:   "httplog.response.bytes_expected",
+			JSONBytesWritten:    "httplog.response.bytes_written",
+			JSONFlushes:         "httplog.response.flushes",
+			JSONInformational:   "httplog.response.informational",
+			JSONCountryCode:     "client.geo.country_iso_code",
+			JSONCountry:         "client.geo.country_name",
+			JSONCity:            "client.geo.city_name",
+			JSONASN:             "client.as.number",
+			JSONASOrg:           "client.as.organization.name",
+			JSONUAName:          "user_agent.name",
+			JSONUAVersion:       "user_agent.version",
+			JSONUAOS:            "user_agent.os.name",
+			JSONUAOSVersion:     "user_agent.os.version",
+			JSONUADevice:        "user_agent.device.name",
+			JSONUAClass:         "httplog.user_agent.class",
+			JSONRedactions:      "httplog.redactions",
+			JSONFields:          "httplog.fields",
+		},
+		Nested: true,
+	}
+}
+
+// JSONSchemaOTel is OpenTelemetry HTTP semantic conventions, attributes are flat.
+// Headers are written as http.request.header.<key> arrays.
+// Semantic conventions define request duration as a metric only, so latency is the namespaced
+// httplog.request.duration attribute in seconds.
+func JSONSchemaOTel() JSONSchema {
+	return JSONSchema{
+		Names: map[JSONField]string{
+			JSONTimestamp:       "timestamp",
+			JSONLevel:           "severity_text",
+			JSONMessage:         "body",
+			JSONMethod:          "http.request.method",
+			JSONURL:             "url.full",
+			JSONScheme:          "url.scheme",
+			JSONHost:            "server.address",
+			JSONStatus:          "http.response.status_code",
+			JSONLatency:         "httplog.request.duration",
+			JSONClientIP:        "client.address",
+			JSONUserAgent:       "user_agent.original",
+			JSONProtocolVersion: "network.protocol.version",
+			JSONRequestSize:     "http.request.body.size",
+			JSONResponseSize:    "http.response.body.size",
+			JSONRequestHeaders:  "http.request.header",
+			JSONResponseHeaders: "http.response.header",
+			JSONTraceID:         "trace_id",
+			JSONSpanID:          "span_id",
+			JSONError:           "exception.message",
+			JSONTTFB:            "httplog.response.ttfb",
+			JSONClientCanceled:  "httplog.client_canceled",
+			JSONBytesExpected:   "httplog.response.bytes_expected",
+			JSONBytesWritten:    "httplog.response.bytes_written",
+			JSONFlushes:         "httplog.response.flushes",
+			JSONInformational:   "httplog.response.informational",
+			JSONCountryCode:     "geo.country.iso_code",
+			JSONCountry:         "httplog.geo.country_name",
+			JSONCity:            "geo.locality.name",
+			JSONASN:             "httplog.as.number",
+			JSONASOrg:           "httplog.as.organization.name",
+			JSONUAName:          "user_agent.name",
+			JSONUAVersion:       "user_agent.version",
+			JSONUAOS:            "user_agent.os.name",
+			JSONUAOSVersion:     "user_agent.os.version",
+			JSONUADevice:        "httplog.user_agent.device",
+			JSONUAClass:         "httplog.user_agent.class",
+			JSONRedactions:      "httplog.redactions",
+			JSONFields:          "httplog.fields",
+		},
+		DurationUnit:   JSONDurationSeconds,
+		LevelFormat:    Level.String,
+		FlattenHeaders: true,
+	}
+}
+
+// JSONSchemaGCP is Google Cloud Logging structured log with httpRequest object.
+// projectID is used to link log entries with Cloud Trace, could be empty.
+func JSONSchemaGCP(projectID string) JSONSchema {
+	schema := JSONSchema{
+		Names: map[JSONField]string{
+			JSONTimestamp:       "timestamp",
+			JSONLevel:           "severity",
+			JSONMessage:         "message",
+			JSONRouter:          `logging\.googleapis\.com/labels.router`,
+			JSONMethod:          "httpRequest.requestMethod",
+			JSONURL:             "httpRequest.requestUrl",
+			JSONStatus:          "httpRequest.status",
+			JSONLatency:         "httpRequest.latency",
+			JSONClientIP:        "httpRequest.remoteIp",
+			JSONUserAgent:       "httpRequest.userAgent",
+			JSONReferer:         "httpRequest.referer",
+			JSONProtocol:        "httpRequest.protocol",
+			JSONRequestSize:     "httpRequest.requestSize",
+			JSONResponseSize:    "httpRequest.responseSize",
+			JSONRequestHeaders:  "requestHeaders",
+			JSONResponseHeaders: "responseHeaders",
+			JSONRequestBody:     "requestBody",
+			JSONResponseBody:    "responseBody",
+			JSONTraceID:         `logging\.googleapis\.com/trace`,
+			JSONSpanID:          `logging\.googleapis\.com/spanId`,
+			JSONRequestID:       `logging\.googleapis\.com/labels.request_id`,
+			JSONError:           "error",
+			JSONTTFB:            "ttfb",
+			JSONClientCanceled:  "clientCanceled",
+			JSONBytesExpected:   "bytesExpected",
+			JSONBytesWritten:    "bytesWritten",
+			JSONFlushes:         "flushes",
+			JSONInformational:   "informational",
+			JSONCountryCode:     "geo.countryCode",
+			JSONCountry:         "geo.country",
+			JSONCity:            "geo.city",
+			JSONASN:             "geo.asn",
+			JSONASOrg:           "geo.asOrg",
+			JSONUAName:          "userAgent.name",
+			JSONUAVersion:       "userAgent.version",
+			JSONUAOS:            "userAgent.os",
+			JSONUAOSVersion:     "userAgent.osVersion",
+			JSONUADevice:        "userAgent.device",
+			JSONUAClass:         "userAgent.class",
+			JSONRedactions:      "redactions",
+			JSONFields:          "fields",
+		},
+		Nested:       true,
+		DurationUnit: JSONDurationString,
+		LevelFormat: func(l Level) string {
+			if l == LevelWarn {
+				return "WARNING"
+			}
+			return l.String()
+		},
+	}
+	if projectID != "" {
+		schema.TracePrefix = "projects/" + projectID + "/traces/"
+	}
+	return schema
+}
+
+// JSONSchemaDatadog is Datadog standard attributes, trace IDs are decimal for log and trace correlation
+func JSONSchemaDatadog() JSONSchema {
+	return JSONSchema{
+		Names: map[JSONField]string{
+			JSONTimestamp:       "timestamp",
+			JSONLevel:           "status",
+			JSONMessage:         "message",
+			JSONMethod:          "http.method",
+			JSONURL:             "http.url",
+			JSONPath:            "http.url_details.path",
+			JSONScheme:          "http.url_details.scheme",
+			JSONHost:            "http.url_details.host",
+			JSONStatus:          "http.status_code",
+			JSONLatency:         "duration",
+			JSONClientIP:        "network.client.ip",
+			JSONUserAgent:       "http.useragent",
+			JSONReferer:         "http.referer",
+			JSONProtocolVersion: "http.version",
+			JSONRequestSize:     "network.bytes_read",
+			JSONResponseSize:    "network.bytes_written",
+			JSONRequestHeaders:  "http.request.headers",
+			JSONResponseHeaders: "http.response.headers",
+			JSONRequestBody:     "http.request.body",
+			JSONResponseBody:    "http.response.body",
+			JSONTraceID:         "dd.trace_id",
+			JSONSpanID:          "dd.span_id",
+			JSONRequestID:       "http.request_id",
+			JSONError:           "error.message",
+			JSONTTFB:            "http.ttfb",
+			JSONClientCanceled:  "http.client_canceled",
+			JSONBytesExpected:   "http.response.bytes_expected",
+			JSONBytesWritten:    "http.response.bytes_written",
+			JSONFlushes:         "http.response.flushes",
+			JSONInformational:   "http.response.informational",
+			JSONCountryCode:     "network.client.geoip.country.iso_code",
+			JSONCountry:         "network.client.geoip.country.name",
+			JSONCity:            "network.client.geoip.city.name",
+			JSONASN:             "network.client.geoip.as.number",
+			JSONASOrg:           "network.client.geoip.as.name",
+			JSONUAName:          "http.useragent_details.browser.family",
+			JSONUAVersion:       "http.useragent_details.browser.version",
+			JSONUAOS:            "http.useragent_details.os.family",
+			JSONUAOSVersion:     "http.useragent_details.os.version",
+			JSONUADevice:        "http.useragent_details.device.category",
+			JSONUAClass:         "http.useragent_details.class",
+			JSONRedactions:      "redactions",
+			JSONFields:          "fields",
+		},
+		Nested:          true,
+		EmbedJSONBody:   true,
+		DecimalTraceIDs: true,
+	}
+}
+
+// JSONLogFormatter returns formatter writing one JSON object per line (JSON Lines)
+func JSONLogFormatter(schema JSONSchema) LogFormatter {
+	return EncoderFormatter(JSONEncoder(schema))
+}
+
+// JSONEncoder is the Encoder version of JSONLogFormatter
+func JSONEncoder(schema JSONSchema) Encoder {
+	e := &jsonEncoder{schema: schema}
+	if e.schema.TimeFormat == "" {
+		e.schema.TimeFormat = time.RFC3339Nano
+	}
+	if e.schema.LevelFormat == nil {
+		e.schema.LevelFormat = func(l Level) string { return strings.ToLower(l.String()) }
+	}
+	if e.schema.RequestIDHeader == "" {
+		e.schema.RequestIDHeader = "X-Request-Id"
+	}
+	e.schema.RequestIDHeader = http.CanonicalHeaderKey(e.schema.RequestIDHeader)
+
+	for f := JSONField(0); f < jsonFieldCount; f++ {
+		name := schema.Names[f]
+		if name == "" {
+			continue
+		}
+		path := []string{name}
+		if schema.Nested {
+			path = splitJSONName(name)
+		}
+		e.root = insertJSONNode(e.root, path, f)
+	}
+	return e
+}
+
+type jsonEncoder struct {
+	schema JSONSchema
+	root   []*jsonNode
+}
+
+// jsonNode is a field, or an object when children are set
+type jsonNode struct {
+	name     string
+	key      []byte // encoded `"name":`
+	field    JSONField
+	children []*jsonNode
+}
+
+// splitJSONName splits name by dots, which are not escaped with backslash
+func splitJSONName(name string) []string {
+	var path []string
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '\\' && i+1 < len(name) && name[i+1] == '.':
+			b.WriteByte('.')
+			i++
+		case name[i] == '.':
+			path = append(path, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(name[i])
+		}
+	}
+	return append(path, b.String())
+}
+
+// insertJSONNode adds field to nodes by path, conflicting fields are ignored
+func insertJSONNode(nodes []*jsonNode, path []string, f JSONField) []*jsonNode {
+	for _, n := range nodes {
+		if n.name != path[0] {
+			continue
+		}
+		// a field and an object can't share a name
+		if len(path) > 1 && n.children != nil {
+			n.children = insertJSONNode(n.children, path[1:], f)
+		}
+		return nodes
+	}
+	n := &jsonNode{name: path[0], field: f}
+	n.key = appendJSONString(nil, n.name)
+	n.key = append(n.key, ':')
+	if len(path) > 1 {
+		n.children = insertJSONNode(nil, path[1:], f)
+	}
+	return append(nodes, n)
+}
+
+func (e *jsonEncoder) Encode(buf []byte, p *LogFormatterParams) []byte {
+	buf = append(buf, '{')
+	buf, _ = e.appendObject(buf, e.root, p)
+	return append(buf, "}\n"...)
+}
+
+// appendObject appends fields of nodes, it returns false if all of them are empty
+func (e *jsonEncoder) appendObject(buf []byte, nodes []*jsonNode, p *LogFormatterParams) ([]byte, bool) {
+	written := false
+	for _, n := range nodes {
+		mark := len(buf)
+		if written {
+			buf = append(buf, ',')
+		}
+		var ok bool
+		if n.children != nil {
+			buf = append(buf, n.key...)
+			buf = append(buf, '{')
+			buf, ok = e.appendObject(buf, n.children, p)
+			buf = append(buf, '}')
+		} else {
+			buf, ok = e.appendField(buf, n, p)
+		}
+		if !ok {
+			buf = buf[:mark]
+			continue
+		}
+		written = true
+	}
+	return buf, written
+}
+
+// appendField appends key and value of the field, it returns false if the value is empty
+func (e *jsonEncoder) appendField(buf []byte, n *jsonNode, p *LogFormatterParams) ([]byte, bool) {
+	s := &e.schema
+	switch n.field {
+	case JSONTimestamp:
+		if p.TimeStamp.IsZero() {
+			return buf, false
+		}
+		buf = append(append(buf, n.key...), '"')
+		buf = p.TimeStamp.AppendFormat(buf, s.TimeFormat)
+		return append(buf, '"'), true
+	case JSONLevel:
+		return appendJSONStringField(buf, n.key, s.LevelFormat(p.Level))
+	case JSONMessage:
+		buf = append(append(buf, n.key...), '"')
+		buf = appendJSONStringContent(buf, p.Method)
+		buf = append(buf, ' ')
+		buf = appendJSONStringContent(buf, p.Path)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, int64(p.StatusCode), 10)
+		return append(buf, '"'), true
+	case JSONRouter:
+		return appendJSONStringField(buf, n.key, p.RouterName)
+	case JSONMethod:
+		return appendJSONStringField(buf, n.key, p.Method)
+	case JSONURL:
+		if p.FullURL != "" {
+			return appendJSONStringField(buf, n.key, p.FullURL)
+		}
+		return appendJSONStringField(buf, n.key, p.Path)
+	case JSONPath:
+		return appendJSONStringField(buf, n.key, p.Path)
+	case JSONScheme:
+		return appendJSONStringField(buf, n.key, p.Scheme)
+	case JSONHost:
+		return appendJSONStringField(buf, n.key, p.Host)
+	case JSONStatus:
+		return strconv.AppendInt(append(buf, n.key...), int64(p.StatusCode), 10), true
+	case JSONLatency:
+		return e.appendDuration(append(buf, n.key...), p.Latency), true
+	case JSONTTFB:
+		if p.TTFB == 0 {
+			return buf, false
+		}
+		return e.appendDuration(append(buf, n.key...), p.TTFB), true
+	case JSONClientIP:
+		return appendJSONStringField(buf, n.key, p.ClientIP)
+	case JSONUserAgent:
+		return appendJSONStringField(buf, n.key, headerValue(p.RequestHeader, "User-Agent"))
+	case JSONReferer:
+		return appendJSONStringField(buf, n.key, headerValue(p.RequestHeader, "Referer"))
+	case JSONProtocol:
+		if p.Request == nil {
+			return buf, false
+		}
+		return appendJSONStringField(buf, n.key, p.Request.Proto)
+	case JSONProtocolVersion:
+		if p.Request == nil || p.Request.ProtoMajor == 0 {
+			return buf, false
+		}
+		buf = append(append(buf, n.key...), '"')
+		buf = strconv.AppendInt(buf, int64(p.Request.ProtoMajor), 10)
+		buf = append(buf, '.')
+		buf = strconv.AppendInt(buf, int64(p.Request.ProtoMinor), 10)
+		return append(buf, '"'), true
+	case JSONRequestSize:
+		size := int64(len(p.RequestBody))
+		if p.Request != nil && p.Request.ContentLength > 0 {
+			size = p.Request.ContentLength
+		}
+		return strconv.AppendInt(append(buf, n.key...), size, 10), true
+	case JSONResponseSize:
+		return strconv.AppendInt(append(buf, n.key...), int64(p.BodySize), 10), true
+	case JSONRequestHeaders:
+		return e.appendHeaders(buf, n, p.RequestHeader)
+	case JSONResponseHeaders:
+		return e.appendHeaders(buf, n, p.ResponseHeader)
+	case JSONRequestBody:
+		return e.appendBody(buf, n.key, p.RequestBody)
+	case JSONResponseBody:
+		return e.appendBody(buf, n.key, p.ResponseBody)
+	case JSONTraceID:
+		traceID, _ := parseTraceparent(headerValue(p.RequestHeader, "Traceparent"))
+		if traceID == "" {
+			return buf, false
+		}
+		buf = append(append(buf, n.key...), '"')
+		buf = append(buf, s.TracePrefix...)
+		buf = e.appendTraceID(buf, traceID)
+		return append(buf, '"'), true
+	case JSONSpanID:
+		_, spanID := parseTraceparent(headerValue(p.RequestHeader, "Traceparent"))
+		if spanID == "" {
+			return buf, false
+		}
+		buf = append(append(buf, n.key...), '"')
+		buf = e.appendTraceID(buf, spanID)
+		return append(buf, '"'), true
+	case JSONRequestID:
+		return appendJSONStringField(buf, n.key, headerValue(p.RequestHeader, s.RequestIDHeader))
+	case JSONError:
+		if p.Error == nil {
+			return buf, false
+		}
+		return appendJSONStringField(buf, n.key, p.Error.Error())
+	case JSONClientCanceled:
+		if !p.ClientCanceled {
+			return buf, false
+		}
+		return append(append(buf, n.key...), "true"...), true
+	case JSONBytesExpected:
+		if p.Error == nil || p.BytesExpected == 0 {
+			return buf, false
+		}
+		return strconv.AppendInt(append(buf, n.key...), p.BytesExpected, 10), true
+	case JSONBytesWritten:
+		if p.Error == nil {
+			return buf, false
+		}
+		return strconv.AppendInt(append(buf, n.key...), p.BytesWritten, 10), true
+	case JSONFlushes:
+		if p.Flushes == 0 {
+			return buf, false
+		}
+		return strconv.AppendInt(append(buf, n.key...), int64(p.Flushes), 10), true
+	case JSONInformational:
+		if len(p.Informational) == 0 {
+			return buf, false
+		}
+		buf = append(append(buf, n.key...), '[')
+		for i, code := range p.Informational {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = strconv.AppendInt(buf, int64(code), 10)
+		}
+		return append(buf, ']'), true
+	case JSONCountryCode, JSONCountry, JSONCity, JSONASOrg:
+		if p.Geo == nil {
+			return buf, false
+		}
+		switch n.field {
+		case JSONCountryCode:
+			return appendJSONStringField(buf, n.key, p.Geo.CountryCode)
+		case JSONCountry:
+			return appendJSONStringField(buf, n.key, p.Geo.Country)
+		case JSONCity:
+			return appendJSONStringField(buf, n.key, p.Geo.City)
+		}
+		return appendJSONStringField(buf, n.key, p.Geo.ASOrg)
+	case JSONASN:
+		if p.Geo == nil || p.Geo.ASN == 0 {
+			return buf, false
+		}
+		return strconv.AppendUint(append(buf, n.key...), uint64(p.Geo.ASN), 10), true
+	case JSONUAName, JSONUAVersion, JSONUAOS, JSONUAOSVersion, JSONUADevice, JSONUAClass:
+		if p.UserAgent == nil {
+			return buf, false
+		}
+		switch n.field {
+		case JSONUAName:
+			return appendJSONStringField(buf, n.key, p.UserAgent.Name)
+		case JSONUAVersion:
+			return appendJSONStringField(buf, n.key, p.UserAgent.Version)
+		case JSONUAOS:
+			return appendJSONStringField(buf, n.key, p.UserAgent.OS)
+		case JSONUAOSVersion:
+			return appendJSONStringField(buf, n.key, p.UserAgent.OSVersion)
+		case JSONUADevice:
+			return appendJSONStringField(buf, n.key, string(p.UserAgent.Device))
+		}
+		return appendJSONStringField(buf, n.key, string(p.UserAgent.Class))
+	case JSONRedactions:
+		if len(p.Redactions) == 0 {
+			return buf, false
+		}
+		names := make([]string, 0, len(p.Redactions))
+		for name := range p.Redactions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		buf = append(append(buf, n.key...), '{')
+		for i, name := range names {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(appendJSONString(buf, name), ':')
+			buf = strconv.AppendInt(buf, int64(p.Redactions[name]), 10)
+		}
+		return append(buf, '}'), true
+	case JSONFields:
+		if len(p.Fields) == 0 {
+			return buf, false
+		}
+		buf = append(append(buf, n.key...), '{')
+		for i, f := range p.Fields {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(appendJSONString(buf, f.Key), ':')
+			buf = e.appendAny(buf, f.Value)
+		}
+		return append(buf, '}'), true
+	}
+	return buf, false
+}
+
+// appendAny appends extra field value, durations and times are formatted like latency and timestamp
+func (e *jsonEncoder) appendAny(buf []byte, v any) []byte {
+	switch v := v.(type) {
+	case string:
+		return appendJSONString(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case time.Duration:
+		return e.appendDuration(buf, v)
+	case time.Time:
+		buf = append(buf, '"')
+		buf = v.AppendFormat(buf, e.schema.TimeFormat)
+		return append(buf, '"')
+	case []byte:
+		return appendJSONString(buf, string(v))
+	case error:
+		return appendJSONString(buf, v.Error())
+	case fmt.Stringer:
+		return appendJSONString(buf, v.String())
+	case nil:
+		return append(buf, "null"...)
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return append(buf, b...)
+	}
+	return appendJSONString(buf, fmt.Sprint(v))
+}
+
+func (e *jsonEncoder) appendDuration(buf []byte, d time.Duration) []byte {
+	switch e.schema.DurationUnit {
+	case JSONDurationMillis:
+		return strconv.AppendFloat(buf, float64(d)/float64(time.Millisecond), 'f', -1, 64)
+	case JSONDurationSeconds:
+		return strconv.AppendFloat(buf, d.Seconds(), 'f', -1, 64)
+	case JSONDurationString:
+		buf = append(buf, '"')
+		buf = strconv.AppendFloat(buf, d.Seconds(), 'f', -1, 64)
+		return append(buf, `s"`...)
+	default:
+		return strconv.AppendInt(buf, int64(d), 10)
+	}
+}
+
+// appendTraceID appends hex id, or decimal lower 64 bits of it
+func (e *jsonEncoder) appendTraceID(buf []byte, id string) []byte {
+	if !e.schema.DecimalTraceIDs {
+		return append(buf, id...)
+	}
+	if len(id) > 16 {
+		id = id[len(id)-16:]
+	}
+	v, _ := strconv.ParseUint(id, 16, 64) // already validated
+	return strconv.AppendUint(buf, v, 10)
+}
+
+// appendHeaders appends headers object with sorted keys, or a field per header when FlattenHeaders is set
+func (e *jsonEncoder) appendHeaders(buf []byte, n *jsonNode, h http.Header) ([]byte, bool) {
+	if len(h) == 0 {
+		return buf, false
+	}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if e.schema.FlattenHeaders {
+		for i, k := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, n.name+"."+strings.ToLower(k))
+			buf = append(buf, ':')
+			buf = appendJSONStrings(buf, h[k])
+		}
+		return buf, true
+	}
+
+	buf = append(buf, n.key...)
+	buf = append(buf, '{')
+	for i, k := range keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendJSONString(buf, k)
+		buf = append(buf, ':')
+		buf = appendJSONStrings(buf, h[k])
+	}
+	return append(buf, '}'), true
+}
+
+// appendBody appends body as embedded compact JSON if allowed and valid, as a string otherwise
+func (e *jsonEncoder) appendBody(buf []byte, key []byte, body []byte) ([]byte, bool) {
+	if len(body) == 0 {
+		return buf, false
+	}
+	buf = append(buf, key...)
+	if e.schema.EmbedJSONBody && json.Valid(body) {
+		out := bytes.NewBuffer(buf)
+		if err := json.Compact(out, body); err == nil {
+			return out.Bytes(), true
+		}
+	}
+	buf = append(buf, '"')
+	buf = appendJSONStringContent(buf, string(body))
+	return append(buf, '"'), true
+}
+
+// parseTraceparent returns trace and parent span IDs from W3C traceparent header:
+// version-traceid-parentid-flags, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceparent(v string) (traceID, spanID string) {
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return "", ""
+	}
+	traceID, spanID = v[3:35], v[36:52]
+	if !isHexID(traceID) || !isHexID(spanID) {
+		return "", ""
+	}
+	return traceID, spanID
+}
+
+// isHexID returns true for lower case hex, which is not all zeros
+func isHexID(id string) bool {
+	nonZero := false
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+		nonZero = nonZero || c != '0'
+	}
+	return nonZero
+}
+
+// headerValue is http.Header.Get for canonical key without allocations
+func headerValue(h http.Header, key string) string {
+	if v := h[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func appendJSONStringField(buf []byte, key []byte, s string) ([]byte, bool) {
+	if s == "" {
+		return buf, false
+	}
+	return appendJSONString(append(buf, key...), s), true
+}
+
+func appendJSONStrings(buf []byte, values []string) []byte {
+	buf = append(buf, '[')
+	for i, v := range values {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendJSONString(buf, v)
+	}
+	return append(buf, ']')
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	buf = appendJSONStringContent(buf, s)
+	return append(buf, '"')
+}
+
+// appendJSONStringContent appends s escaped for JSON string without quotes,
+// invalid UTF-8 is replaced with U+FFFD like encoding/json does
+func appendJSONStringContent(buf []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20 || c == 0x7f:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf = append(buf, `\ufffd`...)
+		case r == '\u2028' || r == '\u2029':
+			// line separators break JavaScript consumers
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		default:
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return buf
+}
@@ -0,0 +1,253 @@
+package httplog
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogFormatterSchemas(t *testing.T) {
+	r := httptest.NewRequest("POST", "/users?page=2", strings.NewReader(`{"name":"jack"}`))
+	r.Header.Set("User-Agent", "curl/8.0")
+	r.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("X-Request-Id", "req-1")
+	param := LogFormatterParams{
+		Request:        r,
+		RouterName:     "API",
+		TimeStamp:      time.Date(2024, 5, 1, 10, 20, 30, 123000000, time.UTC),
+		StatusCode:     201,
+		Level:          LevelInfo,
+		Latency:        1500 * time.Microsecond,
+		ClientIP:       "10.0.0.1",
+		Method:         "POST",
+		Path:           "/users?page=2",
+		Scheme:         "https",
+		Host:           "example.com",
+		FullURL:        "https://example.com/users?page=2",
+		BodySize:       11,
+		RequestHeader:  r.Header,
+		ResponseHeader: http.Header{"Content-Type": {"application/json"}},
+		RequestBody:    []byte("{\n  \"name\": \"jack\"\n}"),
+		ResponseBody:   []byte("created\x1b"),
+	}
+
+	t.Run("default", func(t *testing.T) {
+		out := JSONLogFormatter(JSONSchemaDefault())(param)
+
+		assert.True(t, strings.HasSuffix(out, "}\n"))
+		assert.Equal(t, 1, strings.Count(out, "\n"), "one object per line")
+		assert.Equal(t, `{"time":"2024-05-01T10:20:30.123Z","level":"info","msg":"POST /users?page=2 201","router":"API",`+
+			`"method":"POST","url":"https://example.com/users?page=2","path":"/users?page=2","status":201,"latency":1500000,`+
+			`"client_ip":"10.0.0.1","user_agent":"curl/8.0","proto":"HTTP/1.1","request_size":15,"body_size":11,`+
+			`"request_headers":{"Traceparent":["00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"],"User-Agent":["curl/8.0"],"X-Request-Id":["req-1"]},`+
+			`"response_headers":{"Content-Type":["application/json"]},"request_body":{"name":"jack"},"response_body":"created\u001b",`+
+			`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","request_id":"req-1"}`+"\n", out)
+	})
+
+	t.Run("ECS", func(t *testing.T) {
+		p := param
+		p.Error = errors.New("write: broken pipe")
+		out := JSONLogFormatter(JSONSchemaECS())(p)
+
+		var v map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(out), &v))
+		assert.Equal(t, "2024-05-01T10:20:30.123Z", v["@timestamp"])
+		assert.Equal(t, map[string]any{"level": "info"}, v["log"])
+		http := v["http"].(map[string]any)
+		assert.Equal(t, "POST", http["request"].(map[string]any)["method"])
+		assert.Equal(t, "1.1", http["version"])
+		assert.Equal(t, map[string]any{"content": "{\n  \"name\": \"jack\"\n}", "bytes": float64(15)},
+			http["request"].(map[string]any)["body"], "ECS body content is a string")
+		assert.Equal(t, float64(201), http["response"].(map[string]any)["status_code"])
+		assert.Equal(t, float64(1500000), v["event"].(map[string]any)["duration"])
+		assert.Equal(t, map[string]any{"id": "4bf92f3577b34da6a3ce929d0e0e4736"}, v["trace"])
+		assert.Equal(t, map[string]any{"message": "write: broken pipe"}, v["error"])
+	})
+
+	t.Run("OTel", func(t *testing.T) {
+		out := JSONLogFormatter(JSONSchemaOTel())(param)
+
+		var v map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(out), &v))
+		assert.Equal(t, "INFO", v["severity_text"])
+		assert.Equal(t, "POST", v["http.request.method"])
+		assert.Equal(t, 0.0015, v["httplog.request.duration"])
+		assert.Equal(t, []any{"curl/8.0"}, v["http.request.header.user-agent"])
+		assert.Equal(t, []any{"application/json"}, v["http.response.header.content-type"])
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", v["trace_id"])
+	})
+
+	t.Run("GCP", func(t *testing.T) {
+		p := param
+		p.StatusCode = 404
+		p.Level = LevelWarn
+		out := JSONLogFormatter(JSONSchemaGCP("my-project"))(p)
+
+		var v map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(out), &v))
+		assert.Equal(t, "WARNING", v["severity"])
+		assert.Equal(t, map[string]any{
+			"requestMethod": "POST",
+			"requestUrl":    "https://example.com/users?page=2",
+			"status":        float64(404),
+			"latency":       "0.0015s",
+			"remoteIp":      "10.0.0.1",
+			"userAgent":     "curl/8.0",
+			"protocol":      "HTTP/1.1",
+			"requestSize":   float64(15),
+			"responseSize":  float64(11),
+		}, v["httpRequest"])
+		assert.Equal(t, "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", v["logging.googleapis.com/trace"])
+		assert.Equal(t, "00f067aa0ba902b7", v["logging.googleapis.com/spanId"])
+		assert.Equal(t, map[string]any{"router": "API", "request_id": "req-1"}, v["logging.googleapis.com/labels"])
+	})
+
+	t.Run("Datadog", func(t *testing.T) {
+		out := JSONLogFormatter(JSONSchemaDatadog())(param)
+
+		var v map[string]any
+		d := json.NewDecoder(strings.NewReader(out))
+		d.UseNumber()
+		assert.NoError(t, d.Decode(&v))
+		assert.Equal(t, "info", v["status"])
+		assert.Equal(t, json.Number("1500000"), v["duration"])
+		assert.Equal(t, map[string]any{"trace_id": "11803532876627986230", "span_id": "67667974448284343"}, v["dd"])
+		assert.Equal(t, map[string]any{"name": "jack"}, v["http"].(map[string]any)["request"].(map[string]any)["body"])
+	})
+}
+
+func TestJSONLogFormatterEnrichedValues(t *testing.T) {
+	p := LogFormatterParams{
+		Method:         "GET",
+		Path:           "/events",
+		StatusCode:     StatusClientClosedRequest,
+		TTFB:           2 * time.Millisecond,
+		Flushes:        3,
+		Informational:  []int{103},
+		Error:          errors.New("write: broken pipe"),
+		ClientCanceled: true,
+		BytesExpected:  100,
+		BytesWritten:   7,
+		Geo:            &GeoInfo{CountryCode: "GB", Country: "United Kingdom", City: "London", ASN: 20712, ASOrg: "Andrews & Arnold Ltd"},
+		UserAgent:      &UserAgentInfo{Class: UserAgentBrowser, Name: "Firefox", Version: "126.0", OS: "Linux", Device: DeviceDesktop},
+		Redactions:     map[string]int{"email": 2, "card": 1},
+		Fields: []Field{
+			{Key: "tenant", Value: "acme"},
+			{Key: "attempt", Value: 2},
+			{Key: "wait", Value: 1500 * time.Microsecond},
+			{Key: "ip", Value: net.ParseIP("10.0.0.1")},
+			{Key: "tags", Value: []string{"a", "b"}},
+		},
+	}
+
+	t.Run("default", func(t *testing.T) {
+		schema := JSONSchemaDefault()
+		schema.Names = map[JSONField]string{}
+		for f, name := range JSONSchemaDefault().Names {
+			if f >= JSONError {
+				schema.Names[f] = name
+			}
+		}
+		assert.Equal(t, `{"error":"write: broken pipe","client_canceled":true,"bytes_expected":100,"bytes_written":7,`+
+			`"flushes":3,"informational":[103],"country_code":"GB","country":"United Kingdom","city":"London","asn":20712,`+
+			`"as_org":"Andrews & Arnold Ltd","ua_name":"Firefox","ua_version":"126.0","os":"Linux","device":"desktop",`+
+			`"client_class":"browser","redactions":{"card":1,"email":2},`+
+			`"fields":{"tenant":"acme","attempt":2,"wait":1500000,"ip":"10.0.0.1","tags":["a","b"]}}`+"\n",
+			JSONLogFormatter(schema)(p))
+	})
+
+	t.Run("ECS", func(t *testing.T) {
+		var v map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(JSONLogFormatter(JSONSchemaECS())(p)), &v))
+		assert.Equal(t, map[string]any{
+			"geo": map[string]any{"country_iso_code": "GB", "country_name": "United Kingdom", "city_name": "London"},
+			"as":  map[string]any{"number": float64(20712), "organization": map[string]any{"name": "Andrews & Arnold Ltd"}},
+		}, v["client"])
+		assert.Equal(t, map[string]any{
+			"name": "Firefox", "version": "126.0", "os": map[string]any{"name": "Linux"}, "device": map[string]any{"name": "desktop"},
+		}, v["user_agent"])
+		httplog := v["httplog"].(map[string]any)
+		assert.Equal(t, true, httplog["client_canceled"])
+		assert.Equal(t, float64(2000000), httplog["response"].(map[string]any)["ttfb"])
+		assert.Equal(t, "acme", httplog["fields"].(map[string]any)["tenant"])
+	})
+
+	t.Run("OTel", func(t *testing.T) {
+		var v map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(JSONLogFormatter(JSONSchemaOTel())(p)), &v))
+		assert.Equal(t, "GB", v["geo.country.iso_code"])
+		assert.Equal(t, "Linux", v["user_agent.os.name"])
+		assert.Equal(t, 0.002, v["httplog.response.ttfb"])
+		assert.Equal(t, 0.0015, v["httplog.fields"].(map[string]any)["wait"])
+	})
+
+	t.Run("no enrichers", func(t *testing.T) {
+		out := JSONLogFormatter(JSONSchemaDefault())(LogFormatterParams{Method: "GET", Path: "/", StatusCode: 200})
+		assert.NotContains(t, out, "bytes_written")
+		assert.NotContains(t, out, "fields")
+	})
+}
+
+func TestJSONLogFormatterOmitsEmptyValues(t *testing.T) {
+	p := LogFormatterParams{Method: "GET", Path: "/", StatusCode: 200}
+	schema := JSONSchemaECS()
+	schema.TimeFormat = time.RFC3339
+	out := JSONLogFormatter(schema)(p)
+	assert.Equal(t, `{"log":{"level":"debug"},"message":"GET / 200","http":{"request":{"method":"GET","body":{"bytes":0}},`+
+		`"response":{"status_code":200,"body":{"bytes":0}}},"url":{"full":"/","original":"/"},"event":{"duration":0}}`+"\n", out)
+}
+
+func TestJSONLogFormatterEscaping(t *testing.T) {
+	p := LogFormatterParams{
+		Method:       "GET",
+		Path:         "/\"quoted\"\n\\\u2028\xff",
+		ResponseBody: []byte("not json"),
+	}
+	out := JSONLogFormatter(JSONSchema{Names: map[JSONField]string{
+		JSONPath:         "path",
+		JSONResponseBody: "body",
+	}})(p)
+	assert.Equal(t, `{"path":"/\"quoted\"\n\\\u2028\ufffd","body":"not json"}`+"\n", out)
+
+	var v map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(out), &v))
+}
+
+func TestJSONSchemaNames(t *testing.T) {
+	assert.Equal(t, []string{"a", "b.c", "d"}, splitJSONName(`a.b\.c.d`))
+
+	// conflicting names are ignored, custom names are used
+	out := JSONLogFormatter(JSONSchema{
+		Names: map[JSONField]string{
+			JSONMethod: "http",
+			JSONStatus: "http.status",
+			JSONPath:   "request.path",
+		},
+		Nested: true,
+	})(LogFormatterParams{Method: "GET", Path: "/", StatusCode: 200})
+	assert.Equal(t, `{"http":"GET","request":{"path":"/"}}`+"\n", out)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value, traceID, spanID string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", ""},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", ""},
+		{"garbage", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		traceID, spanID := parseTraceparent(tt.value)
+		assert.Equal(t, tt.traceID, traceID, tt.value)
+		assert.Equal(t, tt.spanID, spanID, tt.value)
+	}
+}
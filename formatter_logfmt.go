@@ -0,0 +1,256 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultLogfmtFields is the list of fields LogfmtFormatter writes by default
+var DefaultLogfmtFields = []string{
+	"time", "level", "router", "method", "path", "status", "latency", "ip", "size", "error",
+}
+
+// LogfmtOptions configures LogfmtFormatter
+type LogfmtOptions struct {
+	// Fields is the list of keys in output order. Built-in keys are:
+	// time, level, router, method, path, url, scheme, host, status, latency, ttfb,
+	// ip, user_agent, referer, proto, size, error, trace_id, span_id.
+	// Other keys are looked up in LogFormatterParams.Fields, which are not listed are written after them.
+	// Empty values are omitted, except method, path and status.
+	// Optional. Default value is httplog.DefaultLogfmtFields
+	Fields []string
+
+	// RequestHeaders writes request headers as req.header.<key>=value, e.g. req.header.content_type=text/plain
+	// Default: false
+	RequestHeaders bool
+
+	// ResponseHeaders writes response headers as res.header.<key>=value
+	// Default: false
+	ResponseHeaders bool
+
+	// TimeFormat is a layout of time key
+	// Default: time.RFC3339
+	TimeFormat string
+}
+
+// LogfmtFormatter returns formatter writing key=value lines, used by Loki, Heroku and many others
+func LogfmtFormatter(opts LogfmtOptions) LogFormatter {
+	return EncoderFormatter(LogfmtEncoder(opts))
+}
+
+// LogfmtEncoder is the Encoder version of LogfmtFormatter
+func LogfmtEncoder(opts LogfmtOptions) Encoder {
+	if opts.Fields == nil {
+		opts.Fields = DefaultLogfmtFields
+	}
+	if opts.TimeFormat == "" {
+		opts.TimeFormat = time.RFC3339
+	}
+	return EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+		return appendLogfmt(buf, p, &opts)
+	})
+}
+
+// logfmtLine appends space separated key=value pairs to buf
+type logfmtLine struct {
+	buf   []byte
+	start int
+}
+
+// key appends separator and key, value goes next
+func (l *logfmtLine) key(key string) {
+	if len(l.buf) > l.start {
+		l.buf = append(l.buf, ' ')
+	}
+	l.buf = appendLogfmtKey(l.buf, key)
+	l.buf = append(l.buf, '=')
+}
+
+// str appends key and value, if the value is not empty
+func (l *logfmtLine) str(key, value string) {
+	if value != "" {
+		l.key(key)
+		l.buf = appendLogfmtValue(l.buf, value)
+	}
+}
+
+func appendLogfmt(buf []byte, p *LogFormatterParams, opts *LogfmtOptions) []byte {
+	l := logfmtLine{buf: buf, start: len(buf)}
+	for _, key := range opts.Fields {
+		switch key {
+		case "time":
+			if !p.TimeStamp.IsZero() {
+				l.key(key)
+				l.buf = p.TimeStamp.AppendFormat(l.buf, opts.TimeFormat)
+			}
+		case "level":
+			l.key(key)
+			l.buf = append(l.buf, strings.ToLower(p.Level.String())...)
+		case "router":
+			l.str(key, p.RouterName)
+		case "method":
+			l.key(key)
+			l.buf = appendLogfmtValue(l.buf, p.Method)
+		case "path":
+			l.key(key)
+			l.buf = appendLogfmtValue(l.buf, p.Path)
+		case "url":
+			if p.FullURL != "" {
+				l.str(key, p.FullURL)
+			} else {
+				l.str(key, p.Path)
+			}
+		case "scheme":
+			l.str(key, p.Scheme)
+		case "host":
+			l.str(key, p.Host)
+		case "status":
+			l.key(key)
+			l.buf = strconv.AppendInt(l.buf, int64(p.StatusCode), 10)
+		case "latency":
+			l.key(key)
+			l.buf = append(l.buf, p.Latency.String()...)
+		case "ttfb":
+			if p.TTFB > 0 {
+				l.key(key)
+				l.buf = append(l.buf, p.TTFB.String()...)
+			}
+		case "ip":
+			l.str(key, p.ClientIP)
+		case "user_agent":
+			l.str(key, headerValue(p.RequestHeader, "User-Agent"))
+		case "referer":
+			l.str(key, headerValue(p.RequestHeader, "Referer"))
+		case "proto":
+			if p.Request != nil {
+				l.str(key, p.Request.Proto)
+			}
+		case "size":
+			l.key(key)
+			l.buf = strconv.AppendInt(l.buf, int64(p.BodySize), 10)
+		case "error":
+			if p.Error != nil {
+				l.str(key, p.Error.Error())
+			}
+		case "trace_id":
+			traceID, _ := parseTraceparent(headerValue(p.RequestHeader, "Traceparent"))
+			l.str(key, traceID)
+		case "span_id":
+			_, spanID := parseTraceparent(headerValue(p.RequestHeader, "Traceparent"))
+			l.str(key, spanID)
+		default:
+			for _, f := range p.Fields {
+				if f.Key == key {
+					l.key(key)
+					l.buf = appendLogfmtAny(l.buf, f.Value)
+					break
+				}
+			}
+		}
+	}
+
+	// extra fields which are not listed go last
+	for _, f := range p.Fields {
+		if slices.Contains(opts.Fields, f.Key) {
+			continue
+		}
+		l.key(f.Key)
+		l.buf = appendLogfmtAny(l.buf, f.Value)
+	}
+
+	if opts.RequestHeaders {
+		l.headers("req.header.", p.RequestHeader)
+	}
+	if opts.ResponseHeaders {
+		l.headers("res.header.", p.ResponseHeader)
+	}
+	return append(l.buf, '\n')
+}
+
+// headers appends headers sorted by key, multiple values are joined with comma
+func (l *logfmtLine) headers(prefix string, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		l.key(prefix + strings.ReplaceAll(strings.ToLower(k), "-", "_"))
+		l.buf = appendLogfmtValue(l.buf, strings.Join(h[k], ","))
+	}
+}
+
+// appendLogfmtKey appends key with space, '=', '"' and control characters replaced by '_'
+func appendLogfmtKey(buf []byte, key string) []byte {
+	if key == "" {
+		return append(buf, '_')
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError {
+			buf = append(buf, '_')
+			continue
+		}
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf
+}
+
+// appendLogfmtValue appends value, quoted if it is empty or contains space, '=', '"' or control characters
+func appendLogfmtValue(buf []byte, s string) []byte {
+	if s != "" && !needsLogfmtQuote(s) {
+		return append(buf, s...)
+	}
+	buf = append(buf, '"')
+	buf = appendJSONStringContent(buf, s)
+	return append(buf, '"')
+}
+
+func needsLogfmtQuote(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f {
+			return true
+		}
+	}
+	return !utf8.ValidString(s)
+}
+
+// appendLogfmtAny appends extra field value
+func appendLogfmtAny(buf []byte, v any) []byte {
+	switch v := v.(type) {
+	case string:
+		return appendLogfmtValue(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case float64:
+		return strconv.AppendFloat(buf, v, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case time.Duration:
+		return append(buf, v.String()...)
+	case time.Time:
+		return v.AppendFormat(buf, time.RFC3339Nano)
+	case []byte:
+		return appendLogfmtValue(buf, string(v))
+	case error:
+		return appendLogfmtValue(buf, v.Error())
+	case nil:
+		return append(buf, "null"...)
+	default:
+		return appendLogfmtValue(buf, fmt.Sprint(v))
+	}
+}
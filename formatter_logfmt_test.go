@@ -0,0 +1,86 @@
+package httplog
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogfmtFormatter(t *testing.T) {
+	p := LogFormatterParams{
+		TimeStamp:  time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC),
+		Level:      LevelWarn,
+		RouterName: "API",
+		Method:     "GET",
+		Path:       "/users?q=a b",
+		StatusCode: 404,
+		Latency:    1500 * time.Microsecond,
+		ClientIP:   "10.0.0.1",
+		BodySize:   9,
+	}
+	assert.Equal(t,
+		`time=2024-05-01T10:20:30Z level=warn router=API method=GET path="/users?q=a b" status=404 latency=1.5ms ip=10.0.0.1 size=9`+"\n",
+		LogfmtFormatter(LogfmtOptions{})(p))
+
+	p.Error = errors.New(`read "body": EOF`)
+	assert.Equal(t,
+		`status=404 method=GET error="read \"body\": EOF"`+"\n",
+		LogfmtFormatter(LogfmtOptions{Fields: []string{"status", "method", "error", "referer"}})(p))
+}
+
+func TestLogfmtFormatterHeaders(t *testing.T) {
+	p := LogFormatterParams{
+		StatusCode: 404,
+		RequestHeader: http.Header{
+			"Content-Type": {"text/plain"},
+			"Accept":       {"text/html", "application/json"},
+		},
+		ResponseHeader: http.Header{"X-Cache": {"MISS"}},
+	}
+	out := LogfmtFormatter(LogfmtOptions{
+		Fields:          []string{"status"},
+		RequestHeaders:  true,
+		ResponseHeaders: true,
+	})(p)
+	assert.Equal(t,
+		`status=404 req.header.accept=text/html,application/json req.header.content_type=text/plain res.header.x_cache=MISS`+"\n",
+		out)
+}
+
+func TestLogfmtFormatterFields(t *testing.T) {
+	p := LogFormatterParams{StatusCode: 404}
+	p.AddField("tenant", "acme corp")
+	p.AddField("request_id", "r-1")
+	p.AddField("retries", 2)
+	p.AddField("cached", true)
+	p.AddField("db", 20*time.Millisecond)
+
+	out := LogfmtFormatter(LogfmtOptions{Fields: []string{"request_id", "status"}})(p)
+	assert.Equal(t, `request_id=r-1 status=404 tenant="acme corp" retries=2 cached=true db=20ms`+"\n", out)
+}
+
+func TestLogfmtQuoting(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"", `""`},
+		{"a b", `"a b"`},
+		{"a=b", `"a=b"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"line\nbreak", `"line\nbreak"`},
+		{"esc\x1b[31m", `"esc\u001b[31m"`},
+		{`back\slash`, `"back\\slash"`},
+		{"ünïcode", "ünïcode"},
+		{"bad\xff", `"bad\ufffd"`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, string(appendLogfmtValue(nil, tt.value)), tt.value)
+	}
+	assert.Equal(t, "a_b_c_", string(appendLogfmtKey(nil, "a b=c\"")))
+	assert.Equal(t, "_", string(appendLogfmtKey(nil, "")))
+}
@@ -0,0 +1,251 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewPatternEncoder compiles Apache mod_log_config style pattern, e.g. Combined Log Format:
+//
+//	%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"
+//
+// Supported directives:
+//
+//	%%          percent sign
+//	%a, %h      client IP
+//	%l          remote logname, always "-"
+//	%u          remote user from Basic authorization
+//	%t          time the request was received: [10/Oct/2000:13:55:36 -0700]
+//	%{layout}t  time in Go layout, or sec, msec, usec since epoch
+//	%r          request line: GET /path?query HTTP/1.1
+//	%m          request method
+//	%U          URL path without query
+//	%q          query string with leading "?", or empty
+//	%H          request protocol
+//	%v, %V      host the client requested
+//	%s, %>s     status code
+//	%b          response body size, "-" if 0
+//	%B          response body size
+//	%O          response bytes written to the client
+//	%I          request Content-Length
+//	%D          latency in microseconds
+//	%T          latency in seconds, %{ms}T, %{us}T and %{s}T for units
+//	%{Name}i    request header
+//	%{Name}o    response header
+//	%{key}x     extra field added with AddField (non-Apache)
+//	%L          log level (non-Apache)
+//	%R          router name (non-Apache)
+//
+// Empty values are written as "-", quotes and control characters are escaped like Apache does.
+func NewPatternEncoder(pattern string) (Encoder, error) {
+	parts, err := parsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+		for i := range parts {
+			buf = parts[i].append(buf, p)
+		}
+		return append(buf, '\n')
+	}), nil
+}
+
+// NewPatternFormatter is the LogFormatter version of NewPatternEncoder
+func NewPatternFormatter(pattern string) (LogFormatter, error) {
+	e, err := NewPatternEncoder(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return EncoderFormatter(e), nil
+}
+
+// patternPart is a literal text or a directive with optional {argument}
+type patternPart struct {
+	literal   string
+	directive byte
+	arg       string
+}
+
+func parsePattern(pattern string) ([]patternPart, error) {
+	var parts []patternPart
+	var literal strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			literal.WriteByte(pattern[i])
+			continue
+		}
+		start := i
+		i++
+		if i < len(pattern) && pattern[i] == '%' {
+			literal.WriteByte('%')
+			continue
+		}
+
+		// %>s and %<s are the final and the original status, they are the same here
+		if i < len(pattern) && (pattern[i] == '>' || pattern[i] == '<') {
+			i++
+		}
+		var arg string
+		if i < len(pattern) && pattern[i] == '{' {
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed { at position %d", i)
+			}
+			arg = pattern[i+1 : i+end]
+			i += end + 1
+		}
+		if i >= len(pattern) {
+			return nil, fmt.Errorf("missing directive at position %d", start)
+		}
+
+		part := patternPart{directive: pattern[i], arg: arg}
+		if err := part.validate(); err != nil {
+			return nil, fmt.Errorf("%%%s at position %d: %w", pattern[start+1:i+1], start, err)
+		}
+		if literal.Len() > 0 {
+			parts = append(parts, patternPart{literal: literal.String()})
+			literal.Reset()
+		}
+		parts = append(parts, part)
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, patternPart{literal: literal.String()})
+	}
+	return parts, nil
+}
+
+func (d *patternPart) validate() error {
+	switch d.directive {
+	case 'i', 'o', 'x':
+		if d.arg == "" {
+			return fmt.Errorf("name is required")
+		}
+		if d.directive != 'x' {
+			d.arg = http.CanonicalHeaderKey(d.arg)
+		}
+	case 'T':
+		switch d.arg {
+		case "", "s", "ms", "us":
+		default:
+			return fmt.Errorf("unknown unit %q", d.arg)
+		}
+	case 't', 'a', 'h', 'l', 'u', 'r', 'm', 'U', 'q', 'H', 'v', 'V', 's', 'b', 'B', 'O', 'I', 'D', 'L', 'R':
+	default:
+		return fmt.Errorf("unknown directive")
+	}
+	return nil
+}
+
+func (d *patternPart) append(buf []byte, p *LogFormatterParams) []byte {
+	if d.directive == 0 {
+		return append(buf, d.literal...)
+	}
+	path, query, hasQuery := strings.Cut(p.Path, "?")
+	switch d.directive {
+	case 'a', 'h':
+		return appendPatternValue(buf, p.ClientIP)
+	case 'l':
+		return append(buf, '-')
+	case 'u':
+		return appendPatternValue(buf, basicAuthUser(p.RequestHeader))
+	case 't':
+		start := p.TimeStamp.Add(-p.Latency)
+		switch d.arg {
+		case "":
+			buf = append(buf, '[')
+			buf = start.AppendFormat(buf, clfTimeFormat)
+			return append(buf, ']')
+		case "sec":
+			return strconv.AppendInt(buf, start.Unix(), 10)
+		case "msec":
+			return strconv.AppendInt(buf, start.UnixMilli(), 10)
+		case "usec":
+			return strconv.AppendInt(buf, start.UnixMicro(), 10)
+		default:
+			return start.AppendFormat(buf, d.arg)
+		}
+	case 'r':
+		buf = appendCLFEscaped(buf, p.Method)
+		buf = append(buf, ' ')
+		buf = appendCLFEscaped(buf, p.Path)
+		if p.Request != nil && p.Request.Proto != "" {
+			buf = append(buf, ' ')
+			buf = appendCLFEscaped(buf, p.Request.Proto)
+		}
+		return buf
+	case 'm':
+		return appendPatternValue(buf, p.Method)
+	case 'U':
+		return appendPatternValue(buf, path)
+	case 'q':
+		if !hasQuery {
+			return buf
+		}
+		return appendCLFEscaped(append(buf, '?'), query)
+	case 'H':
+		if p.Request == nil {
+			return append(buf, '-')
+		}
+		return appendPatternValue(buf, p.Request.Proto)
+	case 'v', 'V':
+		return appendPatternValue(buf, p.Host)
+	case 's':
+		return strconv.AppendInt(buf, int64(p.StatusCode), 10)
+	case 'b':
+		if p.BodySize == 0 {
+			return append(buf, '-')
+		}
+		return strconv.AppendInt(buf, int64(p.BodySize), 10)
+	case 'B':
+		return strconv.AppendInt(buf, int64(p.BodySize), 10)
+	case 'O':
+		return strconv.AppendInt(buf, p.BytesWritten, 10)
+	case 'I':
+		if p.Request == nil || p.Request.ContentLength < 0 {
+			return append(buf, '-')
+		}
+		return strconv.AppendInt(buf, p.Request.ContentLength, 10)
+	case 'D':
+		return strconv.AppendInt(buf, p.Latency.Microseconds(), 10)
+	case 'T':
+		switch d.arg {
+		case "ms":
+			return strconv.AppendInt(buf, p.Latency.Milliseconds(), 10)
+		case "us":
+			return strconv.AppendInt(buf, p.Latency.Microseconds(), 10)
+		default:
+			return strconv.AppendInt(buf, int64(p.Latency/time.Second), 10)
+		}
+	case 'i':
+		return appendPatternValue(buf, strings.Join(p.RequestHeader[d.arg], ", "))
+	case 'o':
+		return appendPatternValue(buf, strings.Join(p.ResponseHeader[d.arg], ", "))
+	case 'x':
+		for _, f := range p.Fields {
+			if f.Key == d.arg {
+				return appendPatternValue(buf, fmt.Sprint(f.Value))
+			}
+		}
+		return append(buf, '-')
+	case 'L':
+		return append(buf, p.Level.String()...)
+	case 'R':
+		return appendPatternValue(buf, p.RouterName)
+	}
+	return buf
+}
+
+// appendPatternValue appends escaped value, "-" if it is empty
+func appendPatternValue(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	return appendCLFEscaped(buf, s)
+}
@@ -0,0 +1,89 @@
+package httplog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternFormatterCombined(t *testing.T) {
+	f, err := NewPatternFormatter(`%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`)
+	assert.NoError(t, err)
+
+	p := clfTestParams()
+	assert.Equal(t, CombinedLogFormatter(p), f(p))
+}
+
+func TestPatternFormatterDirectives(t *testing.T) {
+	p := clfTestParams()
+	p.Path = "/search?q=go"
+	p.Host = "example.com"
+	p.Latency = 1500 * time.Millisecond
+	p.BytesWritten = 100
+	p.RouterName = "API"
+	p.Level = LevelWarn
+	p.ResponseHeader = http.Header{"Content-Type": {"text/html"}}
+	p.AddField("request_id", "r-1")
+
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"%m %U%q %H", "GET /search?q=go HTTP/1.0"},
+		{"%v %V %a", "example.com example.com 127.0.0.1"},
+		{"%s %<s %B %O %I", "200 200 2326 100 0"},
+		{"%D %T %{ms}T %{us}T %{s}T", "1500000 1 1500 1500000 1"},
+		{"%{sec}t %{msec}t", "971211335 971211335500"},
+		{"%{2006-01-02}t", "2000-10-10"},
+		{"%{content-type}o %{X-Missing}i", "text/html -"},
+		{"%{request_id}x %{missing}x", "r-1 -"},
+		{"%L %R 100%%", "WARN API 100%"},
+		{"no directives", "no directives"},
+	}
+	for _, tt := range tests {
+		f, err := NewPatternFormatter(tt.pattern)
+		if assert.NoError(t, err, tt.pattern) {
+			assert.Equal(t, tt.expected+"\n", f(p), tt.pattern)
+		}
+	}
+}
+
+func TestPatternFormatterErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		err     string
+	}{
+		{"%h %Z", "%Z at position 3: unknown directive"},
+		{"%{Referer", "unclosed { at position 1"},
+		{"%h %", "missing directive at position 3"},
+		{"%{}i", "%{}i at position 0: name is required"},
+		{"%{min}T", `%{min}T at position 0: unknown unit "min"`},
+	}
+	for _, tt := range tests {
+		_, err := NewPatternEncoder(tt.pattern)
+		assert.EqualError(t, err, tt.err, tt.pattern)
+	}
+}
+
+func TestLoggerWithConfigPattern(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger, err := LoggerWithConfig(LoggerConfig{
+		Output:  buffer,
+		Pattern: `%m %U %>s`,
+	})
+	assert.NoError(t, err)
+	logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/tea", nil))
+	assert.Equal(t, "GET /tea 418\n", buffer.String())
+
+	_, err = LoggerWithConfig(LoggerConfig{Pattern: `%m %Q`})
+	assert.EqualError(t, err, "invalid Pattern '%m %Q': %Q at position 3: unknown directive")
+
+	_, err = LoggerWithConfig(LoggerConfig{Pattern: `%m`, Template: `{{.Method}}`})
+	assert.EqualError(t, err, "invalid Pattern: can't be used together with Template")
+}
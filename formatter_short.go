@@ -1,27 +1,31 @@
 package httplog
 
-import (
-	"fmt"
-	"time"
-)
+import "strconv"
 
 // Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
 // Use of this source code is governed by a MIT style
 // license that can be found in the LICENSE file.
 
 func ShortLogFormatter(param LogFormatterParams) string {
+	return encodeToString(ShortEncoder, &param)
+}
+
+func appendShort(buf []byte, param *LogFormatterParams) []byte {
 	var statusColor, resetColor string
 	if param.IsOutputColor() {
 		statusColor = param.StatusCodeColor()
 		resetColor = param.ResetColor()
 	}
 
-	if param.Latency > time.Minute {
-		param.Latency = param.Latency.Truncate(time.Second)
-	}
-	return fmt.Sprintf("[%s] %s %3d %s| %#v\n",
-		param.RouterName,
-		statusColor, param.StatusCode, resetColor,
-		param.Path,
-	)
+	buf = append(buf, '[')
+	buf = append(buf, param.RouterName...)
+	buf = append(buf, "] "...)
+	buf = append(buf, statusColor...)
+	buf = append(buf, ' ')
+	buf = appendIntPad(buf, param.StatusCode, 3)
+	buf = append(buf, ' ')
+	buf = append(buf, resetColor...)
+	buf = append(buf, "| "...)
+	buf = strconv.AppendQuote(buf, param.Path)
+	return append(buf, '\n')
 }
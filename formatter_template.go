@@ -0,0 +1,233 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// NewTemplateEncoder compiles text/template layout. All LogFormatterParams fields are available,
+// e.g. {{.Method}}, {{.StatusCode}} or {{.RequestHeader.Get "User-Agent"}}, and the helpers:
+//
+//	{{.Color "red" .Method}}         wraps text in color of the theme: red, green, yellow, blue, magenta, cyan, white, bold
+//	{{.StatusCodeColor}}, {{.MethodColor}}, {{.ResetColor}}
+//	                                 colors of default formatter, empty when color output is disabled
+//	{{pad 7 .Method}}                pads right to width, {{padLeft 15 .ClientIP}} pads left
+//	{{humanize .Latency}}            rounds duration: 1.52ms, 12.3µs
+//	{{timeFormat "15:04:05" .TimeStamp}}
+//	{{inZone "Europe/Berlin" .TimeStamp}}, {{utc .TimeStamp}}
+//	{{.Field "request_id"}}          extra field added with AddField
+//	{{quote .Path}}                  Go quoted string
+//
+// Newline is appended to the result if the layout doesn't end with it.
+// The layout is executed once with sample params, so unknown fields, wrong arguments
+// and unknown time zones are reported here, not in log entries.
+func NewTemplateEncoder(layout string) (Encoder, error) {
+	t, err := template.New("httplog").Funcs(templateFuncs).Parse(layout)
+	if err != nil {
+		return nil, err
+	}
+	sample := templateSampleParams()
+	if err := t.Execute(io.Discard, templateData{&sample}); err != nil {
+		return nil, err
+	}
+	return EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+		w := appendWriter{buf: buf}
+		if err := t.Execute(&w, templateData{p}); err != nil {
+			w.buf = append(w.buf, "[template error: "...)
+			w.buf = append(w.buf, err.Error()...)
+			w.buf = append(w.buf, ']')
+		}
+		if len(w.buf) == len(buf) || w.buf[len(w.buf)-1] != '\n' {
+			w.buf = append(w.buf, '\n')
+		}
+		return w.buf
+	}), nil
+}
+
+// NewTemplateFormatter is the LogFormatter version of NewTemplateEncoder
+func NewTemplateFormatter(layout string) (LogFormatter, error) {
+	e, err := NewTemplateEncoder(layout)
+	if err != nil {
+		return nil, err
+	}
+	return EncoderFormatter(e), nil
+}
+
+// appendWriter is io.Writer appending to buf
+type appendWriter struct{ buf []byte }
+
+func (w *appendWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+// templateData exposes params to templates with color helpers honoring color mode
+type templateData struct {
+	*LogFormatterParams
+}
+
+// templateSampleParams returns params with every field set, to check templates before use
+func templateSampleParams() LogFormatterParams {
+	header := http.Header{"User-Agent": {"curl/8.0"}}
+	u := &url.URL{Scheme: "https", Host: "example.com", Path: "/users", RawQuery: "page=2"}
+	return LogFormatterParams{
+		Request:        &http.Request{Method: "GET", URL: u, Proto: "HTTP/1.1", Header: header, Host: u.Host},
+		Context:        context.Background(),
+		RouterName:     "sample",
+		TimeStamp:      time.Date(2000, 10, 10, 13, 55, 36, 0, time.UTC),
+		StatusCode:     200,
+		Latency:        time.Millisecond,
+		ClientIP:       "127.0.0.1",
+		ForwardedProto: "https",
+		ForwardedHost:  u.Host,
+		Method:         "GET",
+		Path:           "/users?page=2",
+		Scheme:         u.Scheme,
+		Host:           u.Host,
+		FullURL:        u.String(),
+		BodySize:       2,
+		ResponseBody:   []byte("ok"),
+		RequestBody:    []byte("{}"),
+		ResponseHeader: http.Header{"Content-Type": {"text/plain"}},
+		RequestHeader:  header,
+		Level:          LevelInfo,
+		Geo:            &GeoInfo{},
+		UserAgent:      &UserAgentInfo{},
+		TTFB:           time.Millisecond,
+		Informational:  []int{http.StatusContinue},
+		Trailer:        http.Header{},
+		Error:          errors.New("sample"),
+		BytesExpected:  2,
+		BytesWritten:   2,
+		Redactions:     map[string]int{},
+		Fields:         []Field{},
+	}
+}
+
+// templateColors maps color names to the theme colors, which have this color in DefaultTheme
+var templateColors = map[string]func(t *Theme) string{
+	"red":     func(t *Theme) string { return t.Status5xx },
+	"green":   func(t *Theme) string { return t.Status2xx },
+	"yellow":  func(t *Theme) string { return t.Status4xx },
+	"blue":    func(t *Theme) string { return t.MethodGet },
+	"magenta": func(t *Theme) string { return t.MethodHead },
+	"cyan":    func(t *Theme) string { return t.MethodPost },
+	"white":   func(t *Theme) string { return t.Status3xx },
+	"bold":    func(*Theme) string { return ANSIColor(1) },
+}
+
+// Color wraps s in the named color, if color output is enabled
+func (d templateData) Color(name string, s any) string {
+	text := fmt.Sprint(s)
+	color, ok := templateColors[name]
+	if !ok || !d.IsOutputColor() {
+		return text
+	}
+	theme := d.Theme()
+	return color(theme) + text + theme.Reset
+}
+
+// StatusCodeColor is the color of status code, empty if color output is disabled
+func (d templateData) StatusCodeColor() string {
+	if !d.IsOutputColor() {
+		return ""
+	}
+	return d.LogFormatterParams.StatusCodeColor()
+}
+
+// MethodColor is the color of method, empty if color output is disabled
+func (d templateData) MethodColor() string {
+	if !d.IsOutputColor() {
+		return ""
+	}
+	return d.LogFormatterParams.MethodColor()
+}
+
+// ResetColor resets color, empty if color output is disabled
+func (d templateData) ResetColor() string {
+	if !d.IsOutputColor() {
+		return ""
+	}
+	return d.LogFormatterParams.ResetColor()
+}
+
+// Field returns extra field value, nil if it is not set
+func (d templateData) Field(key string) any {
+	for _, f := range d.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// templateZones caches locations of inZone by name, time.LoadLocation reads zoneinfo on every call
+var templateZones sync.Map
+
+var templateFuncs = template.FuncMap{
+	"pad": func(width int, s any) string {
+		text := fmt.Sprint(s)
+		return text + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(text)))
+	},
+	"padLeft": func(width int, s any) string {
+		text := fmt.Sprint(s)
+		return strings.Repeat(" ", max(0, width-utf8.RuneCountInString(text))) + text
+	},
+	"humanize":   humanizeDuration,
+	"timeFormat": func(layout string, t time.Time) string { return t.Format(layout) },
+	"inZone": func(zone string, t time.Time) (time.Time, error) {
+		if loc, ok := templateZones.Load(zone); ok {
+			return t.In(loc.(*time.Location)), nil
+		}
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return t, err
+		}
+		templateZones.Store(zone, loc)
+		return t.In(loc), nil
+	},
+	"utc":   func(t time.Time) time.Time { return t.UTC() },
+	"quote": func(s any) string { return strconv.Quote(fmt.Sprint(s)) },
+}
+
+// humanizeDuration rounds d to 3 significant digits in the most suitable unit
+func humanizeDuration(d time.Duration) string {
+	switch abs := max(d, -d); {
+	case abs < time.Microsecond:
+		return d.String()
+	case abs < time.Millisecond:
+		return strconv.FormatFloat(float64(d)/float64(time.Microsecond), 'f', precision(abs, time.Microsecond), 64) + "µs"
+	case abs < time.Second:
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', precision(abs, time.Millisecond), 64) + "ms"
+	case abs < time.Minute:
+		return strconv.FormatFloat(d.Seconds(), 'f', precision(abs, time.Second), 64) + "s"
+	default:
+		return d.Round(time.Second).String()
+	}
+}
+
+// precision returns number of decimals to show 3 significant digits of d in unit
+func precision(d, unit time.Duration) int {
+	switch {
+	case d >= 100*unit:
+		return 0
+	case d >= 10*unit:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,93 @@
+package httplog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateFormatter(t *testing.T) {
+	p := clfTestParams()
+	p.Latency = 1523456 * time.Nanosecond
+	p.AddField("request_id", "r-1")
+
+	f, err := NewTemplateFormatter(`{{timeFormat "15:04:05" (utc .TimeStamp)}} {{pad 5 .Method}}|{{padLeft 12 .ClientIP}} ` +
+		`{{.StatusCode}} {{humanize .Latency}} {{.RequestHeader.Get "User-Agent" | quote}} {{.Field "request_id"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `20:55:37 GET  |   127.0.0.1 200 1.52ms "Mozilla/4.08 [en] (Win98; I ;Nav)" r-1`+"\n", f(p))
+
+	f, err = NewTemplateFormatter(`{{timeFormat "15:04 MST" (inZone "Asia/Tokyo" .TimeStamp)}}` + "\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "05:55 JST\n", f(p), "newline is not doubled")
+}
+
+func TestTemplateFormatterColors(t *testing.T) {
+	f, err := NewTemplateFormatter(`{{.StatusCodeColor}}{{.StatusCode}}{{.ResetColor}} {{.Color "red" "!"}} {{.Color "unknown" "?"}}`)
+	assert.NoError(t, err)
+
+	p := LogFormatterParams{StatusCode: 200, colorMode: ColorForce}
+	assert.Equal(t, green+"200"+reset+" "+red+"!"+reset+" ?\n", f(p))
+
+	// colors come from the theme
+	dark := DarkTheme(ColorDepth256)
+	p.theme = dark
+	assert.Equal(t, dark.Status2xx+"200"+dark.Reset+" "+dark.Status5xx+"!"+dark.Reset+" ?\n", f(p))
+
+	p.colorMode = ColorDisable
+	assert.Equal(t, "200 ! ?\n", f(p))
+}
+
+func TestTemplateFormatterErrors(t *testing.T) {
+	_, err := NewTemplateFormatter(`{{.Method`)
+	assert.Error(t, err)
+
+	// layout is executed with sample params on construction
+	_, err = NewTemplateFormatter(`{{.Bogus}}`)
+	assert.ErrorContains(t, err, "can't evaluate field Bogus")
+	_, err = NewTemplateFormatter(`{{.Field 1}}`)
+	assert.ErrorContains(t, err, "expected string")
+	_, err = NewTemplateFormatter(`{{inZone "Nowhere/City" .TimeStamp}}`)
+	assert.ErrorContains(t, err, "unknown time zone")
+
+	// execution errors are written to the log entry
+	f, err := NewTemplateFormatter(`{{.Request.URL.Path}}`)
+	assert.NoError(t, err)
+	assert.Contains(t, f(LogFormatterParams{}), "[template error: ")
+
+	_, err = LoggerWithConfig(LoggerConfig{Template: `{{.Unknown`})
+	assert.ErrorContains(t, err, "invalid Template: ")
+}
+
+func TestLoggerWithConfigTemplate(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger, err := LoggerWithConfig(LoggerConfig{
+		Output:   buffer,
+		Template: `{{.Method}} {{.Path}} {{.StatusCode}}`,
+	})
+	assert.NoError(t, err)
+	logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/x?y=1", nil))
+	assert.Equal(t, "GET /x?y=1 200\n", buffer.String())
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{500 * time.Nanosecond, "500ns"},
+		{12345 * time.Nanosecond, "12.3µs"},
+		{1523456 * time.Nanosecond, "1.52ms"},
+		{234567890 * time.Nanosecond, "235ms"},
+		{1500 * time.Millisecond, "1.50s"},
+		{90 * time.Second, "1m30s"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, humanizeDuration(tt.d))
+	}
+}
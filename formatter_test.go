@@ -59,3 +59,30 @@ func TestDefaultLogFormatter(t *testing.T) {
 	assert.Equal(t, "[TEST] 2018/12/07 - 09:11:42 |\x1b[97;42m 200 \x1b[0m|            5s |     20.20.20.20 |\x1b[97;44m GET     \x1b[0m \"/\"\n", DefaultLogFormatter(termTrueParam))
 	assert.Equal(t, "[TEST] 2018/12/07 - 09:11:42 |\x1b[97;42m 200 \x1b[0m|    2743h29m3s |     20.20.20.20 |\x1b[97;44m GET     \x1b[0m \"/\"\n", DefaultLogFormatter(termTrueLongDurationParam))
 }
+
+func TestDefaultLogFormatterFullURL(t *testing.T) {
+	param := LogFormatterParams{
+		RouterName: "TEST",
+		TimeStamp:  time.Unix(1544173902, 0).UTC(),
+		StatusCode: 200,
+		Latency:    time.Second * 5,
+		ClientIP:   "20.20.20.20",
+		Method:     "GET",
+		Path:       "/users?id=1",
+		Scheme:     "https",
+		Host:       "api.example.com",
+		FullURL:    "https://api.example.com/users?id=1",
+		colorMode:  ColorDisable,
+	}
+	assert.Equal(t, "[TEST] 2018/12/07 - 09:11:42 | 200 |            5s |     20.20.20.20 | GET      \"/users?id=1\"\n", DefaultLogFormatter(param))
+
+	// scheme and host from proxy headers are shown
+	param.forwardedOrigin = true
+	assert.Equal(t, "[TEST] 2018/12/07 - 09:11:42 | 200 |            5s |     20.20.20.20 | GET      \"https://api.example.com/users?id=1\"\n", DefaultLogFormatter(param))
+}
+
+func TestGeoInfoFlag(t *testing.T) {
+	assert.Equal(t, "🇺🇦", (&GeoInfo{CountryCode: "ua"}).Flag())
+	assert.Equal(t, "", (&GeoInfo{}).Flag())
+	assert.Equal(t, "", (&GeoInfo{CountryCode: "1A"}).Flag())
+}
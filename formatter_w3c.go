@@ -0,0 +1,143 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultW3CFields is the list of fields W3CLogFormatter writes by default, like IIS does
+var DefaultW3CFields = []string{
+	"date", "time", "c-ip", "cs-username", "cs-method", "cs-uri-stem", "cs-uri-query",
+	"sc-status", "sc-bytes", "time-taken", "cs(User-Agent)", "cs(Referer)",
+}
+
+// W3CLogFormatter returns formatter writing W3C Extended Log File Format.
+// Directives with the #Fields list are written before the first entry,
+// so each logger should have its own formatter and output.
+//
+// Supported fields are: date, time, c-ip, cs-username, cs-method, cs-uri, cs-uri-stem, cs-uri-query,
+// cs-version, cs-host, sc-status, sc-bytes, cs-bytes, time-taken (seconds),
+// cs(Header) for request and sc(Header) for response headers.
+// Unknown fields and empty values are written as "-". If fields are not set, DefaultW3CFields are used.
+func W3CLogFormatter(fields ...string) LogFormatter {
+	return EncoderFormatter(W3CEncoder(fields...))
+}
+
+// W3CEncoder is the Encoder version of W3CLogFormatter
+func W3CEncoder(fields ...string) Encoder {
+	if len(fields) == 0 {
+		fields = DefaultW3CFields
+	}
+	e := &w3cEncoder{fields: make([]w3cField, len(fields))}
+	for i, f := range fields {
+		e.fields[i] = parseW3CField(f)
+	}
+	e.directive = "#Version: 1.0\n#Software: httplog\n#Fields: " + strings.Join(fields, " ") + "\n"
+	return e
+}
+
+type w3cEncoder struct {
+	fields    []w3cField
+	directive string
+	started   atomic.Bool
+}
+
+// w3cField is a parsed field name, header is set for cs(Header) and sc(Header) fields
+type w3cField struct {
+	name   string
+	header string
+}
+
+func parseW3CField(f string) w3cField {
+	for _, prefix := range []string{"cs(", "sc("} {
+		if strings.HasPrefix(f, prefix) && strings.HasSuffix(f, ")") {
+			return w3cField{name: prefix[:2], header: http.CanonicalHeaderKey(f[3 : len(f)-1])}
+		}
+	}
+	return w3cField{name: f}
+}
+
+func (e *w3cEncoder) Encode(buf []byte, p *LogFormatterParams) []byte {
+	if e.started.CompareAndSwap(false, true) {
+		buf = append(buf, e.directive...)
+		buf = append(buf, "#Date: "...)
+		buf = p.TimeStamp.UTC().AppendFormat(buf, time.DateTime)
+		buf = append(buf, '\n')
+	}
+
+	for i, f := range e.fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = e.appendField(buf, f, p)
+	}
+	return append(buf, '\n')
+}
+
+func (e *w3cEncoder) appendField(buf []byte, f w3cField, p *LogFormatterParams) []byte {
+	path, query, _ := strings.Cut(p.Path, "?")
+	switch f.name {
+	case "date":
+		return p.TimeStamp.UTC().AppendFormat(buf, time.DateOnly)
+	case "time":
+		return p.TimeStamp.UTC().AppendFormat(buf, time.TimeOnly)
+	case "c-ip":
+		return appendW3CValue(buf, p.ClientIP)
+	case "cs-username":
+		return appendW3CValue(buf, basicAuthUser(p.RequestHeader))
+	case "cs-method":
+		return appendW3CValue(buf, p.Method)
+	case "cs-uri":
+		return appendW3CValue(buf, p.Path)
+	case "cs-uri-stem":
+		return appendW3CValue(buf, path)
+	case "cs-uri-query":
+		return appendW3CValue(buf, query)
+	case "cs-version":
+		if p.Request == nil {
+			return append(buf, '-')
+		}
+		return appendW3CValue(buf, p.Request.Proto)
+	case "cs-host":
+		return appendW3CValue(buf, p.Host)
+	case "sc-status":
+		return strconv.AppendInt(buf, int64(p.StatusCode), 10)
+	case "sc-bytes":
+		return strconv.AppendInt(buf, int64(p.BodySize), 10)
+	case "cs-bytes":
+		if p.Request == nil || p.Request.ContentLength < 0 {
+			return append(buf, '-')
+		}
+		return strconv.AppendInt(buf, p.Request.ContentLength, 10)
+	case "time-taken":
+		return strconv.AppendFloat(buf, p.Latency.Seconds(), 'f', 3, 64)
+	case "cs":
+		return appendW3CValue(buf, strings.Join(p.RequestHeader[f.header], ","))
+	case "sc":
+		return appendW3CValue(buf, strings.Join(p.ResponseHeader[f.header], ","))
+	default:
+		return append(buf, '-')
+	}
+}
+
+// appendW3CValue appends value with spaces replaced by '+' like IIS does, "-" if it is empty
+func appendW3CValue(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' {
+			buf = append(buf, '+')
+			continue
+		}
+		buf = appendCLFByte(buf, s[i])
+	}
+	return buf
+}
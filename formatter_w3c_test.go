@@ -0,0 +1,36 @@
+package httplog
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestW3CLogFormatter(t *testing.T) {
+	p := clfTestParams()
+	p.Path = "/search?q=go lang"
+	p.Latency = 15 * time.Millisecond
+	p.ResponseHeader = http.Header{"Content-Type": {"image/gif"}}
+
+	f := W3CLogFormatter()
+	assert.Equal(t,
+		"#Version: 1.0\n#Software: httplog\n"+
+			"#Fields: date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes time-taken cs(User-Agent) cs(Referer)\n"+
+			"#Date: 2000-10-10 20:55:37\n"+
+			"2000-10-10 20:55:37 127.0.0.1 frank GET /search q=go+lang 200 2326 0.015 Mozilla/4.08+[en]+(Win98;+I+;Nav) http://example.com/start.html\n",
+		f(p))
+
+	// directives are written once
+	p.Path = "/"
+	assert.Equal(t,
+		"2000-10-10 20:55:37 127.0.0.1 frank GET / - 200 2326 0.015 Mozilla/4.08+[en]+(Win98;+I+;Nav) http://example.com/start.html\n",
+		f(p))
+
+	custom := W3CLogFormatter("cs-version", "sc(Content-Type)", "cs(X-Missing)", "s-unknown")
+	assert.Equal(t,
+		"#Version: 1.0\n#Software: httplog\n#Fields: cs-version sc(Content-Type) cs(X-Missing) s-unknown\n"+
+			"#Date: 2000-10-10 20:55:37\nHTTP/1.0 image/gif - -\n",
+		custom(p))
+}
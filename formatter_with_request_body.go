@@ -3,7 +3,6 @@ package httplog
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 
 	"github.com/TylerBrock/colorjson"
 )
@@ -15,30 +14,53 @@ import (
 // RequestBodyLogFormatter format function with JSON body output or text
 // Note: Requires CaptureRequestBody to be enabled in LoggerConfig
 func RequestBodyLogFormatter(param LogFormatterParams) string {
-	var blueColor, yellowColor, greenColor, resetColor string
+	return encodeToString(RequestBodyEncoder, &param)
+}
+
+func appendRequestBody(buf []byte, param *LogFormatterParams) []byte {
+	return appendBody(buf, param, param.RequestBody)
+}
+
+// appendBody appends indented and colored JSON body, or text body
+func appendBody(buf []byte, param *LogFormatterParams, body []byte) []byte {
+	var textColor, emptyColor, jsonColor, resetColor string
 	if param.IsOutputColor() {
-		blueColor = blue
-		yellowColor = yellow
-		greenColor = green
-		resetColor = param.ResetColor()
+		theme := param.Theme()
+		textColor = theme.BodyText
+		emptyColor = theme.BodyEmpty
+		jsonColor = theme.BodyJSON
+		resetColor = theme.Reset
 	}
 
-	if len(param.RequestBody) == 0 {
-		return fmt.Sprintf("===\n%s EMPTY BODY %s\n===\n", yellowColor, resetColor)
+	buf = append(buf, "===\n"...)
+	if len(body) == 0 {
+		buf = append(buf, emptyColor...)
+		buf = append(buf, " EMPTY BODY "...)
+		buf = append(buf, resetColor...)
+		return append(buf, "\n===\n"...)
 	}
 
 	var bodyJSON map[string]interface{}
-	err := json.Unmarshal(param.RequestBody, &bodyJSON)
+	err := json.Unmarshal(body, &bodyJSON)
 	if err != nil {
 		// it is not a json
-		text := bytes.ToValidUTF8(param.RequestBody, nil)
-		return fmt.Sprintf("===\n%s TEXT BODY:%s\n%s\n===\n", blueColor, resetColor, string(text))
+		buf = append(buf, textColor...)
+		buf = append(buf, " TEXT BODY:"...)
+		buf = append(buf, resetColor...)
+		buf = append(buf, '\n')
+		buf = append(buf, bytes.ToValidUTF8(body, nil)...)
+		return append(buf, "\n===\n"...)
 	}
 
 	f := colorjson.NewFormatter()
 	f.Indent = 2
 	s, _ := f.Marshal(bodyJSON)
-	return fmt.Sprintf("===\n%s JSON BODY:%s\n%s\n===\n", greenColor, resetColor, string(s))
+	buf = append(buf, jsonColor...)
+	buf = append(buf, " JSON BODY:"...)
+	buf = append(buf, resetColor...)
+	buf = append(buf, '\n')
+	buf = append(buf, s...)
+	return append(buf, "\n===\n"...)
 }
 
 // DefaultLogFormatterWithHeadersAndBody is a combination of default log formatter, header log formatter and json body
@@ -1,6 +1,6 @@
 package httplog
 
-import "fmt"
+import "net/http"
 
 // Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
 // Use of this source code is governed by a MIT style
@@ -8,23 +8,39 @@ import "fmt"
 
 // HeaderLogFormatter format function with headers output.
 func RequestHeaderLogFormatter(param LogFormatterParams) string {
-	output := ""
+	return encodeToString(RequestHeaderEncoder, &param)
+}
+
+func appendRequestHeader(buf []byte, param *LogFormatterParams) []byte {
+	return appendHeader(buf, param, param.RequestHeader)
+}
 
-	var blueColor, greenColor, resetColor string
+// appendHeader appends every header line as "  key: [values]"
+func appendHeader(buf []byte, param *LogFormatterParams, header http.Header) []byte {
+	var keyColor, valueColor, resetColor string
 
 	if param.IsOutputColor() {
-		blueColor = "\033[1;34m"
-		greenColor = "\033[;32m"
-		resetColor = param.ResetColor()
+		theme := param.Theme()
+		keyColor = theme.HeaderKey
+		valueColor = theme.HeaderValue
+		resetColor = theme.Reset
 	}
-	for key, value := range param.RequestHeader {
-		output += fmt.Sprintf("  %s %s %s: %s %s %s\n",
-			blueColor, key, resetColor,
-			greenColor, value, resetColor,
-		)
+	for key, value := range header {
+		buf = append(buf, "  "...)
+		buf = append(buf, keyColor...)
+		buf = append(buf, ' ')
+		buf = append(buf, key...)
+		buf = append(buf, ' ')
+		buf = append(buf, resetColor...)
+		buf = append(buf, ": "...)
+		buf = append(buf, valueColor...)
+		buf = append(buf, ' ')
+		buf = appendStrings(buf, value)
+		buf = append(buf, ' ')
+		buf = append(buf, resetColor...)
+		buf = append(buf, '\n')
 	}
-
-	return output
+	return buf
 }
 
 // DefaultLogFormatterWithHeaders is a combination of default log formatter and header log formatter
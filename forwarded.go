@@ -0,0 +1,146 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ForwardedElement is one proxy hop of RFC 7239 Forwarded header
+type ForwardedElement struct {
+	// For identifies the node making the request to the proxy: IP address,
+	// obfuscated identifier like "_hidden" or "unknown". IPv6 brackets and port are stripped.
+	For string
+	// ForPort is the port of For node, if present
+	ForPort string
+	// By identifies the interface where the request came in to the proxy
+	By string
+	// ByPort is the port of By node, if present
+	ByPort string
+	// Proto is the protocol used to make the request, e.g. "https"
+	Proto string
+	// Host is the original value of the Host request header
+	Host string
+}
+
+// ParseForwarded parses the value of RFC 7239 Forwarded header into a list of hops,
+// the first element refers to the client-facing proxy.
+// Multiple header lines should be joined with comma before parsing.
+func ParseForwarded(header string) ([]ForwardedElement, error) {
+	var elements []ForwardedElement
+	for _, rawElement := range splitQuoted(header, ',') {
+		if strings.TrimSpace(rawElement) == "" {
+			continue
+		}
+		var e ForwardedElement
+		seen := map[string]bool{}
+		for _, pair := range splitQuoted(rawElement, ';') {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			name, value, found := strings.Cut(pair, "=")
+			if !found {
+				return nil, fmt.Errorf("forwarded: missing '=' in pair '%s'", pair)
+			}
+			name = strings.ToLower(strings.TrimSpace(name))
+			if seen[name] {
+				return nil, fmt.Errorf("forwarded: duplicate parameter '%s'", name)
+			}
+			seen[name] = true
+
+			value, err := unquoteForwarded(strings.TrimSpace(value))
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "for":
+				e.For, e.ForPort = splitForwardedNode(value)
+			case "by":
+				e.By, e.ByPort = splitForwardedNode(value)
+			case "proto":
+				e.Proto = strings.ToLower(value)
+			case "host":
+				e.Host = value
+			}
+			// extensions are ignored
+		}
+		elements = append(elements, e)
+	}
+	return elements, nil
+}
+
+// splitQuoted splits s by sep, ignoring separators inside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	inQuotes, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && inQuotes:
+			escaped = true
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquoteForwarded returns value of token or quoted-string
+func unquoteForwarded(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		if strings.Contains(s, `"`) {
+			return "", fmt.Errorf("forwarded: unexpected quote in '%s'", s)
+		}
+		return s, nil
+	}
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", errors.New("forwarded: unterminated quoted string")
+	}
+	var b strings.Builder
+	inner := s[1 : len(s)-1]
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		if c == '\\' {
+			i++
+			if i == len(inner) {
+				return "", errors.New("forwarded: unterminated quoted string")
+			}
+			c = inner[i]
+		} else if c == '"' {
+			return "", fmt.Errorf("forwarded: unexpected quote in '%s'", s)
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+// splitForwardedNode splits node into host and port, IPv6 brackets are stripped:
+// "[2001:db8::1]:4711" -> "2001:db8::1", "4711"
+func splitForwardedNode(node string) (host, port string) {
+	if strings.HasPrefix(node, "[") {
+		end := strings.Index(node, "]")
+		if end < 0 {
+			return node, ""
+		}
+		host = node[1:end]
+		port = strings.TrimPrefix(node[end+1:], ":")
+		return host, port
+	}
+	// unbracketed IPv6 is not valid for RFC 7239, but we don't want to cut it
+	if strings.Count(node, ":") == 1 {
+		host, port, _ = strings.Cut(node, ":")
+		return host, port
+	}
+	return node, ""
+}
@@ -0,0 +1,96 @@
+package httplog_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MadAppGang/httplog/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseForwarded(t *testing.T) {
+	elements, err := httplog.ParseForwarded(`for="_gazonk"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []httplog.ForwardedElement{{For: "_gazonk"}}, elements)
+
+	elements, err = httplog.ParseForwarded(`For="[2001:db8:cafe::17]:4711"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []httplog.ForwardedElement{{For: "2001:db8:cafe::17", ForPort: "4711"}}, elements)
+
+	elements, err = httplog.ParseForwarded(`for=192.0.2.60;proto=HTTP;by=203.0.113.43;host="example.com:8080"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []httplog.ForwardedElement{{For: "192.0.2.60", By: "203.0.113.43", Proto: "http", Host: "example.com:8080"}}, elements)
+
+	elements, err = httplog.ParseForwarded(`for=192.0.2.43:47011, for="[2001:db8::1]";by=unknown , for=unknown;host="a,b;c\"d"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []httplog.ForwardedElement{
+		{For: "192.0.2.43", ForPort: "47011"},
+		{For: "2001:db8::1", By: "unknown"},
+		{For: "unknown", Host: `a,b;c"d`},
+	}, elements)
+
+	_, err = httplog.ParseForwarded(`for="192.0.2.43`)
+	assert.Error(t, err)
+	_, err = httplog.ParseForwarded(`for`)
+	assert.Error(t, err)
+	_, err = httplog.ParseForwarded(`for=1.1.1.1;for=2.2.2.2`)
+	assert.Error(t, err)
+}
+
+func TestClientIPForwarded(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Set("X-Forwarded-For", "30.30.30.30")
+	request.Header.Add("Forwarded", `for=1.1.1.1;proto=https;host=api.example.com`)
+	request.Header.Add("Forwarded", `for="[2001:db8::1]:4711";proto=http, for=10.0.0.5`)
+
+	p := httplog.NewProxy()
+	assert.Equal(t, "1.1.1.1", p.ClientIP(request))
+	e, ok := p.Forwarded(request)
+	assert.True(t, ok)
+	assert.Equal(t, "https", e.Proto)
+	assert.Equal(t, "api.example.com", e.Host)
+
+	assert.NoError(t, p.SetTrustedProxies([]string{"10.0.0.0/8"}))
+	assert.Equal(t, "2001:db8::1", p.ClientIP(request))
+	e, _ = p.Forwarded(request)
+	assert.Equal(t, "http", e.Proto)
+
+	// obfuscated client, fall back to the next header
+	request.Header.Set("Forwarded", `for=_hidden, for=10.0.0.5`)
+	assert.Equal(t, "30.30.30.30", p.ClientIP(request))
+
+	// malformed header is ignored
+	request.Header.Set("Forwarded", `for="1.1.1.1`)
+	assert.Equal(t, "30.30.30.30", p.ClientIP(request))
+	_, ok = p.Forwarded(request)
+	assert.False(t, ok)
+
+	// untrusted peer
+	request.Header.Set("Forwarded", `for=1.1.1.1;proto=https`)
+	request.RemoteAddr = "40.40.40.40:1234"
+	assert.Equal(t, "40.40.40.40", p.ClientIP(request))
+	_, ok = p.Forwarded(request)
+	assert.False(t, ok)
+}
+
+func TestLoggerForwardedProtoAndHost(t *testing.T) {
+	var gotParam httplog.LogFormatterParams
+	logger, _ := httplog.HandlerWithConfig(httplog.LoggerConfig{
+		Output: new(bytes.Buffer),
+		Formatter: func(param httplog.LogFormatterParams) string {
+			gotParam = param
+			return ""
+		},
+	}, http.NotFoundHandler())
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Forwarded", `for=1.1.1.1;proto=https;host=api.example.com`)
+	logger.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(t, "1.1.1.1", gotParam.ClientIP)
+	assert.Equal(t, "https", gotParam.ForwardedProto)
+	assert.Equal(t, "api.example.com", gotParam.ForwardedHost)
+}
@@ -0,0 +1,310 @@
+package geoip
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/MadAppGang/httplog/v2"
+)
+
+// Default config values
+const (
+	DefaultCacheSize      = 10000
+	DefaultReloadInterval = time.Minute
+)
+
+// Config configures GeoIP enricher
+type Config struct {
+	// Paths is a list of MaxMind .mmdb files, e.g. GeoLite2-City.mmdb and GeoLite2-ASN.mmdb.
+	// Results of all databases are merged, the first non empty value wins.
+	Paths []string
+
+	// CacheSize is the number of IPs in LRU cache.
+	// Default: 10000
+	CacheSize int
+
+	// ReloadInterval is how often files are checked for changes on disk.
+	// Negative value disables hot reload.
+	// Default: 1 minute
+	ReloadInterval time.Duration
+}
+
+// GeoIP looks up client location and network in local MaxMind databases
+type GeoIP struct {
+	conf Config
+
+	mu      sync.RWMutex
+	readers []*maxminddb.Reader
+	modTime []time.Time
+
+	cache *lruCache
+	done  chan struct{}
+	once  sync.Once
+}
+
+// record is a union of GeoLite2 City and ASN records
+type record struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// New opens databases and starts hot reload watcher, call Close to release resources
+func New(conf Config) (*GeoIP, error) {
+	if len(conf.Paths) == 0 {
+		return nil, errors.New("geoip: at least one database path is required")
+	}
+	if conf.CacheSize == 0 {
+		conf.CacheSize = DefaultCacheSize
+	}
+	if conf.ReloadInterval == 0 {
+		conf.ReloadInterval = DefaultReloadInterval
+	}
+
+	g := &GeoIP{
+		conf:    conf,
+		readers: make([]*maxminddb.Reader, len(conf.Paths)),
+		modTime: make([]time.Time, len(conf.Paths)),
+		cache:   newLRUCache(conf.CacheSize),
+		done:    make(chan struct{}),
+	}
+	for i := range conf.Paths {
+		if err := g.open(i); err != nil {
+			g.closeReaders()
+			return nil, err
+		}
+	}
+
+	if conf.ReloadInterval > 0 {
+		go g.watch()
+	}
+	return g, nil
+}
+
+// Enricher returns httplog.Enricher which sets LogFormatterParams.Geo
+func (g *GeoIP) Enricher() httplog.Enricher {
+	return func(param *httplog.LogFormatterParams) {
+		ip := net.ParseIP(param.ClientIP)
+		if ip == nil {
+			return
+		}
+		if info, err := g.Lookup(ip); err == nil && info != nil {
+			param.Geo = info
+		}
+	}
+}
+
+// Lookup returns location and network of ip, nil if ip is not found in databases.
+// Every call returns a new GeoInfo, so callers may change it.
+func (g *GeoIP) Lookup(ip net.IP) (*httplog.GeoInfo, error) {
+	key := ip.String()
+	if info, found, ok := g.cache.get(key); ok {
+		if !found {
+			return nil, nil
+		}
+		return &info, nil
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var info httplog.GeoInfo
+	found := false
+	for _, reader := range g.readers {
+		if reader == nil {
+			continue // closed
+		}
+		var rec record
+		_, ok, err := reader.LookupNetwork(ip, &rec)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		if info.CountryCode == "" {
+			info.CountryCode = rec.Country.ISOCode
+		}
+		if info.Country == "" {
+			info.Country = rec.Country.Names["en"]
+		}
+		if info.City == "" {
+			info.City = rec.City.Names["en"]
+		}
+		if info.ASN == 0 {
+			info.ASN = rec.ASN
+		}
+		if info.ASOrg == "" {
+			info.ASOrg = rec.ASOrg
+		}
+	}
+
+	g.cache.add(key, info, found)
+	if !found {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+// Close stops hot reload watcher and closes databases
+func (g *GeoIP) Close() error {
+	g.once.Do(func() {
+		close(g.done)
+	})
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closeReaders()
+}
+
+func (g *GeoIP) closeReaders() error {
+	var err error
+	for i, r := range g.readers {
+		if r != nil {
+			err = errors.Join(err, r.Close())
+			g.readers[i] = nil
+		}
+	}
+	return err
+}
+
+// open loads database i, replacing the current one.
+// The file is read into memory instead of mmap, so it could be safely overwritten on disk.
+func (g *GeoIP) open(i int) error {
+	path := g.conf.Paths[i]
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("geoip: %s: %w", path, err)
+	}
+
+	g.mu.Lock()
+	old := g.readers[i]
+	g.readers[i] = reader
+	g.modTime[i] = stat.ModTime()
+	g.mu.Unlock()
+
+	if old != nil {
+		_ = old.Close()
+	}
+	g.cache.purge()
+	return nil
+}
+
+func (g *GeoIP) watch() {
+	ticker := time.NewTicker(g.conf.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+			g.reloadChanged()
+		}
+	}
+}
+
+// reloadChanged reopens databases which were modified on disk,
+// the old database is kept if the new one is broken
+func (g *GeoIP) reloadChanged() {
+	for i, path := range g.conf.Paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		g.mu.RLock()
+		changed := !stat.ModTime().Equal(g.modTime[i])
+		g.mu.RUnlock()
+		if changed {
+			_ = g.open(i)
+		}
+	}
+}
+
+// lruCache is a tiny thread safe LRU cache for lookup results, nil results are cached as well
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+// lruEntry keeps GeoInfo by value, so lookups get copies and can't change cached info
+type lruEntry struct {
+	key   string
+	info  httplog.GeoInfo
+	found bool
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		items: make(map[string]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+func (c *lruCache) get(key string) (info httplog.GeoInfo, found, ok bool) {
+	if c.size <= 0 {
+		return info, false, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		entry := e.Value.(*lruEntry)
+		return entry.info, entry.found, true
+	}
+	return info, false, false
+}
+
+func (c *lruCache) add(key string, info httplog.GeoInfo, found bool) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		entry := e.Value.(*lruEntry)
+		entry.info, entry.found = info, found
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, info: info, found: found})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]*list.Element, c.size)
+	c.order.Init()
+}
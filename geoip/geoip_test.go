@@ -0,0 +1,141 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MadAppGang/httplog/v2"
+)
+
+const testDB = "testdata/test-city-asn.mmdb"
+
+func TestLookup(t *testing.T) {
+	g, err := New(Config{Paths: []string{testDB}, ReloadInterval: -1})
+	assert.NoError(t, err)
+	defer g.Close()
+
+	info, err := g.Lookup(net.ParseIP("81.2.69.142"))
+	assert.NoError(t, err)
+	assert.Equal(t, &httplog.GeoInfo{
+		CountryCode: "GB",
+		Country:     "United Kingdom",
+		City:        "London",
+		ASN:         20712,
+		ASOrg:       "Andrews & Arnold Ltd",
+	}, info)
+	assert.Equal(t, "🇬🇧", info.Flag())
+
+	info, err = g.Lookup(net.ParseIP("2001:db8:1::17"))
+	assert.NoError(t, err)
+	assert.Equal(t, "UA", info.CountryCode)
+	assert.Equal(t, "Kyiv", info.City)
+
+	info, err = g.Lookup(net.ParseIP("1.1.1.1"))
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+
+	// cached result
+	info, _ = g.Lookup(net.ParseIP("81.2.69.142"))
+	assert.Equal(t, "London", info.City)
+}
+
+func TestLookupReturnsCopies(t *testing.T) {
+	g, err := New(Config{Paths: []string{testDB}, ReloadInterval: -1})
+	assert.NoError(t, err)
+	defer g.Close()
+
+	first, err := g.Lookup(net.ParseIP("81.2.69.142"))
+	assert.NoError(t, err)
+	first.City = "changed by enricher"
+
+	second, err := g.Lookup(net.ParseIP("81.2.69.142"))
+	assert.NoError(t, err)
+	assert.Equal(t, "London", second.City)
+	assert.NotSame(t, first, second)
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+
+	_, err = New(Config{Paths: []string{"testdata/missing.mmdb"}})
+	assert.Error(t, err)
+
+	broken := filepath.Join(t.TempDir(), "broken.mmdb")
+	assert.NoError(t, os.WriteFile(broken, []byte("not a database"), 0o600))
+	_, err = New(Config{Paths: []string{broken}})
+	assert.Error(t, err)
+}
+
+func TestEnricher(t *testing.T) {
+	g, err := New(Config{Paths: []string{testDB}, ReloadInterval: -1})
+	assert.NoError(t, err)
+	defer g.Close()
+
+	param := httplog.LogFormatterParams{ClientIP: "89.160.20.112"}
+	g.Enricher()(&param)
+	assert.Equal(t, "SE", param.Geo.CountryCode)
+	assert.Equal(t, "Linköping", param.Geo.City)
+
+	param = httplog.LogFormatterParams{ClientIP: "not an ip"}
+	g.Enricher()(&param)
+	assert.Nil(t, param.Geo)
+}
+
+func TestHotReload(t *testing.T) {
+	data, err := os.ReadFile(testDB)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "db.mmdb")
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+
+	g, err := New(Config{Paths: []string{path}, ReloadInterval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer g.Close()
+
+	// broken file is ignored, the old database keeps working
+	assert.NoError(t, os.WriteFile(path, []byte("broken"), 0o600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+	time.Sleep(50 * time.Millisecond)
+	info, err := g.Lookup(net.ParseIP("203.0.113.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "AU", info.CountryCode)
+
+	// new database is picked up and cache is purged
+	g.cache.add("1.1.1.1", httplog.GeoInfo{CountryCode: "XX"}, true)
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Hour)))
+	assert.Eventually(t, func() bool {
+		info, _ := g.Lookup(net.ParseIP("1.1.1.1"))
+		return info == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+	c.add("a", httplog.GeoInfo{City: "A"}, true)
+	c.add("b", httplog.GeoInfo{City: "B"}, true)
+	_, _, _ = c.get("a")
+	c.add("c", httplog.GeoInfo{City: "C"}, true)
+
+	_, _, ok := c.get("b")
+	assert.False(t, ok)
+	info, found, ok := c.get("a")
+	assert.True(t, ok)
+	assert.True(t, found)
+	assert.Equal(t, "A", info.City)
+
+	c.add("d", httplog.GeoInfo{}, false)
+	_, found, ok = c.get("d")
+	assert.True(t, ok)
+	assert.False(t, found)
+
+	c.purge()
+	_, _, ok = c.get("a")
+	assert.False(t, ok)
+}
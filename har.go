@@ -0,0 +1,458 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR document parts, entries are written between them separated by commas
+const (
+	harPrefix = `{"log":{"version":"1.2","creator":{"name":"httplog","version":"2"},"pages":[],"entries":[`
+	harSuffix = "\n]}}\n"
+)
+
+// HAREncoder appends log entry as HTTP Archive 1.2 entry in a single line:
+// method, URL, headers, cookies, query, captured request and response bodies, status and timings.
+// Use it with HARRecorder to get HAR documents, which browser devtools, Charles or Insomnia can open.
+// Bodies are recorded only if CaptureRequestBody and CaptureResponseBody are enabled,
+// masked headers stay masked. Use it in a Raw sink, as HARRecorder.Sink does, so bodies are not sanitized.
+var HAREncoder Encoder = EncoderFunc(appendHAREntry)
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func appendHAREntry(buf []byte, p *LogFormatterParams) []byte {
+	proto := "HTTP/1.1"
+	requestSize := int64(-1)
+	if p.Request != nil {
+		proto = p.Request.Proto
+		requestSize = p.Request.ContentLength
+	}
+	// Path has the query scrubbed by ScrubPII, unlike the request URL
+	_, rawQuery, _ := strings.Cut(p.Path, "?")
+	if len(p.RequestBody) > 0 {
+		requestSize = int64(len(p.RequestBody))
+	}
+
+	// wait is time to the first response byte, receive is the rest of the response
+	wait := p.Latency
+	if p.TTFB > 0 {
+		wait = p.TTFB
+	}
+
+	e := harEntry{
+		StartedDateTime: p.TimeStamp.Add(-p.Latency).Format(time.RFC3339Nano),
+		Time:            harMilliseconds(p.Latency),
+		Request: harRequest{
+			Method:      p.Method,
+			URL:         requestURL(p),
+			HTTPVersion: proto,
+			Cookies:     harCookies((&http.Request{Header: p.RequestHeader}).Cookies()),
+			Headers:     harHeaders(p.RequestHeader),
+			QueryString: harQuery(rawQuery),
+			HeadersSize: -1,
+			BodySize:    requestSize,
+		},
+		Response: harResponse{
+			Status:      p.StatusCode,
+			StatusText:  http.StatusText(p.StatusCode),
+			HTTPVersion: proto,
+			Cookies:     harCookies((&http.Response{Header: p.ResponseHeader}).Cookies()),
+			Headers:     harHeaders(p.ResponseHeader),
+			Content: harContent{
+				Size:     int64(p.BodySize),
+				MimeType: headerValue(p.ResponseHeader, "Content-Type"),
+			},
+			RedirectURL: headerValue(p.ResponseHeader, "Location"),
+			HeadersSize: -1,
+			BodySize:    int64(p.BodySize),
+		},
+		Timings: harTimings{
+			Wait:    harMilliseconds(wait),
+			Receive: harMilliseconds(p.Latency - wait),
+		},
+	}
+	if len(p.RequestBody) > 0 {
+		e.Request.PostData = &harPostData{
+			MimeType: headerValue(p.RequestHeader, "Content-Type"),
+			Text:     string(p.RequestBody),
+		}
+	}
+	if len(p.ResponseBody) > 0 {
+		if utf8.Valid(p.ResponseBody) {
+			e.Response.Content.Text = string(p.ResponseBody)
+		} else {
+			e.Response.Content.Text = base64.StdEncoding.EncodeToString(p.ResponseBody)
+			e.Response.Content.Encoding = "base64"
+		}
+	}
+	if p.Error != nil {
+		e.Comment = p.Error.Error()
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		// all fields are strings and numbers, it never happens
+		return buf
+	}
+	buf = append(buf, b...)
+	return append(buf, '\n')
+}
+
+func harMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// harHeaders returns headers sorted by name, so entries are stable
+func harHeaders(h http.Header) []harNameValue {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	headers := []harNameValue{}
+	for _, k := range keys {
+		for _, v := range h[k] {
+			headers = append(headers, harNameValue{Name: k, Value: v})
+		}
+	}
+	return headers
+}
+
+// harQuery returns query parameters in the request order
+func harQuery(rawQuery string) []harNameValue {
+	query := []harNameValue{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		query = append(query, harNameValue{Name: name, Value: value})
+	}
+	return query
+}
+
+func harCookies(cookies []*http.Cookie) []harCookie {
+	result := make([]harCookie, len(cookies))
+	for i, c := range cookies {
+		result[i] = harCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			result[i].Expires = c.Expires.Format(time.RFC3339)
+		}
+	}
+	return result
+}
+
+// HAROptions configures HARRecorder
+type HAROptions struct {
+	// Path is the .har file entries are streamed to. The file is a valid HAR document after every entry,
+	// so it could be opened while the server is running. Existing file is rotated on start.
+	// Optional. Default: entries are kept in memory only.
+	Path string
+
+	// MaxFileSize rotates the file when it would grow over the size in bytes:
+	// traffic.har is renamed to traffic.1.har, traffic.1.har to traffic.2.har and so on.
+	// Default: 0 (no rotation)
+	MaxFileSize int64
+
+	// MaxBackups is the number of rotated files kept, the oldest are removed.
+	// Default: 0 (keep all)
+	MaxBackups int
+
+	// MaxEntries is the number of the last entries kept in memory for WriteTo and ServeHTTP.
+	// Default: 1000 if Path is empty, 0 otherwise.
+	MaxEntries int
+}
+
+// HARRecorder records log entries as HTTP Archive 1.2, streaming them to a rolling file
+// and/or keeping the last of them in memory to download on demand:
+//
+//	har, _ := httplog.NewHARRecorder(httplog.HAROptions{Path: "traffic.har"})
+//	defer har.Close()
+//	logger, _ := httplog.LoggerWithConfig(httplog.LoggerConfig{
+//	    CaptureRequestBody:  true,
+//	    CaptureResponseBody: true,
+//	    Sinks: []httplog.Sink{{Output: os.Stdout}, har.Sink()},
+//	})
+//
+// HARRecorder is an io.Writer of HAREncoder entries, every Write must be a single entry.
+type HARRecorder struct {
+	opts HAROptions
+
+	mu sync.Mutex
+	// entries is the ring buffer of the last entries, next is the index of the oldest one when it is full
+	entries [][]byte
+	next    int
+	file    *os.File
+	// end is the offset of harSuffix in the file
+	end         int64
+	fileEntries int
+}
+
+// NewHARRecorder creates HARRecorder, it opens the file if HAROptions.Path is set
+func NewHARRecorder(opts HAROptions) (*HARRecorder, error) {
+	if opts.MaxEntries == 0 && opts.Path == "" {
+		opts.MaxEntries = 1000
+	}
+	r := &HARRecorder{opts: opts}
+	if opts.Path != "" {
+		if err := r.openFile(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Sink returns sink writing HAREncoder entries to the recorder, use it in LoggerConfig.Sinks.
+// The sink is Raw: bodies and headers are not sanitized, so binary content is recorded as base64.
+func (r *HARRecorder) Sink() Sink {
+	return Sink{
+		Name:      "har",
+		Encoder:   HAREncoder,
+		Output:    r,
+		ColorMode: ColorDisable,
+		Raw:       true,
+	}
+}
+
+// Write records a single HAREncoder entry
+func (r *HARRecorder) Write(entry []byte) (int, error) {
+	n := len(entry)
+	// buffer is reused by the sink
+	entry = bytes.Clone(bytes.TrimSpace(entry))
+	if len(entry) == 0 {
+		return n, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.opts.MaxEntries > 0 {
+		if len(r.entries) < r.opts.MaxEntries {
+			r.entries = append(r.entries, entry)
+		} else {
+			r.entries[r.next] = entry
+			r.next = (r.next + 1) % len(r.entries)
+		}
+	}
+	if r.file != nil {
+		if err := r.writeFile(entry); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// WriteTo writes HAR document with the entries kept in memory to w
+func (r *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	doc := make([]byte, 0, len(harPrefix)+len(harSuffix))
+	doc = append(doc, harPrefix...)
+	for i := range r.entries {
+		if i > 0 {
+			doc = append(doc, ',')
+		}
+		doc = append(doc, '\n')
+		doc = append(doc, r.entries[(r.next+i)%len(r.entries)]...)
+	}
+	doc = append(doc, harSuffix...)
+	r.mu.Unlock()
+
+	n, err := w.Write(doc)
+	return int64(n), err
+}
+
+// ServeHTTP downloads HAR document with the entries kept in memory,
+// mount it on a dev server and open the file in browser devtools
+func (r *HARRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="httplog.har"`)
+	_, _ = r.WriteTo(w)
+}
+
+// Close closes the file, entries written after Close are kept in memory only
+func (r *HARRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// writeFile writes entry with the document end over the previous end, so the file stays valid
+func (r *HARRecorder) writeFile(entry []byte) error {
+	sep := "\n"
+	if r.fileEntries > 0 {
+		sep = ",\n"
+	}
+	size := r.end + int64(len(sep)+len(entry)+len(harSuffix))
+	if r.opts.MaxFileSize > 0 && r.fileEntries > 0 && size > r.opts.MaxFileSize {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.file = nil
+		if err := r.openFile(); err != nil {
+			return err
+		}
+		sep = "\n"
+	}
+
+	data := make([]byte, 0, len(sep)+len(entry)+len(harSuffix))
+	data = append(data, sep...)
+	data = append(data, entry...)
+	data = append(data, harSuffix...)
+	if _, err := r.file.WriteAt(data, r.end); err != nil {
+		return err
+	}
+	r.end += int64(len(sep) + len(entry))
+	r.fileEntries++
+	return nil
+}
+
+// openFile rotates existing file and creates the new one with empty document
+func (r *HARRecorder) openFile() error {
+	if info, err := os.Stat(r.opts.Path); err == nil && info.Size() > 0 {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(r.opts.Path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(harPrefix + harSuffix); err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.end = int64(len(harPrefix))
+	r.fileEntries = 0
+	return nil
+}
+
+// rotate shifts backups by one and renames the file to the first backup
+func (r *HARRecorder) rotate() error {
+	backups := 0
+	for {
+		if _, err := os.Stat(r.backupName(backups + 1)); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		backups++
+	}
+	if r.opts.MaxBackups > 0 {
+		for ; backups >= r.opts.MaxBackups; backups-- {
+			if err := os.Remove(r.backupName(backups)); err != nil {
+				return err
+			}
+		}
+	}
+	for i := backups; i > 0; i-- {
+		if err := os.Rename(r.backupName(i), r.backupName(i+1)); err != nil {
+			return err
+		}
+	}
+	return os.Rename(r.opts.Path, r.backupName(1))
+}
+
+// backupName returns name of i-th backup: traffic.har -> traffic.1.har
+func (r *HARRecorder) backupName(i int) string {
+	ext := filepath.Ext(r.opts.Path)
+	return strings.TrimSuffix(r.opts.Path, ext) + "." + strconv.Itoa(i) + ext
+}
@@ -0,0 +1,261 @@
+package httplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type harDocument struct {
+	Log struct {
+		Version string     `json:"version"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+func parseHAR(t *testing.T, data []byte) harDocument {
+	t.Helper()
+	var doc harDocument
+	assert.NoError(t, json.Unmarshal(data, &doc), string(data))
+	assert.Equal(t, "1.2", doc.Log.Version)
+	return doc
+}
+
+func TestHAREncoder(t *testing.T) {
+	r := httptest.NewRequest("POST", "http://example.com/api/users?page=2&q=a%20b", nil)
+	p := &LogFormatterParams{
+		Request:   r,
+		Method:    "POST",
+		Path:      "/api/users?page=2&q=a%20b",
+		FullURL:   "https://api.example.com/api/users?page=2&q=a%20b",
+		TimeStamp: time.Date(2024, 3, 1, 12, 0, 1, 0, time.UTC),
+		Latency:   1500 * time.Millisecond,
+		TTFB:      time.Second,
+		RequestHeader: http.Header{
+			"Content-Type":  {"application/json"},
+			"Cookie":        {"session=abc; theme=dark"},
+			"Authorization": {"***"},
+		},
+		RequestBody:    []byte(`{"name":"Jack"}`),
+		StatusCode:     201,
+		ResponseHeader: http.Header{"Content-Type": {"text/plain"}, "Set-Cookie": {"id=1; Path=/; HttpOnly"}},
+		ResponseBody:   []byte("created"),
+		BodySize:       7,
+		Error:          errors.New("client went away"),
+	}
+
+	line := HAREncoder.Encode(nil, p)
+	assert.Equal(t, byte('\n'), line[len(line)-1])
+	assert.Equal(t, 1, bytes.Count(line, []byte("\n")))
+
+	var e harEntry
+	assert.NoError(t, json.Unmarshal(line, &e))
+	assert.Equal(t, "2024-03-01T11:59:59.5Z", e.StartedDateTime)
+	assert.Equal(t, 1500.0, e.Time)
+	assert.Equal(t, harTimings{Wait: 1000, Receive: 500}, e.Timings)
+	assert.Equal(t, "client went away", e.Comment)
+
+	assert.Equal(t, "POST", e.Request.Method)
+	assert.Equal(t, "https://api.example.com/api/users?page=2&q=a%20b", e.Request.URL)
+	assert.Equal(t, "HTTP/1.1", e.Request.HTTPVersion)
+	assert.Equal(t, []harNameValue{{"page", "2"}, {"q", "a b"}}, e.Request.QueryString)
+	assert.Equal(t, []harNameValue{
+		{"Authorization", "***"},
+		{"Content-Type", "application/json"},
+		{"Cookie", "session=abc; theme=dark"},
+	}, e.Request.Headers)
+	assert.Equal(t, []harCookie{{Name: "session", Value: "abc"}, {Name: "theme", Value: "dark"}}, e.Request.Cookies)
+	assert.Equal(t, &harPostData{MimeType: "application/json", Text: `{"name":"Jack"}`}, e.Request.PostData)
+	assert.Equal(t, int64(15), e.Request.BodySize)
+
+	assert.Equal(t, 201, e.Response.Status)
+	assert.Equal(t, "Created", e.Response.StatusText)
+	assert.Equal(t, harContent{Size: 7, MimeType: "text/plain", Text: "created"}, e.Response.Content)
+	assert.Equal(t, []harCookie{{Name: "id", Value: "1", Path: "/", HTTPOnly: true}}, e.Response.Cookies)
+	assert.Equal(t, -1, e.Response.HeadersSize)
+
+	// binary bodies are base64 encoded, URL is built from the request without FullURL
+	p.FullURL = ""
+	p.ResponseBody = []byte{0xff, 0x00}
+	e = harEntry{}
+	assert.NoError(t, json.Unmarshal(HAREncoder.Encode(nil, p), &e))
+	assert.Equal(t, "http://example.com/api/users?page=2&q=a%20b", e.Request.URL)
+	assert.Equal(t, harContent{Size: 7, MimeType: "text/plain", Text: "/wA=", Encoding: "base64"}, e.Response.Content)
+}
+
+func TestHARRecorderMemory(t *testing.T) {
+	har, err := NewHARRecorder(HAROptions{MaxEntries: 2})
+	assert.NoError(t, err)
+
+	logger, err := LoggerWithConfig(LoggerConfig{
+		CaptureRequestBody:  true,
+		CaptureResponseBody: true,
+		Sinks:               []Sink{har.Sink()},
+	})
+	assert.NoError(t, err)
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	for _, path := range []string{"/first", "/second", "/third"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", path, strings.NewReader("body of "+path)))
+	}
+
+	// the last entries are kept in order
+	var buf bytes.Buffer
+	_, err = har.WriteTo(&buf)
+	assert.NoError(t, err)
+	doc := parseHAR(t, buf.Bytes())
+	assert.Len(t, doc.Log.Entries, 2)
+	assert.Equal(t, "http://example.com/second", doc.Log.Entries[0].Request.URL)
+	assert.Equal(t, "http://example.com/third", doc.Log.Entries[1].Request.URL)
+	assert.Equal(t, "body of /third", doc.Log.Entries[1].Request.PostData.Text)
+	assert.Equal(t, `{"ok":true}`, doc.Log.Entries[1].Response.Content.Text)
+	assert.Equal(t, "application/json", doc.Log.Entries[1].Response.Content.MimeType)
+
+	// download on demand
+	w := httptest.NewRecorder()
+	har.ServeHTTP(w, httptest.NewRequest("GET", "/debug/har", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "httplog.har")
+	assert.Equal(t, buf.String(), w.Body.String())
+}
+
+func TestHARRecorderScrubsQuery(t *testing.T) {
+	har, err := NewHARRecorder(HAROptions{})
+	assert.NoError(t, err)
+	logger, err := LoggerWithConfig(LoggerConfig{ScrubPII: true, Sinks: []Sink{har.Sink()}})
+	assert.NoError(t, err)
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/search?email=jack@example.com&page=2", nil))
+
+	var buf bytes.Buffer
+	_, err = har.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "jack@example.com")
+	e := parseHAR(t, buf.Bytes()).Log.Entries[0]
+	assert.Contains(t, e.Request.URL, "page=2")
+	assert.Len(t, e.Request.QueryString, 2)
+	assert.Equal(t, harNameValue{Name: "page", Value: "2"}, e.Request.QueryString[1])
+}
+
+func TestHARRecorderBinaryBody(t *testing.T) {
+	har, err := NewHARRecorder(HAROptions{})
+	assert.NoError(t, err)
+	out := new(bytes.Buffer)
+	logger, err := LoggerWithConfig(LoggerConfig{
+		CaptureResponseBody: true,
+		Sinks:               []Sink{{Output: out, Encoder: FormatterEncoder(ResponseBodyLogFormatter)}, har.Sink()},
+	})
+	assert.NoError(t, err)
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\xff")
+	gzipped := []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff")
+	for _, tt := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"image/png", png},
+		{"application/gzip", gzipped},
+	} {
+		handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			_, _ = w.Write(tt.body)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/file", nil))
+	}
+
+	var buf bytes.Buffer
+	_, err = har.WriteTo(&buf)
+	assert.NoError(t, err)
+	entries := parseHAR(t, buf.Bytes()).Log.Entries
+	assert.Len(t, entries, 2)
+	assert.Equal(t, harContent{Size: int64(len(png)), MimeType: "image/png", Text: "iVBORw0KGgoA/w==", Encoding: "base64"}, entries[0].Response.Content)
+	assert.Equal(t, "base64", entries[1].Response.Content.Encoding)
+
+	// other sinks still get sanitized bodies
+	assert.Contains(t, out.String(), `\x89PNG\r`)
+}
+
+func TestHARRecorderEmpty(t *testing.T) {
+	har, err := NewHARRecorder(HAROptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, har.opts.MaxEntries)
+
+	var buf bytes.Buffer
+	_, err = har.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Empty(t, parseHAR(t, buf.Bytes()).Log.Entries)
+}
+
+func TestHARRecorderFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.har")
+	assert.NoError(t, os.WriteFile(path, []byte("previous run"), 0o644))
+
+	har, err := NewHARRecorder(HAROptions{Path: path})
+	assert.NoError(t, err)
+	defer har.Close()
+	assert.Zero(t, har.opts.MaxEntries)
+
+	// existing file is rotated on start
+	previous, err := os.ReadFile(filepath.Join(filepath.Dir(path), "traffic.1.har"))
+	assert.NoError(t, err)
+	assert.Equal(t, "previous run", string(previous))
+
+	sink := newSinkWriter(har.Sink())
+	for i, p := range []string{"/a", "/b", "/c"} {
+		sink.write(nil, &LogFormatterParams{Method: "GET", Path: p, StatusCode: 200})
+
+		// the file is a valid document after every entry
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		doc := parseHAR(t, data)
+		assert.Len(t, doc.Log.Entries, i+1)
+		assert.Equal(t, p, doc.Log.Entries[i].Request.URL)
+	}
+}
+
+func TestHARRecorderRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "traffic.har")
+	entry := HAREncoder.Encode(nil, &LogFormatterParams{Method: "GET", Path: "/", StatusCode: 200})
+
+	// two entries fit in a file
+	har, err := NewHARRecorder(HAROptions{
+		Path:        path,
+		MaxFileSize: int64(len(harPrefix)+len(harSuffix)+2*len(entry)) + 1,
+		MaxBackups:  2,
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		_, err := har.Write(entry)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, har.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.har"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "traffic.1.har"),
+		filepath.Join(dir, "traffic.2.har"),
+		filepath.Join(dir, "traffic.har"),
+	}, files)
+	for name, want := range map[string]int{"traffic.har": 1, "traffic.1.har": 2, "traffic.2.har": 2} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Len(t, parseHAR(t, data).Log.Entries, want, name)
+	}
+
+	// entries written after Close are kept in memory only
+	_, err = har.Write(entry)
+	assert.NoError(t, err)
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -28,7 +29,7 @@ const (
 type ColorMode int
 
 const (
-	// ColorAuto detects if output is a terminal
+	// ColorAuto enables colors if output is a terminal, it doesn't choose color depth
 	ColorAuto ColorMode = iota
 
 	// ColorDisable forces colors off
@@ -86,31 +87,128 @@ func (l Level) String() string {
 // LoggerConfig defines the config for Logger middleware.
 type LoggerConfig struct {
 	// ColorMode controls color output behavior
-	// Default: ColorAuto (detect terminal)
+	// Default: ColorAuto (detect terminal, honoring NO_COLOR, FORCE_COLOR and CLICOLOR_FORCE; NO_COLOR wins)
 	ColorMode ColorMode
 
+	// Theme is the colors of formatters, e.g. httplog.LightTheme(httplog.DetectColorDepth()).
+	// Optional. Default value is httplog.DefaultTheme
+	Theme *Theme
+
 	// Optional. Default value is httplog.DefaultLogFormatter
 	Formatter LogFormatter
 
+	// Encoder appends log entries to pooled buffers, without intermediate strings.
+	// It takes precedence over Pattern, Template and Formatter.
+	// Optional. Default value is httplog.DefaultEncoder
+	Encoder Encoder
+
+	// Pattern is Apache mod_log_config style layout, e.g. `%h %t "%r" %>s %b %D "%{User-Agent}i"`,
+	// see NewPatternEncoder for directives. It takes precedence over Template and Formatter.
+	// Optional.
+	Pattern string
+
+	// Template is text/template layout, e.g. `{{.Method}} {{.Path}} {{humanize .Latency}}`,
+	// see NewTemplateEncoder for helpers. It takes precedence over Formatter.
+	// Optional.
+	Template string
+
 	// Output is a writer where logs are written.
 	// Optional. Default value is httplog.DefaultWriter.
 	Output io.Writer
 
+	// Sinks is a list of log destinations, each with its own encoder, output, color mode,
+	// MinLevel and sampling. Every entry is written to all sinks which accept it.
+	// Formatter, Encoder, Pattern, Template, Output, ColorMode and Theme are set per sink,
+	// ValidateConfig returns error if any of them is set together with Sinks.
+	// Optional.
+	Sinks []Sink
+
 	// SkipPaths is an url path array which logs are not written.
 	// Could be a regexp like: /user/payment/*
 	// Optional.
 	SkipPaths []string
 
+	// SkipMethods is a list of HTTP methods which requests are not logged, e.g. OPTIONS.
+	// Optional.
+	SkipMethods []string
+
+	// SkipHosts is a request host array which logs are not written.
+	// Could be a regexp like: ^internal\.
+	// Optional.
+	SkipHosts []string
+
+	// SkipHeaders is a map of request header name to value regexp, requests with a matching header are not logged.
+	// Use ".*" to skip requests where header is present.
+	// Optional.
+	SkipHeaders map[string]string
+
+	// SkipFunc is called for every request, requests are not logged when it returns true.
+	// Skip checks (SkipFunc, SkipPaths, SkipMethods, SkipHosts, SkipHeaders, SkipUserAgents)
+	// run before the handler and before any body capture, so skipped requests cost nothing.
+	// Optional.
+	SkipFunc func(r *http.Request) bool
+
+	// DropFunc is called after the response, when LogFormatterParams are ready.
+	// The log entry is dropped when it returns true, use it for outcome based filtering,
+	// e.g. to drop fast successful responses.
+	// Optional.
+	DropFunc func(param LogFormatterParams) bool
+
+	// SkipUserAgents is a list of client classes which requests are not logged,
+	// e.g. httplog.BotUserAgents to drop health checks, uptime monitors and crawlers.
+	// Optional.
+	SkipUserAgents []UserAgentClass
+
+	// DebugUserAgents is a list of client classes which successful requests are logged with LevelDebug,
+	// so they could be hidden with MinLevel. Failed requests keep their level.
+	// Optional.
+	DebugUserAgents []UserAgentClass
+
 	// HideHeader is a header keys array which value should be masked with ****.
 	// Optional.
 	HideHeaderKeys []string
 
+	// ScrubPII enables automatic detection and masking of values that look like PII
+	// (emails, card numbers, IBANs, phones, JWTs, AWS keys, private keys)
+	// in captured bodies, headers and query strings.
+	// Default: false
+	ScrubPII bool
+
+	// PIIDetectors is a list of detectors used when ScrubPII is enabled.
+	// You can mix built-in detectors with your own.
+	// Optional. Default value is httplog.DefaultPIIDetectors
+	PIIDetectors []PIIDetector
+
+	// Sanitize controls escaping of control characters, CR/LF and terminal escape sequences
+	// in user-controlled fields (path, headers, text bodies, error, string Fields, parsed User-Agent) before formatting,
+	// so clients can't inject fake log lines or ANSI sequences.
+	// Use SanitizeStrict for file and syslog outputs.
+	// Default: SanitizeEscape
+	Sanitize SanitizeMode
+
 	// ProxyHandler is a instance of Proxy struct with could get remote IP using proxy data
 	// Default is default httplog.NewLogger()
 	// If you run you instance on Google App engine or Cloudflare,
 	// you need to create explicit Proxy instance with httplog.NewLoggerWithType(...)
 	ProxyHandler *Proxy
 
+	// TrustedProxies is a list of proxy networks (CIDR or single IP) the client IP headers are accepted from.
+	// When set, X-Forwarded-For like headers are honored only if Request.RemoteAddr is trusted,
+	// so clients can't spoof their IP. The list is applied to a copy of ProxyHandler.
+	// Optional. Default: every peer is trusted
+	TrustedProxies []string
+
+	// IPAnonymization anonymizes client IPs after Proxy.ClientIP:
+	// truncation, keyed hash pseudonymization or full removal.
+	// It is applied to ClientIP and to IPs in proxy headers of RequestHeader.
+	// Default: IPAnonymizeNone
+	IPAnonymization IPAnonymization
+
+	// Enrichers add extra data to LogFormatterParams before formatting, e.g. GeoIP lookup.
+	// They are called in order, with the real client IP (before IPAnonymization).
+	// Optional.
+	Enrichers []Enricher
+
 	// Router prints router name in the log.
 	// If you have more than one router it is useful to get one's name in a console output.
 	RouterName string
@@ -164,6 +262,10 @@ type LoggerConfig struct {
 // or you can create your custom
 type LogFormatter func(params LogFormatterParams) string
 
+// Enricher adds extra data to LogFormatterParams before formatting.
+// Params are pooled, so the pointer must not be kept after the call.
+type Enricher func(param *LogFormatterParams)
+
 // ValidateConfig validates LoggerConfig before middleware creation
 // Returns detailed error if invalid, nil if valid
 func ValidateConfig(conf LoggerConfig) error {
@@ -174,6 +276,23 @@ func ValidateConfig(conf LoggerConfig) error {
 		}
 	}
 
+	// Validate SkipHosts regexes
+	for i, pattern := range conf.SkipHosts {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid SkipHosts[%d] regex pattern '%s': %w", i, pattern, err)
+		}
+	}
+
+	// Validate SkipHeaders regexes
+	for name, pattern := range conf.SkipHeaders {
+		if name == "" {
+			return fmt.Errorf("invalid SkipHeaders: empty header name")
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid SkipHeaders[%s] regex pattern '%s': %w", name, pattern, err)
+		}
+	}
+
 	// Validate HideHeaderKeys regexes
 	for i, pattern := range conf.HideHeaderKeys {
 		if _, err := regexp.Compile(pattern); err != nil {
@@ -181,11 +300,94 @@ func ValidateConfig(conf LoggerConfig) error {
 		}
 	}
 
+	// Validate user agent classes
+	for i, class := range conf.SkipUserAgents {
+		if !validUserAgentClass(class) {
+			return fmt.Errorf("invalid SkipUserAgents[%d]: unknown class '%s'", i, class)
+		}
+	}
+	for i, class := range conf.DebugUserAgents {
+		if !validUserAgentClass(class) {
+			return fmt.Errorf("invalid DebugUserAgents[%d]: unknown class '%s'", i, class)
+		}
+	}
+
+	// Validate TrustedProxies
+	if _, err := parseCIDRs(conf.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid TrustedProxies: %w", err)
+	}
+	if p := conf.ProxyHandler; p != nil && p.needsTrustedProxies && p.trustedCIDRs == nil && conf.TrustedProxies == nil {
+		return fmt.Errorf("invalid ProxyHandler: %s header could be spoofed by any client, set TrustedProxies", p.ptype)
+	}
+
+	// Validate IPAnonymization
+	ipa := conf.IPAnonymization
+	if ipa.Mode < IPAnonymizeNone || ipa.Mode > IPAnonymizeRemove {
+		return fmt.Errorf("invalid IPAnonymization.Mode: %d", ipa.Mode)
+	}
+	if ipa.IPv4PrefixLen < 0 || ipa.IPv4PrefixLen > 32 {
+		return fmt.Errorf("invalid IPAnonymization.IPv4PrefixLen: %d (must be between 0 and 32)", ipa.IPv4PrefixLen)
+	}
+	if ipa.IPv6PrefixLen < 0 || ipa.IPv6PrefixLen > 128 {
+		return fmt.Errorf("invalid IPAnonymization.IPv6PrefixLen: %d (must be between 0 and 128)", ipa.IPv6PrefixLen)
+	}
+	if ipa.SaltRotation < 0 {
+		return fmt.Errorf("invalid IPAnonymization.SaltRotation: %v (cannot be negative)", ipa.SaltRotation)
+	}
+
+	// Validate PIIDetectors
+	for i, d := range conf.PIIDetectors {
+		if d.Name == "" || d.Pattern == nil {
+			return fmt.Errorf("invalid PIIDetectors[%d]: Name and Pattern are required", i)
+		}
+	}
+
 	// Validate SampleRate
 	if conf.SampleRate != -1 && (conf.SampleRate < 0.0 || conf.SampleRate > 1.0) {
 		return fmt.Errorf("invalid SampleRate: %f (must be -1 for default, or between 0.0 and 1.0)", conf.SampleRate)
 	}
 
+	// Validate Pattern and Template
+	if conf.Pattern != "" && conf.Template != "" {
+		return fmt.Errorf("invalid Pattern: can't be used together with Template")
+	}
+	if conf.Pattern != "" {
+		if _, err := parsePattern(conf.Pattern); err != nil {
+			return fmt.Errorf("invalid Pattern '%s': %w", conf.Pattern, err)
+		}
+	}
+	if conf.Template != "" {
+		if _, err := NewTemplateEncoder(conf.Template); err != nil {
+			return fmt.Errorf("invalid Template: %w", err)
+		}
+	}
+
+	// Validate Sinks
+	if len(conf.Sinks) > 0 {
+		conflicts := []struct {
+			name string
+			set  bool
+		}{
+			{"Formatter", conf.Formatter != nil},
+			{"Encoder", conf.Encoder != nil},
+			{"Pattern", conf.Pattern != ""},
+			{"Template", conf.Template != ""},
+			{"Output", conf.Output != nil},
+			{"ColorMode", conf.ColorMode != ColorAuto},
+			{"Theme", conf.Theme != nil},
+		}
+		for _, c := range conflicts {
+			if c.set {
+				return fmt.Errorf("invalid Sinks: %s is set per sink, it can't be used with Sinks", c.name)
+			}
+		}
+	}
+	for i, s := range conf.Sinks {
+		if s.SampleRate < 0.0 || s.SampleRate > 1.0 {
+			return fmt.Errorf("invalid Sinks[%d].SampleRate: %f (must be between 0.0 and 1.0)", i, s.SampleRate)
+		}
+	}
+
 	// Validate AsyncBufferSize - only reject negative values
 	if conf.AsyncBufferSize < 0 {
 		return fmt.Errorf("invalid AsyncBufferSize: %d (cannot be negative)", conf.AsyncBufferSize)
@@ -212,69 +414,172 @@ type LogFormatterParams struct {
 	Latency time.Duration
 	// ClientIP calculated real IP of requester, see Proxy for details.
 	ClientIP string
+	// ForwardedProto is the original protocol from RFC 7239 Forwarded header, if present.
+	ForwardedProto string
+	// ForwardedHost is the original host from RFC 7239 Forwarded header, if present.
+	ForwardedHost string
 	// Method is the HTTP method given to the request.
 	Method string
 	// Path is a path the client requests.
 	Path string
+	// Scheme is the original scheme the client requested, reconstructed from trusted proxy headers.
+	Scheme string
+	// Host is the original host the client requested, reconstructed from trusted proxy headers.
+	Host string
+	// FullURL is the original URL the client requested: Scheme, Host and Path.
+	FullURL string
+	// forwardedOrigin is true if Scheme or Host came from trusted proxy headers (private)
+	forwardedOrigin bool
 	// colorMode is the color mode for this logger (private)
 	colorMode ColorMode
+	// theme is the colors for this logger (private), see Theme()
+	theme *Theme
+	// matched is set by When formatters of the enclosing chain for Else (private),
+	// ChainEncoder points it to chainMatched, so it doesn't allocate
+	matched      *bool
+	chainMatched bool
 	// BodySize is the size of the Response Body
 	BodySize int
 	// ResponseBody is the response body content (if captured)
 	ResponseBody []byte
 	// RequestBody is the request body content (if captured)
 	RequestBody []byte
-	// Response header
+	// Response header (masked if configured).
+	// It is shared with the response when nothing is masked, formatters must not modify it.
 	ResponseHeader http.Header
-	// RequestHeader are the request headers (masked if configured)
+	// RequestHeader are the request headers (masked if configured).
+	// It is shared with the request when nothing is masked, formatters must not modify it.
 	RequestHeader http.Header
 	// Level is the log level for this request
 	Level Level
+	// Geo is the client location and network (if GeoIP enricher is configured)
+	Geo *GeoInfo
+	// UserAgent is the parsed User-Agent header (if UserAgentEnricher or user agent filters are configured)
+	UserAgent *UserAgentInfo
+	// TTFB is time to first byte: from the request start to the first WriteHeader or Write of the handler,
+	// 0 if nothing was written. Latency - TTFB is the time spent sending the response to the client.
+	TTFB time.Duration
+	// Flushes is the number of response flushes, non zero for streaming responses
+	Flushes int
+	// Informational is 1xx status codes sent before the final response, e.g. 103 Early Hints
+	Informational []int
+	// Trailer is HTTP trailers sent after the response body (masked if configured)
+	Trailer http.Header
+	// ClientCanceled is true when the client went away before the response was completed,
+	// StatusCode is set to StatusClientClosedRequest (499) in this case
+	ClientCanceled bool
+	// Error is why the request didn't complete normally: response write error,
+	// request context cancellation or deadline, request body read error like *http.MaxBytesError
+	Error error
+	// BytesExpected is the response Content-Length, 0 if unknown
+	BytesExpected int64
+	// BytesWritten is the number of response body bytes written to the client
+	BytesWritten int64
+	// Redactions is the number of PII values masked per detector name (if ScrubPII enabled)
+	Redactions map[string]int
+	// Fields are extra key-value pairs added by enrichers,
+	// written by JSON, logfmt, slog and zap formatters
+	Fields []Field
+}
+
+// Field is an extra key-value pair of log entry
+type Field struct {
+	Key   string
+	Value any
+}
+
+// AddField attaches an extra key-value pair to the log entry, use it in Enricher
+func (p *LogFormatterParams) AddField(key string, value any) {
+	p.Fields = append(p.Fields, Field{Key: key, Value: value})
+}
+
+// GeoInfo is the client location and network, see github.com/MadAppGang/httplog/v2/geoip
+type GeoInfo struct {
+	// CountryCode is ISO 3166-1 country code, e.g. "GB"
+	CountryCode string
+	// Country is the country name in English
+	Country string
+	// City is the city name in English
+	City string
+	// ASN is the autonomous system number
+	ASN uint
+	// ASOrg is the autonomous system organization
+	ASOrg string
+}
+
+// Flag returns country flag emoji, empty string if country code is unknown
+func (g *GeoInfo) Flag() string {
+	if len(g.CountryCode) != 2 {
+		return ""
+	}
+	var flag []rune
+	for _, c := range strings.ToUpper(g.CountryCode) {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		flag = append(flag, 0x1F1E6+c-'A')
+	}
+	return string(flag)
+}
+
+// Theme returns the colors of the logger, httplog.DefaultTheme if it is not set.
+func (p *LogFormatterParams) Theme() *Theme {
+	if p.theme == nil {
+		return DefaultTheme
+	}
+	return p.theme
 }
 
 // StatusCodeColor is the ANSI color for appropriately logging http status code to a terminal.
 func (p *LogFormatterParams) StatusCodeColor() string {
 	code := p.StatusCode
+	theme := p.Theme()
 
 	switch {
 	case code >= http.StatusOK && code < http.StatusMultipleChoices:
-		return green
+		return theme.Status2xx
 	case code >= http.StatusMultipleChoices && code < http.StatusBadRequest:
-		return white
+		return theme.Status3xx
 	case code >= http.StatusBadRequest && code < http.StatusInternalServerError:
-		return yellow
+		return theme.Status4xx
 	default:
-		return red
+		return theme.Status5xx
 	}
 }
 
 // MethodColor is the ANSI color for appropriately logging http method to a terminal.
 func (p *LogFormatterParams) MethodColor() string {
 	method := p.Method
+	theme := p.Theme()
 
 	switch method {
 	case http.MethodGet:
-		return blue
+		return theme.MethodGet
 	case http.MethodPost:
-		return cyan
+		return theme.MethodPost
 	case http.MethodPut:
-		return yellow
+		return theme.MethodPut
 	case http.MethodDelete:
-		return red
+		return theme.MethodDelete
 	case http.MethodPatch:
-		return green
+		return theme.MethodPatch
 	case http.MethodHead:
-		return magenta
+		return theme.MethodHead
 	case http.MethodOptions:
-		return white
+		return theme.MethodOptions
 	default:
-		return reset
+		return theme.MethodOther
 	}
 }
 
+// LatencyColor is the ANSI color for logging latency to a terminal, empty by default.
+func (p *LogFormatterParams) LatencyColor() string {
+	return p.Theme().Latency
+}
+
 // ResetColor resets all escape attributes.
 func (p *LogFormatterParams) ResetColor() string {
-	return reset
+	return p.Theme().Reset
 }
 
 // IsOutputColor indicates whether can colors be outputted to the log.
@@ -334,17 +639,57 @@ func HandlerWithConfig(conf LoggerConfig, next http.Handler) (http.Handler, erro
 	return loggingMiddleware.Handler(next), nil
 }
 
-func maskHeaderKeys(h http.Header, keys []*regexp.Regexp) http.Header {
-	for k, v := range h {
+// requestURL returns the URL the client requested, with the reconstructed scheme and host if known.
+// The path and query are taken from Path, which is scrubbed by ScrubPII, unlike the request URL.
+func requestURL(p *LogFormatterParams) string {
+	if p.FullURL != "" {
+		return p.FullURL
+	}
+	if p.Request != nil {
+		scheme, host := p.Request.URL.Scheme, p.Request.URL.Host
+		if host == "" {
+			host = p.Request.Host
+		}
+		if scheme == "" {
+			scheme = "http"
+			if p.Request.TLS != nil {
+				scheme = "https"
+			}
+		}
+		path := p.Path
+		if path == "" {
+			path = p.Request.URL.RequestURI()
+		}
+		return scheme + "://" + host + path
+	}
+	return p.Path
+}
+
+// maskHeaderKeys masks values of keys matching any of regexps.
+// h is never modified: it is cloned before masking, so when nothing is masked h is returned as is.
+// With own set the result is always a private copy, which could be modified.
+func maskHeaderKeys(h http.Header, keys []*regexp.Regexp, own bool) http.Header {
+	if h == nil {
+		return nil
+	}
+	result := h
+	if own {
+		result = h.Clone()
+	}
+	for k := range h {
 		for _, rx := range keys {
 			if rx.MatchString(k) {
-				for iv, vv := range v {
-					h[k][iv] = masked(vv)
+				if !own {
+					result, own = h.Clone(), true
+				}
+				for iv, vv := range result[k] {
+					result[k][iv] = masked(vv)
 				}
+				break
 			}
 		}
 	}
-	return h
+	return result
 }
 
 // returns ten asterisks for short string
@@ -3,15 +3,12 @@ package httplog
 import (
 	"bytes"
 	"fmt"
-	"hash/fnv"
 	"io"
 	"math/rand"
 	"net/http"
-	"os"
 	"regexp"
+	"sync"
 	"time"
-
-	"github.com/mattn/go-isatty"
 )
 
 // Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
@@ -21,14 +18,46 @@ import (
 // LoggingMiddleware wraps the logging middleware with lifecycle methods
 type LoggingMiddleware struct {
 	Handler func(next http.Handler) http.Handler
-	logChan chan LogFormatterParams
+	sinks   []*sinkWriter
 }
 
-// Close cleanly shuts down async logging goroutine
+// Close cleanly shuts down async logging goroutines
 func (m *LoggingMiddleware) Close() {
-	if m.logChan != nil {
-		close(m.logChan)
+	for _, s := range m.sinks {
+		s.close()
+	}
+}
+
+var paramsPool = sync.Pool{
+	New: func() any { return new(LogFormatterParams) },
+}
+
+func acquireParams() *LogFormatterParams {
+	return paramsPool.Get().(*LogFormatterParams)
+}
+
+// releaseParams returns params to the pool after the request is logged.
+// Formatters and DropFunc get a copy, but Enrichers, Encoders and sinks in sync mode get the pooled pointer,
+// so they must not keep it after the call, see Encoder. Async sinks queue their own copy.
+func releaseParams(p *LogFormatterParams) {
+	*p = LogFormatterParams{}
+	paramsPool.Put(p)
+}
+
+// fnv32a is FNV-1a hash of concatenated strings, the same as hash/fnv without allocations
+func fnv32a(strs ...string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for _, s := range strs {
+		for i := 0; i < len(s); i++ {
+			h ^= uint32(s[i])
+			h *= prime32
+		}
 	}
+	return h
 }
 
 // LoggerWithName instance a Logger middleware with the specified name prefix.
@@ -73,37 +102,43 @@ func LoggerWithConfig(conf LoggerConfig) (*LoggingMiddleware, error) {
 		return nil, err
 	}
 
-	formatter := conf.Formatter
-	if formatter == nil {
-		formatter = DefaultLogFormatter
-	}
-
 	if conf.ProxyHandler == nil {
 		conf.ProxyHandler = NewProxy()
 	}
 
-	out := conf.Output
-	if out == nil {
-		out = DefaultWriter
+	if conf.TrustedProxies != nil {
+		proxy := *conf.ProxyHandler
+		_ = proxy.SetTrustedProxies(conf.TrustedProxies) // Already validated
+		conf.ProxyHandler = &proxy
 	}
 
-	colorMode := conf.ColorMode
-	// Auto-detect terminal if ColorAuto
-	if colorMode == ColorAuto {
-		if w, ok := out.(*os.File); ok && os.Getenv("TERM") != "dumb" &&
-			(isatty.IsTerminal(w.Fd()) || isatty.IsCygwinTerminal(w.Fd())) {
-			colorMode = ColorForce // Resolve to ColorForce when terminal detected
-		} else {
-			// Not a terminal, disable colors
-			colorMode = ColorDisable
-		}
+	encoder := conf.Encoder
+	if encoder == nil && conf.Pattern != "" {
+		encoder, _ = NewPatternEncoder(conf.Pattern) // Already validated
+	}
+	if encoder == nil && conf.Template != "" {
+		encoder, _ = NewTemplateEncoder(conf.Template) // Already validated
 	}
 
-	var skipPath []*regexp.Regexp
-	for _, p := range conf.SkipPaths {
-		re, _ := regexp.Compile(p) // Already validated
-		skipPath = append(skipPath, re)
+	// Sinks replace Formatter, Encoder, Pattern, Template, Output, ColorMode and Theme
+	sinkConfs := conf.Sinks
+	if len(sinkConfs) == 0 {
+		sinkConfs = []Sink{{
+			Encoder:   encoder,
+			Formatter: conf.Formatter,
+			Output:    conf.Output,
+			ColorMode: conf.ColorMode,
+			Theme:     conf.Theme,
+		}}
 	}
+	sinks := make([]*sinkWriter, len(sinkConfs))
+	for i, sc := range sinkConfs {
+		sinks[i] = newSinkWriter(sc)
+	}
+	// params get color mode and theme of the first sink, until they are passed to sinks
+	colorMode, theme := sinks[0].colorMode, sinks[0].theme
+
+	skipper := newRequestSkipper(conf) // Already validated
 
 	var hideHeaderKeys []*regexp.Regexp
 	for _, p := range conf.HideHeaderKeys {
@@ -111,6 +146,16 @@ func LoggerWithConfig(conf LoggerConfig) (*LoggingMiddleware, error) {
 		hideHeaderKeys = append(hideHeaderKeys, re)
 	}
 
+	var anonymizer *ipAnonymizer
+	if conf.IPAnonymization.Mode != IPAnonymizeNone {
+		anonymizer = newIPAnonymizer(conf.IPAnonymization, conf.ProxyHandler)
+	}
+
+	var scrubber *piiScrubber
+	if conf.ScrubPII {
+		scrubber = newPIIScrubber(conf.PIIDetectors)
+	}
+
 	// Set defaults for new config fields
 	sampleRate := conf.SampleRate
 	if sampleRate < 0 {
@@ -119,24 +164,29 @@ func LoggerWithConfig(conf LoggerConfig) (*LoggingMiddleware, error) {
 
 	minLevel := conf.MinLevel
 	// minLevel defaults to LevelDebug (0), which is fine
+	// nothing is prepared for entries which none of the sinks accept
+	sinkLevel := sinks[0].minLevel
+	for _, s := range sinks[1:] {
+		sinkLevel = min(sinkLevel, s.minLevel)
+	}
+	minLevel = max(minLevel, sinkLevel)
 
 	asyncBufferSize := conf.AsyncBufferSize
 	if conf.AsyncLogging && asyncBufferSize == 0 {
 		asyncBufferSize = 1000 // Default buffer size
 	}
 
-	// Create async logging channel if enabled
-	var logChan chan LogFormatterParams
+	// Start background goroutines for async logging, one per sink
 	if conf.AsyncLogging {
-		logChan = make(chan LogFormatterParams, asyncBufferSize)
-		// Start background goroutine for async logging
-		go func() {
-			for param := range logChan {
-				fmt.Fprint(out, formatter(param))
-			}
-		}()
+		for _, s := range sinks {
+			s.startAsync(asyncBufferSize)
+		}
 	}
 
+	// headers are modified in place by these, or outlive the request in async mode,
+	// otherwise they are shared with the request and response when nothing is masked
+	ownHeaders := scrubber != nil || anonymizer != nil || conf.AsyncLogging
+
 	middleware := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Start timer
@@ -144,39 +194,22 @@ func LoggerWithConfig(conf LoggerConfig) (*LoggingMiddleware, error) {
 			path := r.URL.Path
 			raw := r.URL.RawQuery
 
-			// Capture request body if enabled
-			var requestBody []byte
-			if conf.CaptureRequestBody && r.Body != nil {
-				var err error
-				requestBody, err = io.ReadAll(r.Body)
-				if err != nil {
-					// Log error but don't fail - body capture is optional
-					requestBody = []byte(fmt.Sprintf("[body read error: %v]", err))
-				}
-				r.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-			}
+			// Skip checks go before any capture, so skipped requests cost nothing
+			skip := skipper.match(r) || (conf.SkipFunc != nil && conf.SkipFunc(r))
 
-			// Process request
-			// Wrap response writer with Recorded response writer
-			wr := NewWriter(w, conf.CaptureResponseBody)
-			next.ServeHTTP(wr, r)
-
-			var skip bool
-			// check path for skip regexp set
-			for _, r := range skipPath {
-				if r.MatchString(path) {
-					skip = true
-					break
-				}
+			// check client class, parsed result is reused by UserAgentEnricher
+			var userAgent *UserAgentInfo
+			if !skip && (len(conf.SkipUserAgents) > 0 || len(conf.DebugUserAgents) > 0) {
+				ua := ParseUserAgent(r.UserAgent())
+				userAgent = &ua
+				skip = containsUserAgentClass(conf.SkipUserAgents, ua.Class)
 			}
 
 			// Apply sampling (skip if sample rate check fails)
 			if !skip && sampleRate > 0 && sampleRate < 1.0 {
 				if conf.DeterministicSampling {
 					// Hash-based sampling using path + method
-					h := fnv.New32a()
-					h.Write([]byte(r.Method + path))
-					hashVal := float64(h.Sum32()) / float64(^uint32(0))
+					hashVal := float64(fnv32a(r.Method, path)) / float64(^uint32(0))
 					if hashVal > sampleRate {
 						skip = true
 					}
@@ -187,56 +220,141 @@ func LoggerWithConfig(conf LoggerConfig) (*LoggingMiddleware, error) {
 				}
 			}
 
-			// Log only when path is not being skipped
-			if !skip {
-				maskedReqHeader := maskHeaderKeys(r.Header.Clone(), hideHeaderKeys)
+			if skip {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-				param := LogFormatterParams{
-					Request:       r,
-					Context:       r.Context(),
-					colorMode:     colorMode,
-					RequestHeader: maskedReqHeader,
-					RequestBody:   requestBody,
+			// Record request body read errors, like http.MaxBytesReader overflow
+			body := newBodyReader(r)
+
+			// Capture request body if enabled
+			var requestBody []byte
+			if conf.CaptureRequestBody && r.Body != nil {
+				var err error
+				requestBody, err = io.ReadAll(r.Body)
+				if err != nil {
+					// Log error but don't fail - body capture is optional
+					requestBody = []byte(fmt.Sprintf("[body read error: %v]", err))
 				}
+				r.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+			}
 
-				// Stop timer
-				param.TimeStamp = time.Now()
-				param.Latency = param.TimeStamp.Sub(start)
+			// Process request
+			// Wrap response writer with Recorded response writer
+			wr := acquireWriter(w, conf.CaptureResponseBody)
+			defer wr.release()
+			next.ServeHTTP(wr.outer, r)
+
+			// Level is decided before anything is copied
+			statusCode := wr.Status()
+			requestErr, clientCanceled := requestOutcome(r.Context(), wr.Err(), body)
+			if clientCanceled {
+				statusCode = StatusClientClosedRequest
+			}
+			level := LevelFromStatusCode(statusCode)
+			if userAgent != nil && level == LevelInfo && containsUserAgentClass(conf.DebugUserAgents, userAgent.Class) {
+				level = LevelDebug
+			}
 
-				param.ClientIP = conf.ProxyHandler.ClientIP(r)
-				param.Method = r.Method
-				param.StatusCode = wr.Status()
+			// Apply level filtering
+			if level < minLevel {
+				return
+			}
 
-				// Set level based on status code
-				param.Level = LevelFromStatusCode(param.StatusCode)
+			param := acquireParams()
+			defer releaseParams(param)
+			*param = LogFormatterParams{
+				Request:        r,
+				Context:        r.Context(),
+				colorMode:      colorMode,
+				theme:          theme,
+				RequestHeader:  maskHeaderKeys(r.Header, hideHeaderKeys, ownHeaders),
+				RequestBody:    requestBody,
+				StatusCode:     statusCode,
+				Level:          level,
+				UserAgent:      userAgent,
+				Error:          requestErr,
+				ClientCanceled: clientCanceled,
+			}
 
-				// Apply level filtering
-				if param.Level < minLevel {
-					return
+			// Stop timer
+			param.TimeStamp = time.Now()
+			param.Latency = param.TimeStamp.Sub(start)
+
+			resolved := conf.ProxyHandler.resolve(r)
+			param.ClientIP = resolved.clientIP
+			param.Scheme, param.Host = resolved.scheme, resolved.host
+			param.forwardedOrigin = resolved.forwardedOrigin
+			if resolved.hasForwarded {
+				param.ForwardedProto = resolved.forwarded.Proto
+				param.ForwardedHost = resolved.forwarded.Host
+			}
+			param.Method = r.Method
+			param.BytesWritten = int64(wr.Size())
+			param.BytesExpected = expectedBytes(wr.Header())
+
+			param.BodySize = wr.Size()
+			param.ResponseBody = wr.Body()
+			param.ResponseHeader = maskHeaderKeys(wr.Header(), hideHeaderKeys, ownHeaders)
+			// trailer values are shared with the response header, so they are always copied
+			param.Trailer = maskHeaderKeys(wr.Trailer(), hideHeaderKeys, true)
+			if first := wr.FirstByte(); !first.IsZero() {
+				param.TTFB = first.Sub(start)
+			}
+			param.Flushes = wr.Flushes()
+			param.Informational = wr.Informational()
+
+			param.RouterName = conf.RouterName
+
+			if scrubber != nil {
+				counts := map[string]int{}
+				scrubber.scrubHeader(param.RequestHeader, counts)
+				scrubber.scrubHeader(param.ResponseHeader, counts)
+				scrubber.scrubHeader(param.Trailer, counts)
+				param.RequestBody = scrubber.scrub(param.RequestBody, counts)
+				param.ResponseBody = scrubber.scrub(param.ResponseBody, counts)
+				raw = scrubber.scrubQuery(raw, counts)
+				if len(counts) > 0 {
+					param.Redactions = counts
 				}
+			}
+
+			if raw != "" {
+				path = path + "?" + raw
+			}
 
-				param.BodySize = wr.Size()
-				param.ResponseBody = wr.Body()
-				param.ResponseHeader = maskHeaderKeys(wr.Header().Clone(), hideHeaderKeys)
+			param.Path = path
+			if param.Host != "" {
+				param.FullURL = param.Scheme + "://" + param.Host + path
+			}
 
-				param.RouterName = conf.RouterName
+			// Enrichers see the real client IP, so anonymization goes after them
+			for _, enrich := range conf.Enrichers {
+				enrich(param)
+			}
 
-				if raw != "" {
-					path = path + "?" + raw
-				}
+			if conf.DropFunc != nil && conf.DropFunc(*param) {
+				return
+			}
 
-				param.Path = path
+			if anonymizer != nil {
+				param.ClientIP = anonymizer.anonymize(param.ClientIP)
+				anonymizer.anonymizeHeader(param.RequestHeader)
+				anonymizer.anonymizeFields(param.Fields)
+			}
 
-				// Write log (sync or async)
-				if conf.AsyncLogging {
-					select {
-					case logChan <- param:
-						// Successfully queued
-					default:
-						// Buffer full, drop log (or could block here)
-					}
-				} else {
-					fmt.Fprint(out, formatter(param))
+			// Write log to every sink (sync or async), raw sinks get fields before sanitizing.
+			// Sanitizing replaces fields instead of modifying them, so queued copies are not affected.
+			for _, s := range sinks {
+				if s.raw {
+					s.log(param)
+				}
+			}
+			sanitizeParams(param, conf.Sanitize)
+			for _, s := range sinks {
+				if !s.raw {
+					s.log(param)
 				}
 			}
 		})
@@ -244,6 +362,6 @@ func LoggerWithConfig(conf LoggerConfig) (*LoggingMiddleware, error) {
 
 	return &LoggingMiddleware{
 		Handler: middleware,
-		logChan: logChan,
+		sinks:   sinks,
 	}, nil
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -69,3 +70,84 @@ func TestLoggerWithNameMiddleware(t *testing.T) {
 	assert.Contains(t, buffer.String(), "GET")
 	assert.Contains(t, buffer.String(), "/notfound")
 }
+
+func TestLoggerWithConfigEnrichers(t *testing.T) {
+	var gotParam LogFormatterParams
+	var enrichedIP string
+	buffer := new(bytes.Buffer)
+
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output:          buffer,
+		IPAnonymization: IPAnonymization{Mode: IPAnonymizeTruncate},
+		Enrichers: []Enricher{
+			func(param *LogFormatterParams) {
+				enrichedIP = param.ClientIP
+				param.Geo = &GeoInfo{CountryCode: "GB"}
+			},
+		},
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return DefaultLogFormatter(param)
+		},
+	}, testHandler200("ok"))
+
+	PerformRequest(logger, "GET", "/", header{Key: "X-Forwarded-For", Value: "81.2.69.142"})
+
+	// enricher gets the real IP, formatter gets anonymized one
+	assert.Equal(t, "81.2.69.142", enrichedIP)
+	assert.Equal(t, "81.2.69.0", gotParam.ClientIP)
+	assert.Equal(t, "GB", gotParam.Geo.CountryCode)
+	assert.Contains(t, buffer.String(), "81.2.69.0 GB")
+}
+
+func TestLoggerWithConfigResponseTimeline(t *testing.T) {
+	var gotParam LogFormatterParams
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output:         new(bytes.Buffer),
+		HideHeaderKeys: []string{"Checksum"},
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return ""
+		},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusEarlyHints)
+		_, _ = w.Write([]byte("chunk"))
+		w.(http.Flusher).Flush()
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("X-Checksum", "0123456789abcdef")
+	}))
+
+	w := PerformRequest(logger, "GET", "/stream")
+
+	assert.GreaterOrEqual(t, gotParam.TTFB, 10*time.Millisecond)
+	assert.Less(t, gotParam.TTFB, gotParam.Latency)
+	assert.Equal(t, 1, gotParam.Flushes)
+	assert.Equal(t, []int{http.StatusEarlyHints}, gotParam.Informational)
+	assert.Equal(t, "0**********f", gotParam.Trailer.Get("X-Checksum"))
+	// the real trailer is not masked
+	assert.Equal(t, "0123456789abcdef", w.Header().Get("X-Checksum"))
+}
+
+func TestLoggerWithConfigMaskingKeepsRequestHeader(t *testing.T) {
+	var gotParam LogFormatterParams
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output:         new(bytes.Buffer),
+		HideHeaderKeys: []string{"Authorization"},
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return ""
+		},
+	}, testHandler200("ok"))
+
+	r := newRequest("GET", "/")
+	r.Header.Set("Authorization", "Bearer secret-token")
+	r.Header.Set("Accept", "*/*")
+	PerformRequestWithRequest(logger, r)
+
+	// header is copied before masking, the request keeps the real value
+	assert.Equal(t, "B**********n", gotParam.RequestHeader.Get("Authorization"))
+	assert.Equal(t, "*/*", gotParam.RequestHeader.Get("Accept"))
+	assert.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+}
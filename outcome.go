@@ -0,0 +1,106 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// StatusClientClosedRequest is nginx-style status code for requests canceled by the client
+// before the response was completed
+const StatusClientClosedRequest = 499
+
+// bodyReader records the first read error of request body, e.g. *http.MaxBytesError
+type bodyReader struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// newBodyReader wraps request body, returns nil for requests without body
+func newBodyReader(r *http.Request) *bodyReader {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	br := &bodyReader{ReadCloser: r.Body}
+	r.Body = br
+	return br
+}
+
+// requestOutcome classifies how the request ended.
+// Request body overflow wins over write errors, which win over context errors,
+// clientCanceled is true when the client went away before the response was completed.
+// Connection errors are returned without addresses, see withoutAddrs.
+func requestOutcome(ctx context.Context, writeErr error, body *bodyReader) (err error, clientCanceled bool) {
+	err, clientCanceled = classifyOutcome(ctx, writeErr, body)
+	return withoutAddrs(err), clientCanceled
+}
+
+// withoutAddrs returns the cause of net.OpError without local and remote addresses,
+// e.g. "write: broken pipe" instead of "write tcp 10.0.0.1:8080->203.0.113.7:51234: write: broken pipe",
+// as the remote address is the client's IP, which must not bypass IPAnonymization.
+// errors.Is still matches syscall errors of the result.
+func withoutAddrs(err error) error {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || (opErr.Source == nil && opErr.Addr == nil) {
+		return err
+	}
+	var sysErr *os.SyscallError
+	if errors.As(opErr.Err, &sysErr) {
+		return sysErr
+	}
+	return fmt.Errorf("%s %s: %w", opErr.Op, opErr.Net, opErr.Err)
+}
+
+func classifyOutcome(ctx context.Context, writeErr error, body *bodyReader) (err error, clientCanceled bool) {
+	if body != nil && body.err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(body.err, &maxBytesErr) {
+			return body.err, false
+		}
+	}
+
+	ctxErr := ctx.Err()
+	if writeErr != nil {
+		canceled := errors.Is(ctxErr, context.Canceled) ||
+			errors.Is(writeErr, syscall.EPIPE) || errors.Is(writeErr, syscall.ECONNRESET)
+		return writeErr, canceled
+	}
+	if ctxErr != nil {
+		return ctxErr, errors.Is(ctxErr, context.Canceled)
+	}
+	if body != nil && body.err != nil {
+		return body.err, false
+	}
+	return nil, false
+}
+
+// expectedBytes returns response Content-Length, 0 if it is unknown
+func expectedBytes(h http.Header) int64 {
+	cl := h.Get("Content-Length")
+	if cl == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(cl, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,162 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func outcomeParams(t *testing.T, wrap func(http.Handler) http.Handler, handler http.HandlerFunc, r *http.Request) LogFormatterParams {
+	t.Helper()
+	var gotParam LogFormatterParams
+	logger, err := HandlerWithConfig(LoggerConfig{
+		Output: new(bytes.Buffer),
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return DefaultLogFormatter(param)
+		},
+	}, handler)
+	assert.NoError(t, err)
+	if wrap != nil {
+		logger = wrap(logger)
+	}
+	PerformRequestWithRequest(logger, r)
+	return gotParam
+}
+
+func TestRequestOutcomeClientCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/slow", nil).WithContext(ctx)
+
+	param := outcomeParams(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte("partial"))
+		cancel() // client has gone away
+	}, r)
+
+	assert.True(t, param.ClientCanceled)
+	assert.Equal(t, StatusClientClosedRequest, param.StatusCode)
+	assert.Equal(t, LevelWarn, param.Level)
+	assert.ErrorIs(t, param.Error, context.Canceled)
+	assert.Equal(t, int64(100), param.BytesExpected)
+	assert.Equal(t, int64(7), param.BytesWritten)
+	assert.Contains(t, DefaultLogFormatter(param), "| context canceled")
+}
+
+func TestRequestOutcomeDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	r := httptest.NewRequest("GET", "/slow", nil).WithContext(ctx)
+
+	param := outcomeParams(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, r)
+
+	assert.False(t, param.ClientCanceled)
+	assert.Equal(t, http.StatusServiceUnavailable, param.StatusCode)
+	assert.ErrorIs(t, param.Error, context.DeadlineExceeded)
+}
+
+func TestRequestOutcomeMaxBytes(t *testing.T) {
+	limit := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, 4)
+			next.ServeHTTP(w, r)
+		})
+	}
+	r := httptest.NewRequest("POST", "/upload", strings.NewReader("too large body"))
+
+	param := outcomeParams(t, limit, func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+		}
+	}, r)
+
+	var maxBytesErr *http.MaxBytesError
+	assert.ErrorAs(t, param.Error, &maxBytesErr)
+	assert.False(t, param.ClientCanceled)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, param.StatusCode)
+}
+
+func TestRequestOutcome(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		writeErr error
+		bodyErr  error
+		err      error
+		canceled bool
+	}{
+		{"ok", context.Background(), nil, nil, nil, false},
+		{"broken pipe", context.Background(), syscall.EPIPE, nil, syscall.EPIPE, true},
+		{"reset", context.Background(), syscall.ECONNRESET, nil, syscall.ECONNRESET, true},
+		{"write error", context.Background(), http.ErrHandlerTimeout, nil, http.ErrHandlerTimeout, false},
+		{"write after cancel", canceled, io.ErrClosedPipe, nil, io.ErrClosedPipe, true},
+		{"body error", context.Background(), nil, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body *bodyReader
+			if tt.bodyErr != nil {
+				body = &bodyReader{err: tt.bodyErr}
+			}
+			err, canceled := requestOutcome(tt.ctx, tt.writeErr, body)
+			assert.True(t, errors.Is(err, tt.err) || err == tt.err)
+			assert.Equal(t, tt.canceled, canceled)
+		})
+	}
+}
+
+// brokenPipeWriter fails writes like a connection closed by the client
+type brokenPipeWriter struct {
+	http.ResponseWriter
+}
+
+func (brokenPipeWriter) Write([]byte) (int, error) {
+	return 0, &net.OpError{
+		Op:     "write",
+		Net:    "tcp",
+		Source: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8080},
+		Addr:   &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234},
+		Err:    &os.SyscallError{Syscall: "write", Err: syscall.EPIPE},
+	}
+}
+
+func TestRequestOutcomeHidesClientAddress(t *testing.T) {
+	var gotParam LogFormatterParams
+	buffer := new(bytes.Buffer)
+	logger, err := HandlerWithConfig(LoggerConfig{
+		Output:          buffer,
+		IPAnonymization: IPAnonymization{Mode: IPAnonymizeTruncate},
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return DefaultLogFormatter(param)
+		},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("response"))
+	}))
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	logger.ServeHTTP(brokenPipeWriter{httptest.NewRecorder()}, r)
+
+	assert.True(t, gotParam.ClientCanceled)
+	assert.ErrorIs(t, gotParam.Error, syscall.EPIPE)
+	assert.EqualError(t, gotParam.Error, "write: broken pipe")
+	assert.Equal(t, "203.0.113.0", gotParam.ClientIP)
+	assert.NotContains(t, buffer.String(), "203.0.113.7")
+}
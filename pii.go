@@ -0,0 +1,207 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PIIDetector describes one kind of personally identifiable information
+// the scrubber is able to find in captured data.
+type PIIDetector struct {
+	// Name identifies detector in LogFormatterParams.Redactions, e.g. "email"
+	Name string
+	// Pattern matches candidate values
+	Pattern *regexp.Regexp
+	// Validate optionally confirms a candidate match, e.g. Luhn check for card numbers.
+	// Optional. When nil every Pattern match is redacted.
+	Validate func(match string) bool
+}
+
+// Built-in PII detectors
+var (
+	// PIIPrivateKey matches PEM encoded private key blocks
+	PIIPrivateKey = PIIDetector{
+		Name:    "private_key",
+		Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	}
+
+	// PIIJWT matches JSON Web Tokens
+	PIIJWT = PIIDetector{
+		Name:    "jwt",
+		Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+	}
+
+	// PIIAWSAccessKey matches AWS access key IDs
+	PIIAWSAccessKey = PIIDetector{
+		Name:    "aws_access_key",
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`),
+	}
+
+	// PIIEmail matches email addresses
+	PIIEmail = PIIDetector{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	}
+
+	// PIIIBAN matches international bank account numbers with valid mod-97 checksum
+	PIIIBAN = PIIDetector{
+		Name:     "iban",
+		Pattern:  regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`),
+		Validate: validIBAN,
+	}
+
+	// PIICreditCard matches card numbers with valid Luhn checksum
+	PIICreditCard = PIIDetector{
+		Name:     "credit_card",
+		Pattern:  regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		Validate: validLuhn,
+	}
+
+	// PIIPhone matches international and separated local phone numbers
+	PIIPhone = PIIDetector{
+		Name:    "phone",
+		Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?(?:\(\d{2,4}\)|\d{2,4})[ .\-]\d{3,4}[ .\-]\d{3,4}\b|\+\d{8,15}\b`),
+		Validate: func(match string) bool {
+			n := len(digitsOnly(match))
+			return n >= 7 && n <= 15
+		},
+	}
+)
+
+// DefaultPIIDetectors is the detector set used when ScrubPII is enabled and PIIDetectors is empty.
+// Detectors run in order, so the most specific ones go first.
+var DefaultPIIDetectors = []PIIDetector{
+	PIIPrivateKey,
+	PIIJWT,
+	PIIAWSAccessKey,
+	PIIEmail,
+	PIIIBAN,
+	PIICreditCard,
+	PIIPhone,
+}
+
+// piiScrubber masks detected PII values and counts redactions per detector name
+type piiScrubber struct {
+	detectors []PIIDetector
+}
+
+func newPIIScrubber(detectors []PIIDetector) *piiScrubber {
+	if len(detectors) == 0 {
+		detectors = DefaultPIIDetectors
+	}
+	return &piiScrubber{detectors: detectors}
+}
+
+// scrub returns a copy of b with all detected values masked, b itself is never modified
+func (s *piiScrubber) scrub(b []byte, counts map[string]int) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	for _, d := range s.detectors {
+		b = d.Pattern.ReplaceAllFunc(b, func(m []byte) []byte {
+			if d.Validate != nil && !d.Validate(string(m)) {
+				return m
+			}
+			counts[d.Name]++
+			return []byte(masked(string(m)))
+		})
+	}
+	return b
+}
+
+func (s *piiScrubber) scrubString(str string, counts map[string]int) string {
+	if str == "" {
+		return str
+	}
+	return string(s.scrub([]byte(str), counts))
+}
+
+// scrubHeader masks header values in place
+func (s *piiScrubber) scrubHeader(h http.Header, counts map[string]int) {
+	for _, v := range h {
+		for i := range v {
+			v[i] = s.scrubString(v[i], counts)
+		}
+	}
+}
+
+// scrubQuery masks decoded query values, keeping the original order and encoding of untouched values
+func (s *piiScrubber) scrubQuery(raw string, counts map[string]int) string {
+	if raw == "" {
+		return raw
+	}
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+		decoded, err := url.QueryUnescape(value)
+		if err != nil {
+			decoded = value
+		}
+		if scrubbed := s.scrubString(decoded, counts); scrubbed != decoded {
+			parts[i] = key + "=" + url.QueryEscape(scrubbed)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// validLuhn checks card number checksum
+func validLuhn(s string) bool {
+	digits := digitsOnly(s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks IBAN mod-97 checksum
+func validIBAN(s string) bool {
+	iban := strings.ReplaceAll(s, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	rem := 0
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			rem = (rem*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
@@ -5,6 +5,7 @@ package httplog
 // license that can be found in the LICENSE file.
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
@@ -26,12 +27,21 @@ const (
 	ProxyDefaultType = ""
 )
 
-// Default proxy remote IP headers
-var DefaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+// Default proxy remote IP headers.
+// Forwarded header is parsed according to RFC 7239, others are X-Forwarded-For like comma lists.
+// Names are in canonical form, so lookups don't allocate.
+var DefaultRemoteIPHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-Ip"}
 
+// Proxy resolves the real client IP from proxy headers
 type Proxy struct {
 	ptype           ProxyType
+	format          ProxyHeaderFormat
 	RemoteIPHeaders []string
+	// trustedCIDRs is a list of networks the proxy headers are accepted from,
+	// nil means every peer is trusted
+	trustedCIDRs []*net.IPNet
+	// needsTrustedProxies is set by presets, whose header must not be trusted from every peer
+	needsTrustedProxies bool
 }
 
 // NewProxy creates and returns default proxy with default params
@@ -58,31 +68,187 @@ func NewProxyWithTypeAndHeaders(t ProxyType, header []string) *Proxy {
 	}
 }
 
+// SetTrustedProxies sets a list of networks (CIDR or single IP) the proxy headers are accepted from.
+// Requests from other peers get the IP from Request.RemoteAddr.
+// Pass nil to trust every peer, which is the default.
+func (p *Proxy) SetTrustedProxies(proxies []string) error {
+	cidrs, err := parseCIDRs(proxies)
+	if err != nil {
+		return err
+	}
+	p.trustedCIDRs = cidrs
+	return nil
+}
+
 // ClientIP implements one best effort algorithm to return the real client IP.
-// It calls c.RemoteIP() under the hood, to check if the remote IP is a trusted proxy or not.
-// If it is it will then try to parse the headers defined in Engine.RemoteIPHeaders (defaulting to [X-Forwarded-For, X-Real-Ip]).
+// It checks if the remote IP (coming from Request.RemoteAddr) is a trusted proxy or not, see SetTrustedProxies.
+// If it is it will then try to parse the headers defined in RemoteIPHeaders (defaulting to [Forwarded, X-Forwarded-For, X-Real-Ip]),
+// walking the chain right to left and skipping trusted hops.
 // If the headers are not syntactically valid OR the remote IP does not correspond to a trusted proxy,
-// the remote IP (coming from Request.RemoteAddr) is returned.
+// the remote IP is returned. Peers without IP address, e.g. on unix sockets, are trusted only if every peer is,
+// and Request.RemoteAddr is returned as is for them.
 func (p *Proxy) ClientIP(r *http.Request) string {
+	return p.resolve(r).clientIP
+}
+
+// Origin reconstructs the original scheme and host (with port if not default) the client requested,
+// with the same trust rules as ClientIP. It checks Forwarded header first,
+// then X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Port.
+// Proxies append to these lists, so the value is taken from the hop of the client-facing proxy,
+// counting trusted hops of X-Forwarded-For from the right, as ClientIP does.
+// If the peer is not trusted or headers are missing, the request's own values are returned.
+func (p *Proxy) Origin(r *http.Request) (scheme, host string) {
+	res := p.resolve(r)
+	return res.scheme, res.host
+}
+
+// Forwarded returns the client-facing hop of RFC 7239 Forwarded header, with the same trust rules as ClientIP.
+// It is useful to get the original protocol and host of the request.
+func (p *Proxy) Forwarded(r *http.Request) (ForwardedElement, bool) {
+	res := p.resolve(r)
+	return res.forwarded, res.hasForwarded
+}
+
+// proxyResolution is what Proxy resolves from request headers
+type proxyResolution struct {
+	clientIP     string
+	scheme, host string
+	// forwardedOrigin is true if scheme or host came from trusted proxy headers
+	forwardedOrigin bool
+	forwarded       ForwardedElement
+	hasForwarded    bool
+}
+
+// resolve resolves client IP, origin and Forwarded element of the request,
+// parsing Forwarded header once for all of them
+func (p *Proxy) resolve(r *http.Request) proxyResolution {
+	res := proxyResolution{scheme: "http", host: r.Host}
+	if r.TLS != nil {
+		res.scheme = "https"
+	}
+
+	remoteAddr := RemoteIP(r)
+	remoteIP := net.ParseIP(remoteAddr)
+	if remoteIP == nil {
+		remoteAddr = r.RemoteAddr
+	}
+	res.clientIP = remoteAddr
+	if !p.isTrusted(remoteIP) {
+		return res
+	}
+
+	res.forwarded, res.hasForwarded = p.forwardedElement(r)
+	res.clientIP = p.clientIP(r, res.forwarded, res.hasForwarded, remoteAddr)
+	p.origin(r, &res)
+	return res
+}
+
+// clientIP returns the client IP from headers of trusted peer
+func (p *Proxy) clientIP(r *http.Request, fe ForwardedElement, hasForwarded bool, remoteAddr string) string {
 	// Check if we're running on a trusted platform, continue running backwards if error
 	if p.ptype != "" {
 		// Developers can define their own header of Trusted Platform or use predefined constants
-		if addr := r.Header.Get(p.ptype.String()); addr != "" {
-			return addr
+		if ip, valid := p.platformIP(r.Header.Get(p.ptype.String())); valid {
+			return ip
 		}
 	}
 
-	remoteIP := net.ParseIP(RemoteIP(r))
-
 	if p.RemoteIPHeaders != nil {
 		for _, headerName := range p.RemoteIPHeaders {
+			if http.CanonicalHeaderKey(headerName) == "Forwarded" {
+				if hasForwarded && net.ParseIP(fe.For) != nil {
+					return fe.For
+				}
+				continue
+			}
 			ip, valid := p.validateHeader(r.Header.Get(headerName))
 			if valid {
 				return ip
 			}
 		}
 	}
-	return remoteIP.String()
+	return remoteAddr
+}
+
+// origin sets scheme and host of res from headers of trusted peer
+func (p *Proxy) origin(r *http.Request, res *proxyResolution) {
+	hops := p.trustedHops(r)
+	fwdScheme, fwdHost := res.forwarded.Proto, res.forwarded.Host
+	if fwdScheme == "" {
+		fwdScheme = hopListValue(r.Header.Values("X-Forwarded-Proto"), hops)
+	}
+	if fwdHost == "" {
+		fwdHost = hopListValue(r.Header.Values("X-Forwarded-Host"), hops)
+	}
+
+	if validScheme(fwdScheme) {
+		res.scheme = strings.ToLower(fwdScheme)
+		res.forwardedOrigin = true
+	}
+	if validHost(fwdHost) {
+		res.host = fwdHost
+		res.forwardedOrigin = true
+	}
+
+	if port := hopListValue(r.Header.Values("X-Forwarded-Port"), hops); port != "" && validPort(port) {
+		hostname := res.host
+		if h, _, err := net.SplitHostPort(res.host); err == nil {
+			hostname = h
+		}
+		if strings.Contains(hostname, ":") {
+			hostname = "[" + hostname + "]"
+		}
+		res.host = hostname
+		if !isDefaultPort(res.scheme, port) {
+			res.host = hostname + ":" + port
+		}
+		res.forwardedOrigin = true
+	}
+}
+
+// forwardedElement walks Forwarded header right to left and returns the first untrusted hop
+func (p *Proxy) forwardedElement(r *http.Request) (ForwardedElement, bool) {
+	values := r.Header.Values("Forwarded")
+	if len(values) == 0 {
+		return ForwardedElement{}, false
+	}
+	elements, err := ParseForwarded(strings.Join(values, ","))
+	if err != nil || len(elements) == 0 {
+		return ForwardedElement{}, false
+	}
+	for i := len(elements) - 1; i >= 0; i-- {
+		ip := net.ParseIP(elements[i].For)
+		// obfuscated and unknown nodes could not be trusted, the chain ends here
+		if i == 0 || ip == nil || !p.isTrusted(ip) {
+			return elements[i], true
+		}
+	}
+	return ForwardedElement{}, false
+}
+
+// platformIP parses the platform header according to proxy header format
+func (p *Proxy) platformIP(header string) (clientIP string, valid bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return "", false
+	}
+	switch p.format {
+	case ProxyHeaderList:
+		return p.validateHeader(header)
+	case ProxyHeaderIPPort:
+		if host, _, err := net.SplitHostPort(header); err == nil {
+			header = host
+		} else if net.ParseIP(header) == nil {
+			// unbracketed IPv6 with port
+			if i := strings.LastIndex(header, ":"); i > 0 {
+				header = header[:i]
+			}
+		}
+	}
+	if net.ParseIP(header) == nil {
+		return "", false
+	}
+	return header, true
 }
 
 // validateHeader will parse X-Forwarded-For like header and return the trusted client IP address
@@ -93,17 +259,134 @@ func (p *Proxy) validateHeader(header string) (clientIP string, valid bool) {
 	header = strings.ReplaceAll(header, "[", "")
 	header = strings.ReplaceAll(header, "]", "")
 	items := strings.Split(header, ",")
-	// we are getting the first ip in the list, which should refer to client's ip in proxy chain
-	if len(items) > 0 {
-		ipStr := strings.TrimSpace(items[0])
+	// walk the chain backwards, every proxy appends the address of its peer to the right,
+	// so the first untrusted address is the client's one
+	for i := len(items) - 1; i >= 0; i-- {
+		ipStr := strings.TrimSpace(items[i])
 		ip := net.ParseIP(ipStr)
-		if ip != nil {
+		if ip == nil {
+			return "", false
+		}
+		if i == 0 || !p.isTrusted(ip) {
 			return ipStr, true
 		}
 	}
 	return "", false
 }
 
+// trustedHops returns the number of trusted proxies behind the client-facing one,
+// which appended their peers to X-Forwarded-For
+func (p *Proxy) trustedHops(r *http.Request) int {
+	items := listValues(r.Header.Values("X-Forwarded-For"))
+	hops := 0
+	for i := len(items) - 1; i > 0; i-- {
+		ip := net.ParseIP(strings.Trim(strings.TrimSpace(items[i]), "[]"))
+		if ip == nil || !p.isTrusted(ip) {
+			break
+		}
+		hops++
+	}
+	return hops
+}
+
+// hopListValue returns the item of comma separated header values appended by the client-facing proxy,
+// which is hops items from the right. Items on the left of it could be sent by the client.
+// If there are less items than hops, not every proxy appended one, and the leftmost is returned.
+func hopListValue(values []string, hops int) string {
+	items := listValues(values)
+	if len(items) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(items[max(len(items)-1-hops, 0)])
+}
+
+// listValues splits comma separated header values into items
+func listValues(values []string) []string {
+	header := strings.Join(values, ",")
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+	return strings.Split(header, ",")
+}
+
+func validScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range strings.ToLower(s) {
+		isAlpha := c >= 'a' && c <= 'z'
+		if !isAlpha && (i == 0 || !(c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+func validHost(s string) bool {
+	return s != "" && !strings.ContainsAny(s, " /\\@?#\t\r\n")
+}
+
+func validPort(s string) bool {
+	if len(s) > 5 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isDefaultPort(scheme, port string) bool {
+	return (port == "80" && (scheme == "http" || scheme == "ws")) ||
+		(port == "443" && (scheme == "https" || scheme == "wss"))
+}
+
+// isTrusted checks if ip belongs to trusted proxies
+func (p *Proxy) isTrusted(ip net.IP) bool {
+	if p.trustedCIDRs == nil {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range p.trustedCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDRs parses a list of CIDRs or single IPs
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	if list == nil {
+		return nil, nil
+	}
+	cidrs := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address '%s'", s)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			s = fmt.Sprintf("%s/%d", s, bits)
+		}
+		_, cidr, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR '%s': %w", s, err)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
 // RemoteIP parses the IP from Request.RemoteAddr, normalizes and returns the IP (without the port).
 func RemoteIP(r *http.Request) string {
 	ip, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
@@ -0,0 +1,201 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProxyHeaderFormat describes the value format of a provider's client IP header
+type ProxyHeaderFormat int
+
+const (
+	// ProxyHeaderIP is a single IP address, like CF-Connecting-IP
+	ProxyHeaderIP ProxyHeaderFormat = iota
+
+	// ProxyHeaderIPPort is a single IP address with port, like CloudFront-Viewer-Address.
+	// IPv6 address could be without brackets, the last colon separates the port.
+	ProxyHeaderIPPort
+
+	// ProxyHeaderList is X-Forwarded-For like comma separated list of IPs,
+	// which is walked right to left skipping trusted hops
+	ProxyHeaderList
+)
+
+// More supported proxies
+const (
+	// ProxyAWSALB when running behind AWS Application Load Balancer,
+	// which appends the client's IP to X-Forwarded-For
+	ProxyAWSALB = "X-Forwarded-For"
+	// ProxyAWSCloudFront when using AWS CloudFront with CloudFront-Viewer-Address origin request policy
+	ProxyAWSCloudFront = "CloudFront-Viewer-Address"
+	// ProxyFastly when using Fastly CDN
+	ProxyFastly = "Fastly-Client-IP"
+	// ProxyAkamai when using Akamai with True-Client-IP enabled
+	ProxyAkamai = "True-Client-IP"
+	// ProxyFlyIO when running on Fly.io
+	ProxyFlyIO = "Fly-Client-IP"
+	// ProxyAzureFrontDoor when using Azure Front Door
+	ProxyAzureFrontDoor = "X-Azure-ClientIP"
+	// ProxyVercel when running on Vercel
+	ProxyVercel = "X-Vercel-Forwarded-For"
+)
+
+// ProxyPreset describes how a cloud or CDN provider passes the client's IP
+type ProxyPreset struct {
+	// Type is the header with client IP set by provider's edge
+	Type ProxyType
+	// Format of the header value
+	Format ProxyHeaderFormat
+	// EdgeRanges is a list of provider's published edge networks.
+	// When not empty, the header is trusted only from these networks.
+	// Could be loaded from file with WithEdgeRangesFromFile.
+	EdgeRanges []string
+
+	// needsTrustedProxies is set for providers without bundled EdgeRanges,
+	// whose header could be sent by any client reaching the app directly
+	needsTrustedProxies bool
+}
+
+// Supported proxy presets.
+//
+// PresetAWSALB, PresetAWSCloudFront, PresetAkamai, PresetFlyIO, PresetAzureFrontDoor and PresetVercel
+// have no EdgeRanges: their header is trusted from every peer, so any client reaching the app
+// not through the provider could spoof its IP. LoggerWithConfig returns error for them
+// unless the trusted networks are set with LoggerConfig.TrustedProxies, Proxy.SetTrustedProxies
+// or WithEdgeRangesFromFile. Set them to your VPC or the provider's published ranges.
+var (
+	PresetGoogleAppEngine = ProxyPreset{Type: ProxyGoogleAppEngine, Format: ProxyHeaderIP}
+	PresetCloudflare      = ProxyPreset{Type: ProxyCloudflare, Format: ProxyHeaderIP, EdgeRanges: cloudflareEdgeRanges}
+	PresetFastly          = ProxyPreset{Type: ProxyFastly, Format: ProxyHeaderIP, EdgeRanges: fastlyEdgeRanges}
+
+	// PresetAWSALB needs TrustedProxies, e.g. the VPC CIDR of the load balancer
+	PresetAWSALB = ProxyPreset{Type: ProxyAWSALB, Format: ProxyHeaderList, needsTrustedProxies: true}
+	// PresetAWSCloudFront needs TrustedProxies, e.g. CLOUDFRONT ranges of https://ip-ranges.amazonaws.com/ip-ranges.json
+	PresetAWSCloudFront = ProxyPreset{Type: ProxyAWSCloudFront, Format: ProxyHeaderIPPort, needsTrustedProxies: true}
+	// PresetAkamai needs TrustedProxies, e.g. Akamai SiteShield map of your property
+	PresetAkamai = ProxyPreset{Type: ProxyAkamai, Format: ProxyHeaderIP, needsTrustedProxies: true}
+	// PresetFlyIO needs TrustedProxies, e.g. the private network of Fly proxy
+	PresetFlyIO = ProxyPreset{Type: ProxyFlyIO, Format: ProxyHeaderIP, needsTrustedProxies: true}
+	// PresetAzureFrontDoor needs TrustedProxies, e.g. AzureFrontDoor.Backend service tag ranges
+	PresetAzureFrontDoor = ProxyPreset{Type: ProxyAzureFrontDoor, Format: ProxyHeaderIP, needsTrustedProxies: true}
+	// PresetVercel needs TrustedProxies, e.g. the ranges of Vercel's edge network
+	PresetVercel = ProxyPreset{Type: ProxyVercel, Format: ProxyHeaderList, needsTrustedProxies: true}
+)
+
+// cloudflareEdgeRanges is published at https://www.cloudflare.com/ips/
+var cloudflareEdgeRanges = []string{
+	"173.245.48.0/20",
+	"103.21.244.0/22",
+	"103.22.200.0/22",
+	"103.31.4.0/22",
+	"141.101.64.0/18",
+	"108.162.192.0/18",
+	"190.93.240.0/20",
+	"188.114.96.0/20",
+	"197.234.240.0/22",
+	"198.41.128.0/17",
+	"162.158.0.0/15",
+	"104.16.0.0/13",
+	"104.24.0.0/14",
+	"172.64.0.0/13",
+	"131.0.72.0/22",
+	"2400:cb00::/32",
+	"2606:4700::/32",
+	"2803:f800::/32",
+	"2405:b500::/32",
+	"2405:8100::/32",
+	"2a06:98c0::/29",
+	"2c0f:f248::/32",
+}
+
+// fastlyEdgeRanges is published at https://api.fastly.com/public-ip-list
+var fastlyEdgeRanges = []string{
+	"23.235.32.0/20",
+	"43.249.72.0/22",
+	"103.244.50.0/24",
+	"103.245.222.0/23",
+	"103.245.224.0/24",
+	"104.156.80.0/20",
+	"140.248.64.0/18",
+	"140.248.128.0/17",
+	"146.75.0.0/17",
+	"151.101.0.0/16",
+	"157.52.64.0/18",
+	"167.82.0.0/17",
+	"167.82.128.0/20",
+	"167.82.160.0/20",
+	"167.82.224.0/20",
+	"172.111.64.0/18",
+	"185.31.16.0/22",
+	"199.27.72.0/21",
+	"199.232.0.0/16",
+	"2a04:4e40::/32",
+	"2a04:4e42::/32",
+}
+
+// NewProxyWithPreset creates and returns proxy for specific cloud or CDN provider.
+// If preset has EdgeRanges, the client IP headers are trusted only from these networks.
+// Otherwise presets listed above need trusted networks, see Supported proxy presets.
+func NewProxyWithPreset(preset ProxyPreset) (*Proxy, error) {
+	p := &Proxy{
+		ptype:               preset.Type,
+		format:              preset.Format,
+		RemoteIPHeaders:     DefaultRemoteIPHeaders,
+		needsTrustedProxies: preset.needsTrustedProxies,
+	}
+	if len(preset.EdgeRanges) > 0 {
+		if err := p.SetTrustedProxies(preset.EdgeRanges); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// WithEdgeRangesFromFile returns a copy of preset with EdgeRanges loaded from file, see LoadEdgeRanges.
+// The ranges are read once: Proxy doesn't watch the file, to refresh them create a new Proxy
+// with NewProxyWithPreset and a new logger, e.g. on deploy or restart.
+func (pp ProxyPreset) WithEdgeRangesFromFile(path string) (ProxyPreset, error) {
+	ranges, err := LoadEdgeRanges(path)
+	if err != nil {
+		return pp, err
+	}
+	pp.EdgeRanges = ranges
+	return pp, nil
+}
+
+// LoadEdgeRanges reads a list of networks from a local file, one CIDR or IP per line.
+// Empty lines and lines starting with # are skipped.
+// Use it to update provider's ranges without waiting for a new httplog release.
+func LoadEdgeRanges(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ranges []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		if _, err := parseCIDRs([]string{s}); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ranges = append(ranges, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%s: no edge ranges found", path)
+	}
+	return ranges, nil
+}
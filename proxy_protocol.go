@@ -0,0 +1,341 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol v2 TLV types
+const (
+	ProxyProtoTLVALPN      byte = 0x01
+	ProxyProtoTLVAuthority byte = 0x02
+	ProxyProtoTLVCRC32C    byte = 0x03
+	ProxyProtoTLVNoop      byte = 0x04
+	ProxyProtoTLVUniqueID  byte = 0x05
+	ProxyProtoTLVSSL       byte = 0x20
+	ProxyProtoTLVNetNS     byte = 0x30
+	// ProxyProtoTLVAWS is AWS specific TLV, subtype 0x01 is VPC endpoint ID
+	ProxyProtoTLVAWS byte = 0xEA
+	// ProxyProtoTLVAzure is Azure specific TLV, subtype 0x01 is private endpoint link ID
+	ProxyProtoTLVAzure byte = 0xEE
+)
+
+var proxyProtoV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// DefaultProxyProtoHeaderTimeout is the default time to wait for PROXY protocol header
+const DefaultProxyProtoHeaderTimeout = 10 * time.Second
+
+// ProxyProtoTLV is a type-length-value extension of PROXY protocol v2 header
+type ProxyProtoTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyProtoHeader is a parsed PROXY protocol header
+type ProxyProtoHeader struct {
+	// Version is 1 for text and 2 for binary header
+	Version int
+	// Local is true for v2 LOCAL command (health checks from the balancer itself),
+	// addresses are not set in this case
+	Local bool
+	// SourceAddr is the real client address, nil if unknown
+	SourceAddr net.Addr
+	// DestinationAddr is the address the client connected to, nil if unknown
+	DestinationAddr net.Addr
+	// TLVs are v2 extensions
+	TLVs []ProxyProtoTLV
+}
+
+// AWSVPCEndpointID returns VPC endpoint ID passed by AWS Network Load Balancer, if present
+func (h *ProxyProtoHeader) AWSVPCEndpointID() string {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == ProxyProtoTLVAWS && len(tlv.Value) > 1 && tlv.Value[0] == 0x01 {
+			return string(tlv.Value[1:])
+		}
+	}
+	return ""
+}
+
+// ProxyProtoListener wraps net.Listener and reads PROXY protocol v1/v2 header sent by
+// TCP load balancers (HAProxy, AWS NLB, etc.) from every accepted connection.
+// Connection's RemoteAddr returns the real client address from the header,
+// so Request.RemoteAddr and Proxy.ClientIP use it automatically.
+// Headers are accepted only from upstreams, other connections are passed as is.
+type ProxyProtoListener struct {
+	net.Listener
+	// HeaderTimeout limits the time to read the header.
+	// Default: DefaultProxyProtoHeaderTimeout
+	HeaderTimeout time.Duration
+	upstreams     []*net.IPNet
+}
+
+// NewProxyProtoListener creates a listener accepting PROXY protocol headers from upstream networks (CIDR or single IP)
+func NewProxyProtoListener(l net.Listener, upstreams []string) (*ProxyProtoListener, error) {
+	if len(upstreams) == 0 {
+		return nil, errors.New("proxy protocol: at least one upstream is required")
+	}
+	cidrs, err := parseCIDRs(upstreams)
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	return &ProxyProtoListener{
+		Listener:  l,
+		upstreams: cidrs,
+	}, nil
+}
+
+// Accept waits for and returns the next connection.
+// The header is read lazily in connection's goroutine, so slow upstreams don't block the accept loop.
+func (l *ProxyProtoListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isUpstream(c.RemoteAddr()) {
+		return c, nil
+	}
+	timeout := l.HeaderTimeout
+	if timeout == 0 {
+		timeout = DefaultProxyProtoHeaderTimeout
+	}
+	return &ProxyProtoConn{
+		Conn:    c,
+		reader:  bufio.NewReader(c),
+		timeout: timeout,
+	}, nil
+}
+
+func (l *ProxyProtoListener) isUpstream(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, cidr := range l.upstreams {
+		if cidr.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyProtoConn is a connection from upstream, which may start with PROXY protocol header
+type ProxyProtoConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	once    sync.Once
+	header  *ProxyProtoHeader
+	err     error
+}
+
+func (c *ProxyProtoConn) readHeader() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.header, c.err = readProxyProtoHeader(c.reader)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+// Header returns parsed PROXY protocol header, nil if upstream has not sent it
+func (c *ProxyProtoConn) Header() (*ProxyProtoHeader, error) {
+	c.readHeader()
+	return c.header, c.err
+}
+
+// Read reads data after the header
+func (c *ProxyProtoConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the header if present
+func (c *ProxyProtoConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to from the header if present
+func (c *ProxyProtoConn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.DestinationAddr != nil {
+		return c.header.DestinationAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+type proxyProtoContextKey struct{}
+
+// ProxyProtoConnContext stores PROXY protocol connection in connection context,
+// use it as http.Server.ConnContext to get the header in handlers with ProxyProtoHeaderFromContext.
+// ConnContext runs in the accept loop, so the header is not read here, but in the connection's goroutine.
+func ProxyProtoConnContext(ctx context.Context, c net.Conn) context.Context {
+	if nc, ok := c.(interface{ NetConn() net.Conn }); ok {
+		c = nc.NetConn() // unwrap *tls.Conn
+	}
+	if pc, ok := c.(*ProxyProtoConn); ok {
+		return context.WithValue(ctx, proxyProtoContextKey{}, pc)
+	}
+	return ctx
+}
+
+// ProxyProtoHeaderFromContext returns PROXY protocol header of the connection stored by ProxyProtoConnContext,
+// nil if absent or invalid
+func ProxyProtoHeaderFromContext(ctx context.Context) *ProxyProtoHeader {
+	pc, ok := ctx.Value(proxyProtoContextKey{}).(*ProxyProtoConn)
+	if !ok {
+		return nil
+	}
+	h, err := pc.Header()
+	if err != nil {
+		return nil
+	}
+	return h
+}
+
+// readProxyProtoHeader reads v1 or v2 header, returns nil header if the stream has no header
+func readProxyProtoHeader(r *bufio.Reader) (*ProxyProtoHeader, error) {
+	peek, err := r.Peek(len(proxyProtoV2Signature))
+	if bytes.Equal(peek, proxyProtoV2Signature) {
+		return readProxyProtoV2(r)
+	}
+	if bytes.HasPrefix(peek, []byte("PROXY ")) {
+		return readProxyProtoV1(r)
+	}
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) && len(peek) == 0 {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// readProxyProtoV1 parses "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+func readProxyProtoV1(r *bufio.Reader) (*ProxyProtoHeader, error) {
+	// v1 header is at most 107 bytes including CRLF
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("proxy protocol v1: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxy protocol v1: header is too long or not terminated with CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	h := &ProxyProtoHeader{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("proxy protocol v1: invalid header '%s'", strings.TrimSpace(string(line)))
+	}
+
+	src, err := parseProxyProtoV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseProxyProtoV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	h.SourceAddr, h.DestinationAddr = src, dst
+	return h, nil
+}
+
+func parseProxyProtoV1Addr(ipStr, portStr string, v4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(ipStr)
+	if ip == nil || (ip.To4() != nil) != v4 {
+		return nil, fmt.Errorf("proxy protocol v1: invalid address '%s'", ipStr)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol v1: invalid port '%s'", portStr)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyProtoV2 parses binary header
+func readProxyProtoV2(r *bufio.Reader) (*ProxyProtoHeader, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("proxy protocol v2: %w", err)
+	}
+	verCmd, family := fixed[12], fixed[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("proxy protocol v2: unsupported version %d", verCmd>>4)
+	}
+	cmd := verCmd & 0x0f
+	if cmd > 1 {
+		return nil, fmt.Errorf("proxy protocol v2: unsupported command %d", cmd)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("proxy protocol v2: %w", err)
+	}
+
+	h := &ProxyProtoHeader{Version: 2, Local: cmd == 0}
+
+	var addrLen int
+	switch family >> 4 {
+	case 0x1: // IPv4
+		addrLen = 12
+	case 0x2: // IPv6
+		addrLen = 36
+	case 0x3: // unix
+		addrLen = 216
+	}
+	if len(payload) < addrLen {
+		return nil, errors.New("proxy protocol v2: address block is truncated")
+	}
+
+	// LOCAL command and unspecified or unix families have no usable client address
+	if !h.Local && family&0x0f == 0x1 {
+		switch family >> 4 {
+		case 0x1:
+			h.SourceAddr = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+			h.DestinationAddr = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+		case 0x2:
+			h.SourceAddr = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+			h.DestinationAddr = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+		}
+	}
+
+	tlvs := payload[addrLen:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, errors.New("proxy protocol v2: TLV is truncated")
+		}
+		l := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+l {
+			return nil, errors.New("proxy protocol v2: TLV is truncated")
+		}
+		h.TLVs = append(h.TLVs, ProxyProtoTLV{Type: tlvs[0], Value: tlvs[3 : 3+l]})
+		tlvs = tlvs[3+l:]
+	}
+	return h, nil
+}
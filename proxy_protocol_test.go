@@ -0,0 +1,191 @@
+package httplog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func proxyProtoV2Header(cmd, family byte, addr []byte, tlvs ...ProxyProtoTLV) []byte {
+	payload := append([]byte{}, addr...)
+	for _, tlv := range tlvs {
+		payload = append(payload, tlv.Type)
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(tlv.Value)))
+		payload = append(payload, tlv.Value...)
+	}
+	h := append([]byte{}, proxyProtoV2Signature...)
+	h = append(h, 0x20|cmd, family)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(payload)))
+	return append(h, payload...)
+}
+
+func TestReadProxyProtoV1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nGET / HTTP/1.1\r\n"))
+	h, err := readProxyProtoHeader(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, h.Version)
+	assert.Equal(t, "192.0.2.1:56324", h.SourceAddr.String())
+	assert.Equal(t, "192.0.2.2:443", h.DestinationAddr.String())
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+
+	h, err = readProxyProtoHeader(bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:56324", h.SourceAddr.String())
+
+	h, err = readProxyProtoHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")))
+	assert.NoError(t, err)
+	assert.Nil(t, h.SourceAddr)
+
+	_, err = readProxyProtoHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 2001:db8::1 192.0.2.2 56324 443\r\n")))
+	assert.Error(t, err)
+	_, err = readProxyProtoHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 192.0.2.2 56324\r\n")))
+	assert.Error(t, err)
+	_, err = readProxyProtoHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443" + strings.Repeat(" ", 100) + "\r\n")))
+	assert.Error(t, err)
+
+	// no header
+	h, err = readProxyProtoHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n")))
+	assert.NoError(t, err)
+	assert.Nil(t, h)
+}
+
+func TestReadProxyProtoV2(t *testing.T) {
+	addr := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0x01, 0xbb}
+	data := proxyProtoV2Header(0x1, 0x11, addr,
+		ProxyProtoTLV{Type: ProxyProtoTLVAWS, Value: append([]byte{0x01}, "vpce-08d2bf15fac5001c9"...)},
+		ProxyProtoTLV{Type: ProxyProtoTLVNoop, Value: []byte{}},
+	)
+	r := bufio.NewReader(bytes.NewReader(append(data, "GET /"...)))
+	h, err := readProxyProtoHeader(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, h.Version)
+	assert.False(t, h.Local)
+	assert.Equal(t, "192.0.2.1:56324", h.SourceAddr.String())
+	assert.Equal(t, "192.0.2.2:443", h.DestinationAddr.String())
+	assert.Equal(t, "vpce-08d2bf15fac5001c9", h.AWSVPCEndpointID())
+	assert.Len(t, h.TLVs, 2)
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "GET /", string(rest))
+
+	addr6 := make([]byte, 36)
+	copy(addr6, net.ParseIP("2001:db8::1"))
+	copy(addr6[16:], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(addr6[32:], 1234)
+	h, err = readProxyProtoHeader(bufio.NewReader(bytes.NewReader(proxyProtoV2Header(0x1, 0x21, addr6))))
+	assert.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:1234", h.SourceAddr.String())
+
+	// LOCAL command from balancer health checks
+	h, err = readProxyProtoHeader(bufio.NewReader(bytes.NewReader(proxyProtoV2Header(0x0, 0x00, nil))))
+	assert.NoError(t, err)
+	assert.True(t, h.Local)
+	assert.Nil(t, h.SourceAddr)
+
+	// truncated address and TLV
+	_, err = readProxyProtoHeader(bufio.NewReader(bytes.NewReader(proxyProtoV2Header(0x1, 0x11, addr[:8]))))
+	assert.Error(t, err)
+	_, err = readProxyProtoHeader(bufio.NewReader(bytes.NewReader(proxyProtoV2Header(0x1, 0x11, append(addr, 0x04, 0x00)))))
+	assert.Error(t, err)
+}
+
+func TestProxyProtoListener(t *testing.T) {
+	_, err := NewProxyProtoListener(nil, nil)
+	assert.Error(t, err)
+	_, err = NewProxyProtoListener(nil, []string{"bad"})
+	assert.Error(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on loopback:", err)
+	}
+	ppl, err := NewProxyProtoListener(ln, []string{"127.0.0.1"})
+	assert.NoError(t, err)
+
+	var gotParam LogFormatterParams
+	var vpce string
+	done := make(chan struct{}, 1)
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output: io.Discard,
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			done <- struct{}{}
+			return ""
+		},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := ProxyProtoHeaderFromContext(r.Context()); h != nil {
+			vpce = h.AWSVPCEndpointID()
+		}
+	}))
+	server := &http.Server{Handler: logger, ConnContext: ProxyProtoConnContext, ReadHeaderTimeout: time.Second}
+	go func() { _ = server.Serve(ppl) }()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	addr := []byte{203, 0, 113, 7, 127, 0, 0, 1, 0x30, 0x39, 0x01, 0xbb}
+	_, _ = conn.Write(proxyProtoV2Header(0x1, 0x11, addr, ProxyProtoTLV{Type: ProxyProtoTLVAWS, Value: []byte("\x01vpce-123")}))
+	_, _ = fmt.Fprint(conn, "GET /pp HTTP/1.1\r\nHost: example.com\r\n\r\n")
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not logged")
+	}
+	assert.Equal(t, "203.0.113.7", gotParam.ClientIP)
+	assert.Equal(t, "vpce-123", vpce)
+}
+
+func TestProxyProtoConnContextDoesNotBlockAccept(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on loopback:", err)
+	}
+	ppl, err := NewProxyProtoListener(ln, []string{"127.0.0.1"})
+	assert.NoError(t, err)
+	ppl.HeaderTimeout = 5 * time.Second
+
+	var client string
+	done := make(chan struct{}, 1)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h := ProxyProtoHeaderFromContext(r.Context()); h != nil {
+				client = h.SourceAddr.String()
+			}
+			done <- struct{}{}
+		}),
+		ConnContext:       ProxyProtoConnContext,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() { _ = server.Serve(ppl) }()
+	defer server.Close()
+
+	// idle upstream connection, which never sends the header
+	idle, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer idle.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, _ = fmt.Fprint(conn, "PROXY TCP4 198.51.100.22 127.0.0.1 35646 80\r\nGET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection blocked the accept loop")
+	}
+	assert.Equal(t, "198.51.100.22:35646", client)
+}
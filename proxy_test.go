@@ -4,8 +4,12 @@ package httplog_test
 // Use of this source code is governed by a MIT style
 // license that can be found in the LICENSE file.
 import (
+	"bytes"
 	"context"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/MadAppGang/httplog/v2"
@@ -91,3 +95,294 @@ func TestContextClientIP(t *testing.T) {
 	assert.NotEmpty(t, dp.ClientIP(request))
 	assert.Equal(t, "119.18.0.222", customProxy.ClientIP(request))
 }
+
+func TestClientIPTrustedProxies(t *testing.T) {
+	request, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	request.Header.Set("X-Forwarded-For", "1.1.1.1, 20.20.20.20, 10.0.0.5")
+	request.RemoteAddr = "10.0.0.1:1234"
+
+	p := httplog.NewProxy()
+	assert.NoError(t, p.SetTrustedProxies([]string{"10.0.0.0/8"}))
+
+	// right-to-left walk stops on the first untrusted hop, 1.1.1.1 could be spoofed by client
+	assert.Equal(t, "20.20.20.20", p.ClientIP(request))
+
+	// all hops are trusted, the leftmost one is the client
+	request.Header.Set("X-Forwarded-For", "10.1.1.1, 10.0.0.5")
+	assert.Equal(t, "10.1.1.1", p.ClientIP(request))
+
+	// invalid entry in the chain
+	request.Header.Set("X-Forwarded-For", "1.1.1.1, blah, 10.0.0.5")
+	request.Header.Del("X-Real-IP")
+	assert.Equal(t, "10.0.0.1", p.ClientIP(request))
+
+	// headers from untrusted peer are ignored
+	request.Header.Set("X-Forwarded-For", "1.1.1.1")
+	request.Header.Set("X-Real-IP", "2.2.2.2")
+	request.RemoteAddr = "40.40.40.40:1234"
+	assert.Equal(t, "40.40.40.40", p.ClientIP(request))
+
+	// platform header is trusted only from trusted peer as well
+	cf := httplog.NewProxyWithType(httplog.ProxyCloudflare)
+	assert.NoError(t, cf.SetTrustedProxies([]string{"173.245.48.0/20", "2400:cb00::/32"}))
+	request.Header.Set("CF-Connecting-IP", "60.60.60.60")
+	assert.Equal(t, "40.40.40.40", cf.ClientIP(request))
+	request.RemoteAddr = "173.245.48.1:443"
+	assert.Equal(t, "60.60.60.60", cf.ClientIP(request))
+	request.RemoteAddr = "[2400:cb00::1]:443"
+	assert.Equal(t, "60.60.60.60", cf.ClientIP(request))
+
+	// single IPs are accepted
+	assert.NoError(t, p.SetTrustedProxies([]string{"40.40.40.40", "::1"}))
+	request.RemoteAddr = "40.40.40.40:1234"
+	assert.Equal(t, "1.1.1.1", p.ClientIP(request))
+
+	assert.Error(t, p.SetTrustedProxies([]string{"10.0.0.0/33"}))
+	assert.Error(t, p.SetTrustedProxies([]string{"not an ip"}))
+}
+
+func TestClientIPPeerWithoutIP(t *testing.T) {
+	request, _ := http.NewRequestWithContext(context.Background(), "GET", "/", nil)
+	request.Header.Set("X-Forwarded-For", "1.1.1.1")
+
+	// unix socket peers are trusted by default
+	p := httplog.NewProxy()
+	request.RemoteAddr = "@"
+	assert.Equal(t, "1.1.1.1", p.ClientIP(request))
+	request.RemoteAddr = ""
+	assert.Equal(t, "1.1.1.1", p.ClientIP(request))
+
+	// and never trusted with trusted proxies set
+	assert.NoError(t, p.SetTrustedProxies([]string{"10.0.0.0/8"}))
+	request.RemoteAddr = "@"
+	assert.Equal(t, "@", p.ClientIP(request))
+	request.Header.Del("X-Forwarded-For")
+	request.RemoteAddr = ""
+	assert.Equal(t, "", p.ClientIP(request))
+}
+
+func TestLoggerConfigTrustedProxies(t *testing.T) {
+	var clientIP string
+	proxy := httplog.NewProxy()
+	logger, err := httplog.HandlerWithConfig(httplog.LoggerConfig{
+		Output:         new(bytes.Buffer),
+		ProxyHandler:   proxy,
+		TrustedProxies: []string{"10.0.0.0/8"},
+		Formatter: func(param httplog.LogFormatterParams) string {
+			clientIP = param.ClientIP
+			return ""
+		},
+	}, http.NotFoundHandler())
+	assert.NoError(t, err)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "40.40.40.40:1234"
+	request.Header.Set("X-Forwarded-For", "1.1.1.1")
+	logger.ServeHTTP(httptest.NewRecorder(), request)
+	assert.Equal(t, "40.40.40.40", clientIP)
+
+	request.RemoteAddr = "10.0.0.1:1234"
+	logger.ServeHTTP(httptest.NewRecorder(), request)
+	assert.Equal(t, "1.1.1.1", clientIP)
+
+	// original proxy is not modified
+	request.RemoteAddr = "40.40.40.40:1234"
+	assert.Equal(t, "1.1.1.1", proxy.ClientIP(request))
+
+	_, err = httplog.LoggerWithConfig(httplog.LoggerConfig{TrustedProxies: []string{"bad"}})
+	assert.Error(t, err)
+}
+
+func TestClientIPPresets(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Forwarded-For", "20.20.20.20")
+
+	tests := []struct {
+		preset   httplog.ProxyPreset
+		header   string
+		value    string
+		remote   string
+		expected string
+	}{
+		{httplog.PresetCloudflare, "CF-Connecting-IP", "1.1.1.1", "173.245.48.10:443", "1.1.1.1"},
+		{httplog.PresetCloudflare, "CF-Connecting-IP", "1.1.1.1", "40.40.40.40:443", "40.40.40.40"},
+		{httplog.PresetFastly, "Fastly-Client-IP", "1.1.1.1", "[2a04:4e42::1]:443", "1.1.1.1"},
+		{httplog.PresetFastly, "Fastly-Client-IP", "1.1.1.1", "40.40.40.40:443", "40.40.40.40"},
+		{httplog.PresetAWSCloudFront, "CloudFront-Viewer-Address", "198.51.100.10:46532", "40.40.40.40:443", "198.51.100.10"},
+		{httplog.PresetAWSCloudFront, "CloudFront-Viewer-Address", "2001:db8::1:46532", "40.40.40.40:443", "2001:db8::1"},
+		{httplog.PresetAWSCloudFront, "CloudFront-Viewer-Address", "[2001:db8::2]:46532", "40.40.40.40:443", "2001:db8::2"},
+		{httplog.PresetAWSALB, "X-Forwarded-For", "1.1.1.1, 2.2.2.2", "10.0.0.1:443", "1.1.1.1"},
+		{httplog.PresetAkamai, "True-Client-IP", "1.1.1.1", "40.40.40.40:443", "1.1.1.1"},
+		{httplog.PresetFlyIO, "Fly-Client-IP", "1.1.1.1", "40.40.40.40:443", "1.1.1.1"},
+		{httplog.PresetAzureFrontDoor, "X-Azure-ClientIP", "1.1.1.1", "40.40.40.40:443", "1.1.1.1"},
+		{httplog.PresetVercel, "X-Vercel-Forwarded-For", "1.1.1.1", "40.40.40.40:443", "1.1.1.1"},
+		// invalid value falls back to default headers
+		{httplog.PresetAkamai, "True-Client-IP", "blah", "40.40.40.40:443", "20.20.20.20"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.preset.Type)+" "+tt.remote, func(t *testing.T) {
+			r := request.Clone(request.Context())
+			r.Header.Set(tt.header, tt.value)
+			r.RemoteAddr = tt.remote
+			p, err := httplog.NewProxyWithPreset(tt.preset)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, p.ClientIP(r))
+		})
+	}
+}
+
+func TestPresetsNeedTrustedProxies(t *testing.T) {
+	alb, err := httplog.NewProxyWithPreset(httplog.PresetAWSALB)
+	assert.NoError(t, err)
+	_, err = httplog.LoggerWithConfig(httplog.LoggerConfig{ProxyHandler: alb})
+	assert.ErrorContains(t, err, "invalid ProxyHandler")
+
+	_, err = httplog.LoggerWithConfig(httplog.LoggerConfig{ProxyHandler: alb, TrustedProxies: []string{"10.0.0.0/8"}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, alb.SetTrustedProxies([]string{"10.0.0.0/8"}))
+	_, err = httplog.LoggerWithConfig(httplog.LoggerConfig{ProxyHandler: alb})
+	assert.NoError(t, err)
+
+	// presets with edge ranges are fine as is
+	cf, err := httplog.NewProxyWithPreset(httplog.PresetCloudflare)
+	assert.NoError(t, err)
+	_, err = httplog.LoggerWithConfig(httplog.LoggerConfig{ProxyHandler: cf})
+	assert.NoError(t, err)
+}
+
+func TestLoadEdgeRanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranges.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# edge nodes\n50.50.50.0/24\n\n2001:db8::/32\n60.60.60.60\n"), 0o600))
+
+	ranges, err := httplog.LoadEdgeRanges(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"50.50.50.0/24", "2001:db8::/32", "60.60.60.60"}, ranges)
+
+	preset, err := httplog.PresetFastly.WithEdgeRangesFromFile(path)
+	assert.NoError(t, err)
+	p, err := httplog.NewProxyWithPreset(preset)
+	assert.NoError(t, err)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Fastly-Client-IP", "1.1.1.1")
+	request.RemoteAddr = "50.50.50.1:443"
+	assert.Equal(t, "1.1.1.1", p.ClientIP(request))
+	request.RemoteAddr = "151.101.0.1:443"
+	assert.Equal(t, "151.101.0.1", p.ClientIP(request))
+
+	assert.NoError(t, os.WriteFile(path, []byte("50.50.50.0/33\n"), 0o600))
+	_, err = httplog.LoadEdgeRanges(path)
+	assert.ErrorContains(t, err, ":1:")
+
+	_, err = httplog.LoadEdgeRanges(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestProxyOrigin(t *testing.T) {
+	request := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	p := httplog.NewProxy()
+
+	scheme, host := p.Origin(request)
+	assert.Equal(t, "http", scheme)
+	assert.Equal(t, "internal:8080", host)
+
+	request.Header.Set("X-Forwarded-Proto", "HTTPS")
+	request.Header.Set("X-Forwarded-Host", "api.example.com")
+	scheme, host = p.Origin(request)
+	assert.Equal(t, "https", scheme)
+	assert.Equal(t, "api.example.com", host)
+
+	// default port is not shown
+	request.Header.Set("X-Forwarded-Port", "443")
+	_, host = p.Origin(request)
+	assert.Equal(t, "api.example.com", host)
+
+	request.Header.Set("X-Forwarded-Port", "8443")
+	_, host = p.Origin(request)
+	assert.Equal(t, "api.example.com:8443", host)
+
+	// Forwarded header wins
+	request.Header.Set("Forwarded", `for=1.1.1.1;proto=http;host="[2001:db8::1]:8000"`)
+	request.Header.Del("X-Forwarded-Port")
+	scheme, host = p.Origin(request)
+	assert.Equal(t, "http", scheme)
+	assert.Equal(t, "[2001:db8::1]:8000", host)
+	request.Header.Del("Forwarded")
+
+	// invalid values are ignored
+	request.Header.Set("X-Forwarded-Proto", "ht tp")
+	request.Header.Set("X-Forwarded-Host", "evil.com/path")
+	scheme, host = p.Origin(request)
+	assert.Equal(t, "http", scheme)
+	assert.Equal(t, "internal:8080", host)
+
+	// untrusted peer
+	assert.NoError(t, p.SetTrustedProxies([]string{"192.168.0.0/16"}))
+	request.Header.Set("X-Forwarded-Proto", "https")
+	request.Header.Set("X-Forwarded-Host", "api.example.com")
+	scheme, host = p.Origin(request)
+	assert.Equal(t, "http", scheme)
+	assert.Equal(t, "internal:8080", host)
+}
+
+func TestProxyOriginTrustedHops(t *testing.T) {
+	request := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	p := httplog.NewProxy()
+	assert.NoError(t, p.SetTrustedProxies([]string{"10.0.0.0/8"}))
+
+	// client sent the leftmost values, edge proxy 10.0.0.5 appended client's ones, inner proxy appended the edge's ones
+	request.Header.Set("X-Forwarded-For", "6.6.6.6, 1.1.1.1, 10.0.0.5")
+	request.Header.Set("X-Forwarded-Proto", "http, https, http")
+	request.Header.Set("X-Forwarded-Host", "evil.com, api.example.com, internal")
+	request.Header.Set("X-Forwarded-Port", "1, 443, 8080")
+	scheme, host := p.Origin(request)
+	assert.Equal(t, "https", scheme)
+	assert.Equal(t, "api.example.com", host)
+
+	// without X-Forwarded-For the peer appended the rightmost value
+	request.Header.Del("X-Forwarded-For")
+	request.Header.Del("X-Forwarded-Port")
+	scheme, host = p.Origin(request)
+	assert.Equal(t, "http", scheme)
+	assert.Equal(t, "internal", host)
+
+	// edge proxy overwrote the value and inner proxies kept it
+	request.Header.Set("X-Forwarded-For", "1.1.1.1, 10.0.0.5")
+	request.Header.Set("X-Forwarded-Proto", "https")
+	request.Header.Set("X-Forwarded-Host", "api.example.com")
+	scheme, host = p.Origin(request)
+	assert.Equal(t, "https", scheme)
+	assert.Equal(t, "api.example.com", host)
+}
+
+func TestLoggerFullURL(t *testing.T) {
+	var gotParam httplog.LogFormatterParams
+	buffer := new(bytes.Buffer)
+	logger, _ := httplog.HandlerWithConfig(httplog.LoggerConfig{
+		Output: buffer,
+		Formatter: func(param httplog.LogFormatterParams) string {
+			gotParam = param
+			return httplog.DefaultLogFormatter(param)
+		},
+	}, http.NotFoundHandler())
+
+	request := httptest.NewRequest("GET", "/users?id=1", nil)
+	request.Header.Set("X-Forwarded-Proto", "https")
+	request.Header.Set("X-Forwarded-Host", "api.example.com")
+	logger.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(t, "https", gotParam.Scheme)
+	assert.Equal(t, "api.example.com", gotParam.Host)
+	assert.Equal(t, "https://api.example.com/users?id=1", gotParam.FullURL)
+	assert.Contains(t, buffer.String(), `"https://api.example.com/users?id=1"`)
+
+	// without proxy headers the path is logged as before
+	buffer.Reset()
+	logger.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users?id=1", nil))
+	assert.Equal(t, "http://example.com/users?id=1", gotParam.FullURL)
+	assert.Contains(t, buffer.String(), `"/users?id=1"`)
+}
@@ -5,21 +5,21 @@ package httplog
 // license that can be found in the LICENSE file.
 
 import (
-	"bufio"
-	"errors"
-	"io"
-	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 // ResponseWriter is a wrapper around http.ResponseWriter that provides extra information about
 // the response. It is recommended that middleware handlers use this construct to wrap a responsewriter
 // if the functionality calls for it.
+//
+// It implements http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom only if the wrapped writer does,
+// so capability checks like w.(http.Hijacker) give correct answers.
+// Other features, like SetWriteDeadline and EnableFullDuplex, are available with http.NewResponseController.
 type ResponseWriter interface {
 	http.ResponseWriter
-	http.Hijacker
-	http.Flusher
-	http.Pusher
 	// Status returns the status code of the response or 0 if the response has
 	// not been written
 	Status() int
@@ -36,6 +36,21 @@ type ResponseWriter interface {
 	Body() []byte
 	// Manually set Status and Size if you need, written is set as well after call
 	Set(status, size int)
+	// FirstByte returns the time of the first WriteHeader or Write call, including 1xx responses,
+	// zero time if nothing has been written
+	FirstByte() time.Time
+	// Flushes returns the number of Flush calls passed to the underlying writer
+	Flushes() int
+	// Informational returns 1xx status codes sent before the final response, e.g. 103 Early Hints
+	Informational() []int
+	// Trailer returns HTTP trailers set by the handler, declared with "Trailer" header
+	// or set with http.TrailerPrefix
+	Trailer() http.Header
+	// Err returns the first error returned by the underlying Write or ReadFrom,
+	// e.g. broken pipe when the client has gone away
+	Err() error
+	// Unwrap returns the wrapped http.ResponseWriter, used by http.ResponseController
+	Unwrap() http.ResponseWriter
 }
 
 type beforeFunc func(ResponseWriter)
@@ -46,19 +61,20 @@ func NewResponseWriter(rw http.ResponseWriter) ResponseWriter {
 }
 
 // NewResponseWriterWithBody creates a ResponseWriter that wraps an http.ResponseWriter
-// and copy the body of response. The body is not copied if you use ReadFrom for obvious reason
+// and copy the body of response
 func NewResponseWriterWithBody(rw http.ResponseWriter) ResponseWriter {
 	return NewWriter(rw, true)
 }
 
-// NewWriter creates a ResponseWriter that wraps an http.ResponseWriter and optionaly capture body
+// NewWriter creates a ResponseWriter that wraps an http.ResponseWriter and optionaly capture body.
+// The result implements the same optional interfaces as rw.
 func NewWriter(rw http.ResponseWriter, captureBody bool) ResponseWriter {
 	nrw := &responseWriter{
 		ResponseWriter: rw,
 		copyBody:       captureBody,
 	}
-
-	return nrw
+	nrw.outer = wrapCapabilities(nrw)
+	return nrw.outer
 }
 
 type responseWriter struct {
@@ -68,12 +84,60 @@ type responseWriter struct {
 	beforeFuncs []beforeFunc
 	body        []byte
 	copyBody    bool
+	err         error
+
+	firstByte     time.Time
+	flushes       int
+	informational []int
+
+	// outer is nrw with the optional interfaces of the wrapped writer, passed to before funcs
+	outer ResponseWriter
+	// wrapped caches outer for every combination of optional interfaces
+	wrapped [capCombinations]ResponseWriter
+}
+
+var writerPool = sync.Pool{
+	New: func() any { return new(responseWriter) },
+}
+
+// acquireWriter returns pooled writer for middleware, pass outer to the handler
+// and call release after the handler returns
+func acquireWriter(rw http.ResponseWriter, captureBody bool) *responseWriter {
+	w := writerPool.Get().(*responseWriter)
+	w.reset()
+	w.ResponseWriter = rw
+	w.copyBody = captureBody
+	w.outer = wrapCapabilities(w)
+	return w
+}
+
+// release returns writer to the pool. Its state stays readable until the writer is reused,
+// like http.ResponseWriter it must not be used after the handler returns.
+func (rw *responseWriter) release() {
+	writerPool.Put(rw)
+}
+
+// reset clears the state of the previous request. Body and Informational slices are not reused,
+// as they could be still referenced by async log entries.
+func (rw *responseWriter) reset() {
+	clear(rw.beforeFuncs)
+	*rw = responseWriter{
+		beforeFuncs: rw.beforeFuncs[:0],
+		wrapped:     rw.wrapped,
+	}
 }
 
 func (rw *responseWriter) WriteHeader(s int) {
 	if rw.Written() {
 		return
 	}
+	rw.markFirstByte()
+	// informational responses could be sent several times before the final one
+	if s >= 100 && s < 200 && s != http.StatusSwitchingProtocols {
+		rw.informational = append(rw.informational, s)
+		rw.ResponseWriter.WriteHeader(s)
+		return
+	}
 	rw.status = s
 	rw.callBefore()
 	rw.ResponseWriter.WriteHeader(s)
@@ -86,25 +150,15 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	}
 	size, err := rw.ResponseWriter.Write(b)
 	rw.size += size
+	if err != nil && rw.err == nil {
+		rw.err = err
+	}
 	if rw.copyBody {
 		rw.body = append(rw.body, b...)
 	}
 	return size, err
 }
 
-// ReadFrom exposes underlying http.ResponseWriter to io.Copy and if it implements
-// io.ReaderFrom, it can take advantage of optimizations such as sendfile, io.Copy
-// with sync.Pool's buffer which is in http.(*response).ReadFrom and so on.
-func (rw *responseWriter) ReadFrom(r io.Reader) (n int64, err error) {
-	if !rw.Written() {
-		// The status will be StatusOK if WriteHeader has not been called yet
-		rw.WriteHeader(http.StatusOK)
-	}
-	n, err = io.Copy(rw.ResponseWriter, r)
-	rw.size += int(n)
-	return
-}
-
 func (rw *responseWriter) Status() int {
 	return rw.status
 }
@@ -113,6 +167,53 @@ func (rw *responseWriter) Size() int {
 	return rw.size
 }
 
+func (rw *responseWriter) Err() error {
+	return rw.err
+}
+
+func (rw *responseWriter) FirstByte() time.Time {
+	return rw.firstByte
+}
+
+func (rw *responseWriter) Flushes() int {
+	return rw.flushes
+}
+
+func (rw *responseWriter) Informational() []int {
+	return rw.informational
+}
+
+func (rw *responseWriter) Trailer() http.Header {
+	h := rw.Header()
+	var trailer http.Header
+	add := func(key string, values []string) {
+		if trailer == nil {
+			trailer = http.Header{}
+		}
+		trailer[http.CanonicalHeaderKey(key)] = values
+	}
+	for _, declared := range h.Values("Trailer") {
+		for _, key := range strings.Split(declared, ",") {
+			key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+			if values, ok := h[key]; ok {
+				add(key, values)
+			}
+		}
+	}
+	for key, values := range h {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			add(strings.TrimPrefix(key, http.TrailerPrefix), values)
+		}
+	}
+	return trailer
+}
+
+func (rw *responseWriter) markFirstByte() {
+	if rw.firstByte.IsZero() {
+		rw.firstByte = time.Now()
+	}
+}
+
 func (rw *responseWriter) Written() bool {
 	return rw.status != 0
 }
@@ -121,17 +222,9 @@ func (rw *responseWriter) Before(before func(ResponseWriter)) {
 	rw.beforeFuncs = append(rw.beforeFuncs, before)
 }
 
-func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
-	if !ok {
-		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
-	}
-	return hijacker.Hijack()
-}
-
 func (rw *responseWriter) callBefore() {
 	for i := len(rw.beforeFuncs) - 1; i >= 0; i-- {
-		rw.beforeFuncs[i](rw)
+		rw.beforeFuncs[i](rw.outer)
 	}
 }
 
@@ -139,26 +232,19 @@ func (rw *responseWriter) Body() []byte {
 	return rw.body
 }
 
-func (rw *responseWriter) Flush() {
-	flusher, ok := rw.ResponseWriter.(http.Flusher)
-	if ok {
-		if !rw.Written() {
-			// The status will be StatusOK if WriteHeader has not been called yet
-			rw.WriteHeader(http.StatusOK)
-		}
-		flusher.Flush()
-	}
+func (w *responseWriter) Set(status, size int) {
+	w.status = status
+	w.size = size
 }
 
-func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
-	pusher, ok := rw.ResponseWriter.(http.Pusher)
-	if ok {
-		return pusher.Push(target, opts)
-	}
-	return errors.New("the ResponseWriter doesn't support the Pusher interface")
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
-func (w *responseWriter) Set(status, size int) {
-	w.status = status
-	w.size = size
+// bodyCapture appends everything written to the captured response body
+type bodyCapture struct{ *responseWriter }
+
+func (c bodyCapture) Write(b []byte) (int, error) {
+	c.body = append(c.body, b...)
+	return len(b), nil
 }
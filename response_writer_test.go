@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -155,13 +156,9 @@ func TestResponseWriterHijack(t *testing.T) {
 }
 
 func TestResponseWriteHijackNotOK(t *testing.T) {
-	hijackable := new(http.ResponseWriter)
-	rw := NewResponseWriter(*hijackable)
-	hijacker, ok := rw.(http.Hijacker)
-	assert.Equal(t, ok, true)
-	_, _, err := hijacker.Hijack()
-
-	assert.NotEqual(t, err, nil)
+	rw := NewResponseWriter(httptest.NewRecorder())
+	_, ok := rw.(http.Hijacker)
+	assert.Equal(t, ok, false)
 }
 
 func TestResponseWriterFlusher(t *testing.T) {
@@ -176,7 +173,7 @@ func TestResponseWriter_Flush_marksWritten(t *testing.T) {
 	rec := httptest.NewRecorder()
 	rw := NewResponseWriter(rec)
 
-	rw.Flush()
+	rw.(http.Flusher).Flush()
 	assert.Equal(t, rw.Status(), http.StatusOK)
 	assert.Equal(t, rw.Written(), true)
 }
@@ -239,3 +236,288 @@ func TestResponseWriterWithReadFrom(t *testing.T) {
 	assert.Equal(t, mrw.Body.String(), writeString)
 	assert.Equal(t, mrw.writtenStr, writeString)
 }
+
+func TestResponseWriterWithReadFromCapturesBody(t *testing.T) {
+	writeString := "Hello world"
+	mrw := &mockResponseWriterWithReadFrom{ResponseRecorder: httptest.NewRecorder()}
+	rw := NewResponseWriterWithBody(mrw)
+	n, err := io.Copy(rw, &mockReader{readStr: writeString})
+	assert.NoError(t, err)
+	assert.Equal(t, len(writeString), int(n))
+	assert.Equal(t, writeString, mrw.writtenStr)
+	assert.Equal(t, writeString, string(rw.Body()))
+	assert.Equal(t, len(writeString), rw.Size())
+}
+
+// capabilityWriter implements optional interfaces according to flags, see newCapabilityWriter
+type capabilityWriter struct {
+	*httptest.ResponseRecorder
+	calls []string
+}
+
+func (w *capabilityWriter) Flush() { w.calls = append(w.calls, "flush") }
+func (w *capabilityWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.calls = append(w.calls, "hijack")
+	return nil, nil, nil
+}
+func (w *capabilityWriter) Push(string, *http.PushOptions) error {
+	w.calls = append(w.calls, "push")
+	return nil
+}
+func (w *capabilityWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.calls = append(w.calls, "readfrom")
+	return io.Copy(w.ResponseRecorder, r)
+}
+
+// newCapabilityWriter hides methods of capabilityWriter which are not in caps
+func newCapabilityWriter(w *capabilityWriter, caps int) http.ResponseWriter {
+	type base struct{ http.ResponseWriter }
+	var (
+		f http.Flusher  = w
+		h http.Hijacker = w
+		p http.Pusher   = w
+		r io.ReaderFrom = w
+		b               = base{w}
+	)
+	switch caps {
+	case 0:
+		return b
+	case capFlusher:
+		return struct {
+			base
+			http.Flusher
+		}{b, f}
+	case capHijacker:
+		return struct {
+			base
+			http.Hijacker
+		}{b, h}
+	case capFlusher | capHijacker:
+		return struct {
+			base
+			http.Flusher
+			http.Hijacker
+		}{b, f, h}
+	case capPusher:
+		return struct {
+			base
+			http.Pusher
+		}{b, p}
+	case capFlusher | capPusher:
+		return struct {
+			base
+			http.Flusher
+			http.Pusher
+		}{b, f, p}
+	case capHijacker | capPusher:
+		return struct {
+			base
+			http.Hijacker
+			http.Pusher
+		}{b, h, p}
+	case capFlusher | capHijacker | capPusher:
+		return struct {
+			base
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{b, f, h, p}
+	case capReaderFrom:
+		return struct {
+			base
+			io.ReaderFrom
+		}{b, r}
+	case capFlusher | capReaderFrom:
+		return struct {
+			base
+			http.Flusher
+			io.ReaderFrom
+		}{b, f, r}
+	case capHijacker | capReaderFrom:
+		return struct {
+			base
+			http.Hijacker
+			io.ReaderFrom
+		}{b, h, r}
+	case capFlusher | capHijacker | capReaderFrom:
+		return struct {
+			base
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{b, f, h, r}
+	case capPusher | capReaderFrom:
+		return struct {
+			base
+			http.Pusher
+			io.ReaderFrom
+		}{b, p, r}
+	case capFlusher | capPusher | capReaderFrom:
+		return struct {
+			base
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{b, f, p, r}
+	case capHijacker | capPusher | capReaderFrom:
+		return struct {
+			base
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{b, h, p, r}
+	default:
+		return struct {
+			base
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{b, f, h, p, r}
+	}
+}
+
+func TestResponseWriterCapabilities(t *testing.T) {
+	for caps := 0; caps <= capFlusher|capHijacker|capPusher|capReaderFrom; caps++ {
+		cw := &capabilityWriter{ResponseRecorder: httptest.NewRecorder()}
+		underlying := newCapabilityWriter(cw, caps)
+		rw := NewResponseWriter(underlying)
+
+		f, isFlusher := rw.(http.Flusher)
+		h, isHijacker := rw.(http.Hijacker)
+		p, isPusher := rw.(http.Pusher)
+		r, isReaderFrom := rw.(io.ReaderFrom)
+		assert.Equal(t, caps&capFlusher != 0, isFlusher, "flusher, caps %04b", caps)
+		assert.Equal(t, caps&capHijacker != 0, isHijacker, "hijacker, caps %04b", caps)
+		assert.Equal(t, caps&capPusher != 0, isPusher, "pusher, caps %04b", caps)
+		assert.Equal(t, caps&capReaderFrom != 0, isReaderFrom, "readerfrom, caps %04b", caps)
+		assert.Equal(t, underlying, rw.Unwrap())
+
+		// calls reach the wrapped writer
+		var want []string
+		if isFlusher {
+			f.Flush()
+			want = append(want, "flush")
+		}
+		if isHijacker {
+			_, _, _ = h.Hijack()
+			want = append(want, "hijack")
+		}
+		if isPusher {
+			_ = p.Push("/style.css", nil)
+			want = append(want, "push")
+		}
+		if isReaderFrom {
+			_, _ = r.ReadFrom(&mockReader{readStr: "body"})
+			want = append(want, "readfrom")
+		}
+		assert.Equal(t, want, cw.calls, "caps %04b", caps)
+
+		// before funcs get the same capabilities
+		var before ResponseWriter
+		rw2 := NewResponseWriter(underlying)
+		rw2.Before(func(w ResponseWriter) { before = w })
+		rw2.WriteHeader(http.StatusOK)
+		_, beforeFlusher := before.(http.Flusher)
+		assert.Equal(t, isFlusher, beforeFlusher, "caps %04b", caps)
+	}
+}
+
+type deadlineWriter struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (w *deadlineWriter) SetWriteDeadline(d time.Time) error {
+	w.deadline = d
+	return nil
+}
+
+func TestResponseWriterResponseController(t *testing.T) {
+	dw := &deadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+	rw := NewResponseWriter(dw)
+
+	deadline := time.Now().Add(time.Minute)
+	err := http.NewResponseController(rw).SetWriteDeadline(deadline)
+	assert.NoError(t, err)
+	assert.Equal(t, deadline, dw.deadline)
+
+	// flush goes through the wrapper, so it's counted
+	assert.NoError(t, http.NewResponseController(rw).Flush())
+	assert.Equal(t, 1, rw.Flushes())
+}
+
+type failingResponse struct {
+	httptest.ResponseRecorder
+	err error
+}
+
+func (f *failingResponse) Write(buf []byte) (int, error) { return 0, f.err }
+
+func TestResponseWriterRecordsWriteError(t *testing.T) {
+	rw := NewResponseWriter(&failingResponse{ResponseRecorder: *httptest.NewRecorder(), err: io.ErrClosedPipe})
+	assert.NoError(t, rw.Err())
+
+	_, err := rw.Write([]byte("first"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	_, _ = rw.Write([]byte("second"))
+
+	assert.ErrorIs(t, rw.Err(), io.ErrClosedPipe)
+	assert.Equal(t, 0, rw.Size())
+}
+
+func TestResponseWriterInformational(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := NewResponseWriter(rec)
+	assert.True(t, rw.FirstByte().IsZero())
+
+	rw.Header().Set("Link", "</style.css>; rel=preload; as=style")
+	rw.WriteHeader(http.StatusEarlyHints)
+	assert.False(t, rw.Written())
+	assert.False(t, rw.FirstByte().IsZero())
+	first := rw.FirstByte()
+
+	rw.WriteHeader(http.StatusCreated)
+	_, _ = rw.Write([]byte("body"))
+
+	assert.Equal(t, []int{http.StatusEarlyHints}, rw.Informational())
+	assert.Equal(t, http.StatusCreated, rw.Status())
+	assert.Equal(t, first, rw.FirstByte())
+}
+
+func TestResponseWriterFlushes(t *testing.T) {
+	rw := NewResponseWriter(httptest.NewRecorder())
+	for i := 0; i < 3; i++ {
+		_, _ = rw.Write([]byte("chunk"))
+		rw.(http.Flusher).Flush()
+	}
+	assert.Equal(t, 3, rw.Flushes())
+
+	// writer without Flush doesn't pretend to support it
+	rw = NewResponseWriter(newResponseWithoutFlush())
+	_, ok := rw.(http.Flusher)
+	assert.False(t, ok)
+}
+
+func TestResponseWriterTrailer(t *testing.T) {
+	rw := NewResponseWriter(httptest.NewRecorder())
+	assert.Nil(t, rw.Trailer())
+
+	rw.Header().Set("Trailer", "X-Checksum, X-Missing")
+	_, _ = rw.Write([]byte("body"))
+	rw.Header().Set("X-Checksum", "abc")
+	rw.Header().Set(http.TrailerPrefix+"X-Duration", "12ms")
+
+	assert.Equal(t, http.Header{
+		"X-Checksum": {"abc"},
+		"X-Duration": {"12ms"},
+	}, rw.Trailer())
+}
+
+type responseWithoutFlush struct {
+	http.ResponseWriter
+}
+
+func newResponseWithoutFlush() http.ResponseWriter {
+	return responseWithoutFlush{httptest.NewRecorder()}
+}
@@ -0,0 +1,196 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// Each optional interface is implemented by a separate type embedding *responseWriter.
+// wrapCapabilities combines only the ones supported by the wrapped writer into an anonymous struct,
+// the base *responseWriter is embedded directly, so its methods win over the same methods of capability types.
+
+type flusher struct{ *responseWriter }
+
+func (w flusher) Flush() {
+	if !w.Written() {
+		// The status will be StatusOK if WriteHeader has not been called yet
+		w.WriteHeader(http.StatusOK)
+	}
+	w.flushes++
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijacker struct{ *responseWriter }
+
+func (w hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type pusher struct{ *responseWriter }
+
+func (w pusher) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+type readerFrom struct{ *responseWriter }
+
+// ReadFrom exposes underlying io.ReaderFrom to io.Copy, so it can take advantage of optimizations
+// such as sendfile. When body capture is enabled, the source is teed into the captured body,
+// which disables sendfile, but keeps the log complete.
+func (w readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	if !w.Written() {
+		// The status will be StatusOK if WriteHeader has not been called yet
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.copyBody {
+		src = io.TeeReader(src, bodyCapture{w.responseWriter})
+	}
+	n, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	w.size += int(n)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+const (
+	capFlusher = 1 << iota
+	capHijacker
+	capPusher
+	capReaderFrom
+
+	capCombinations = capReaderFrom << 1
+)
+
+// wrapCapabilities returns w with the optional interfaces of the wrapped writer.
+// Wrappers only hold w, so they are cached in w and reused by pooled writers.
+func wrapCapabilities(w *responseWriter) ResponseWriter {
+	caps := capabilities(w.ResponseWriter)
+	if w.wrapped[caps] == nil {
+		w.wrapped[caps] = newCapabilityWrapper(w, caps)
+	}
+	return w.wrapped[caps]
+}
+
+func capabilities(rw http.ResponseWriter) int {
+	var caps int
+	if _, ok := rw.(http.Flusher); ok {
+		caps |= capFlusher
+	}
+	if _, ok := rw.(http.Hijacker); ok {
+		caps |= capHijacker
+	}
+	if _, ok := rw.(http.Pusher); ok {
+		caps |= capPusher
+	}
+	if _, ok := rw.(io.ReaderFrom); ok {
+		caps |= capReaderFrom
+	}
+	return caps
+}
+
+func newCapabilityWrapper(w *responseWriter, caps int) ResponseWriter {
+	f, h, p, r := flusher{w}, hijacker{w}, pusher{w}, readerFrom{w}
+	switch caps {
+	case 0:
+		return w
+	case capFlusher:
+		return struct {
+			*responseWriter
+			flusher
+		}{w, f}
+	case capHijacker:
+		return struct {
+			*responseWriter
+			hijacker
+		}{w, h}
+	case capFlusher | capHijacker:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+		}{w, f, h}
+	case capPusher:
+		return struct {
+			*responseWriter
+			pusher
+		}{w, p}
+	case capFlusher | capPusher:
+		return struct {
+			*responseWriter
+			flusher
+			pusher
+		}{w, f, p}
+	case capHijacker | capPusher:
+		return struct {
+			*responseWriter
+			hijacker
+			pusher
+		}{w, h, p}
+	case capFlusher | capHijacker | capPusher:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+			pusher
+		}{w, f, h, p}
+	case capReaderFrom:
+		return struct {
+			*responseWriter
+			readerFrom
+		}{w, r}
+	case capFlusher | capReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			readerFrom
+		}{w, f, r}
+	case capHijacker | capReaderFrom:
+		return struct {
+			*responseWriter
+			hijacker
+			readerFrom
+		}{w, h, r}
+	case capFlusher | capHijacker | capReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+			readerFrom
+		}{w, f, h, r}
+	case capPusher | capReaderFrom:
+		return struct {
+			*responseWriter
+			pusher
+			readerFrom
+		}{w, p, r}
+	case capFlusher | capPusher | capReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			pusher
+			readerFrom
+		}{w, f, p, r}
+	case capHijacker | capPusher | capReaderFrom:
+		return struct {
+			*responseWriter
+			hijacker
+			pusher
+			readerFrom
+		}{w, h, p, r}
+	default: // capFlusher | capHijacker | capPusher | capReaderFrom
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+			pusher
+			readerFrom
+		}{w, f, h, p, r}
+	}
+}
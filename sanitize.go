@@ -0,0 +1,238 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SanitizeMode controls how user-controlled fields are escaped before formatting
+type SanitizeMode int
+
+const (
+	// SanitizeEscape escapes control characters, CR/LF, terminal escape sequences
+	// and unicode bidi overrides. Text bodies keep LF and TAB to stay readable.
+	SanitizeEscape SanitizeMode = iota
+
+	// SanitizeStrict escapes everything except printable ASCII, including LF and TAB in bodies.
+	// Use it for file and syslog outputs where one entry must be exactly one line.
+	SanitizeStrict
+
+	// SanitizeDisable prints user-controlled fields as is
+	SanitizeDisable
+)
+
+// Sanitize escapes control characters and terminal escape sequences in s according to mode.
+// It is useful for custom formatters printing fields which are not sanitized by middleware.
+func Sanitize(s string, mode SanitizeMode) string {
+	return sanitize(s, mode, false)
+}
+
+// sanitize returns s with unsafe runes replaced by Go-style escapes.
+// multiline allows LF and TAB in SanitizeEscape mode.
+func sanitize(s string, mode SanitizeMode, multiline bool) string {
+	if mode == SanitizeDisable {
+		return s
+	}
+
+	// fast path for printable ASCII, which is the most of the values
+	if isSafe(s, mode) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+			i += size
+			continue
+		}
+		i += size
+
+		if multiline && mode == SanitizeEscape && (r == '\n' || r == '\t') {
+			b.WriteRune(r)
+			continue
+		}
+
+		switch r {
+		case '\n':
+			b.WriteString(`\n`)
+			continue
+		case '\r':
+			b.WriteString(`\r`)
+			continue
+		case '\t':
+			b.WriteString(`\t`)
+			continue
+		case '\\':
+			if mode == SanitizeStrict {
+				b.WriteString(`\\`)
+				continue
+			}
+		}
+
+		switch {
+		case r < 0x80 && (r < 0x20 || r == 0x7f):
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r >= 0x80 && mode == SanitizeStrict:
+			escapeRune(&b, r)
+		case unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r):
+			escapeRune(&b, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isSafe returns true if s is printable ASCII, which needs no escaping
+func isSafe(s string, mode SanitizeMode) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || c >= utf8.RuneSelf || (c == '\\' && mode == SanitizeStrict) {
+			return false
+		}
+	}
+	return true
+}
+
+func escapeRune(b *strings.Builder, r rune) {
+	if r > 0xffff {
+		fmt.Fprintf(b, `\U%08x`, r)
+		return
+	}
+	fmt.Fprintf(b, `\u%04x`, r)
+}
+
+// sanitizeHeader returns a copy of h with escaped keys and values, h itself if nothing needs escaping
+func sanitizeHeader(h http.Header, mode SanitizeMode) http.Header {
+	if h == nil || mode == SanitizeDisable || isSafeHeader(h, mode) {
+		return h
+	}
+	result := make(http.Header, len(h))
+	for k, v := range h {
+		values := make([]string, len(v))
+		for i := range v {
+			values[i] = sanitize(v[i], mode, false)
+		}
+		result[sanitize(k, mode, false)] = values
+	}
+	return result
+}
+
+func isSafeHeader(h http.Header, mode SanitizeMode) bool {
+	for k, v := range h {
+		if !isSafe(k, mode) {
+			return false
+		}
+		for _, s := range v {
+			if !isSafe(s, mode) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sanitizeBody escapes text bodies, JSON bodies are left as is
+// because body formatters re-encode JSON strings with escaping anyway
+func sanitizeBody(body []byte, mode SanitizeMode) []byte {
+	if len(body) == 0 || mode == SanitizeDisable || json.Valid(body) {
+		return body
+	}
+	s := string(body)
+	if escaped := sanitize(s, mode, true); escaped != s {
+		return []byte(escaped)
+	}
+	return body
+}
+
+// sanitizeParams escapes all user-controlled fields of params
+func sanitizeParams(p *LogFormatterParams, mode SanitizeMode) {
+	if mode == SanitizeDisable {
+		return
+	}
+	p.Path = sanitize(p.Path, mode, false)
+	p.Scheme = sanitize(p.Scheme, mode, false)
+	p.Host = sanitize(p.Host, mode, false)
+	p.FullURL = sanitize(p.FullURL, mode, false)
+	p.Method = sanitize(p.Method, mode, false)
+	p.ClientIP = sanitize(p.ClientIP, mode, false)
+	p.ForwardedProto = sanitize(p.ForwardedProto, mode, false)
+	p.ForwardedHost = sanitize(p.ForwardedHost, mode, false)
+	p.RequestHeader = sanitizeHeader(p.RequestHeader, mode)
+	p.ResponseHeader = sanitizeHeader(p.ResponseHeader, mode)
+	p.Trailer = sanitizeHeader(p.Trailer, mode)
+	p.RequestBody = sanitizeBody(p.RequestBody, mode)
+	p.ResponseBody = sanitizeBody(p.ResponseBody, mode)
+	p.Error = sanitizeError(p.Error, mode)
+	p.Fields = sanitizeFields(p.Fields, mode)
+	p.UserAgent = sanitizeUserAgent(p.UserAgent, mode)
+}
+
+// sanitizedError is an error with escaped message, which still unwraps to the original one
+type sanitizedError struct {
+	msg string
+	err error
+}
+
+func (e *sanitizedError) Error() string { return e.msg }
+
+func (e *sanitizedError) Unwrap() error { return e.err }
+
+// sanitizeError escapes error message, which may have parts of the request, e.g. a bad header value
+func sanitizeError(err error, mode SanitizeMode) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if escaped := sanitize(msg, mode, false); escaped != msg {
+		return &sanitizedError{msg: escaped, err: err}
+	}
+	return err
+}
+
+// sanitizeFields returns a copy of fields with escaped keys and string values, fields itself if nothing needs escaping
+func sanitizeFields(fields []Field, mode SanitizeMode) []Field {
+	safe := true
+	for _, f := range fields {
+		v, _ := f.Value.(string)
+		if !isSafe(f.Key, mode) || !isSafe(v, mode) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return fields
+	}
+	result := make([]Field, len(fields))
+	for i, f := range fields {
+		result[i] = Field{Key: sanitize(f.Key, mode, false), Value: f.Value}
+		if v, ok := f.Value.(string); ok {
+			result[i].Value = sanitize(v, mode, false)
+		}
+	}
+	return result
+}
+
+// sanitizeUserAgent returns a copy of ua with escaped names and versions taken from the User-Agent header
+func sanitizeUserAgent(ua *UserAgentInfo, mode SanitizeMode) *UserAgentInfo {
+	if ua == nil || (isSafe(ua.Name, mode) && isSafe(ua.Version, mode) && isSafe(ua.OS, mode) && isSafe(ua.OSVersion, mode)) {
+		return ua
+	}
+	result := *ua
+	result.Name = sanitize(ua.Name, mode, false)
+	result.Version = sanitize(ua.Version, mode, false)
+	result.OS = sanitize(ua.OS, mode, false)
+	result.OSVersion = sanitize(ua.OSVersion, mode, false)
+	return &result
+}
@@ -0,0 +1,122 @@
+package httplog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, "/users/1?a=b", Sanitize("/users/1?a=b", SanitizeEscape))
+	assert.Equal(t, `/a\r\n[FAKE] 200 | /admin`, Sanitize("/a\r\n[FAKE] 200 | /admin", SanitizeEscape))
+	assert.Equal(t, `\x1b[31mred\x1b[0m`, Sanitize("\x1b[31mred\x1b[0m", SanitizeEscape))
+	assert.Equal(t, `abc\u202etxt.exe`, Sanitize("abc\u202etxt.exe", SanitizeEscape))
+	assert.Equal(t, `bad\xff`, Sanitize("bad\xff", SanitizeEscape))
+	assert.Equal(t, "Слава Україні", Sanitize("Слава Україні", SanitizeEscape))
+	assert.Equal(t, `a\\b`, Sanitize(`a\b`, SanitizeStrict))
+	assert.Equal(t, `\u0421\u043b\u0430\u0432\u0430`, Sanitize("Слава", SanitizeStrict))
+	assert.Equal(t, "a\nb", Sanitize("a\nb", SanitizeDisable))
+}
+
+func TestSanitizeBody(t *testing.T) {
+	assert.Equal(t, "line 1\nline 2\\x1b[2J", string(sanitizeBody([]byte("line 1\nline 2\x1b[2J"), SanitizeEscape)))
+	assert.Equal(t, `line 1\nline 2`, string(sanitizeBody([]byte("line 1\nline 2"), SanitizeStrict)))
+	// valid JSON is re-encoded by body formatters, so it is left untouched
+	assert.Equal(t, "{\n  \"a\": \"\\u001b\"\n}", string(sanitizeBody([]byte("{\n  \"a\": \"\\u001b\"\n}"), SanitizeStrict)))
+}
+
+func TestSanitizeParams(t *testing.T) {
+	cause := errors.New("bad header value \"x\r\n[FAKE] 200\"")
+	fields := []Field{{Key: "tenant", Value: "acme\x1b[2J"}, {Key: "attempt", Value: 2}}
+	ua := &UserAgentInfo{Class: UserAgentCLI, Name: "curl", Version: "8.0\u202e"}
+	p := &LogFormatterParams{Error: cause, Fields: fields, UserAgent: ua}
+
+	sanitizeParams(p, SanitizeEscape)
+
+	assert.EqualError(t, p.Error, `bad header value "x\r\n[FAKE] 200"`)
+	assert.ErrorIs(t, p.Error, cause)
+	assert.Equal(t, []Field{{Key: "tenant", Value: `acme\x1b[2J`}, {Key: "attempt", Value: 2}}, p.Fields)
+	assert.Equal(t, `8.0\u202e`, p.UserAgent.Version)
+	assert.Equal(t, "curl", p.UserAgent.Name)
+
+	// values shared with queued copies and raw sinks are not modified
+	assert.Equal(t, "acme\x1b[2J", fields[0].Value)
+	assert.Equal(t, "8.0\u202e", ua.Version)
+
+	// safe values are kept as is
+	safe := &LogFormatterParams{Error: io.EOF, Fields: fields[1:], UserAgent: &UserAgentInfo{Name: "curl"}}
+	ua, fields = safe.UserAgent, safe.Fields
+	sanitizeParams(safe, SanitizeEscape)
+	assert.Equal(t, io.EOF, safe.Error)
+	assert.Same(t, ua, safe.UserAgent)
+	assert.Equal(t, &fields[0], &safe.Fields[0])
+}
+
+func TestLoggerWithConfigSanitize(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Echo", r.Header.Get("X-Inject"))
+		_, _ = w.Write([]byte("ok\x1b[2J\r"))
+	})
+
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output:              buffer,
+		RouterName:          "TEST",
+		CaptureResponseBody: true,
+		Formatter:           FullFormatterWithRequestAndResponseHeadersAndBody,
+		ProxyHandler:        NewProxyWithType("X-Client"),
+	}, handler)
+
+	req := httptest.NewRequest("GET", "/a%0d%0a%5BTEST%5D%20fake", nil)
+	req.Header.Set("X-Inject", "value\x1b[2J")
+	req.Header.Set("X-Client", "1.1.1.1\n[TEST] fake")
+	PerformRequestWithRequest(logger, req)
+
+	out := buffer.String()
+	assert.NotContains(t, out, "\x1b[2J")
+	assert.NotContains(t, out, "\r")
+	for _, line := range strings.Split(out, "\n") {
+		assert.False(t, strings.HasPrefix(line, "[TEST] fake"), line)
+	}
+	assert.Contains(t, out, `value\x1b[2J`)
+}
+
+func TestLoggerWithConfigSanitizeDisable(t *testing.T) {
+	var gotParam LogFormatterParams
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output:   new(bytes.Buffer),
+		Sanitize: SanitizeDisable,
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return ""
+		},
+	}, testHandler200("ok"))
+
+	PerformRequest(logger, "GET", "/a%0a")
+	assert.Equal(t, "/a\n", gotParam.Path)
+}
+
+func TestLoggerWithConfigSanitizeStrict(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output:              buffer,
+		RouterName:          "TEST",
+		CaptureResponseBody: true,
+		Sanitize:            SanitizeStrict,
+		Formatter:           ChainLogFormatter(DefaultLogFormatter, ResponseBodyLogFormatter),
+	}, testHandler200("ok\n[TEST] fake line"))
+
+	PerformRequest(logger, "GET", "/")
+
+	out := buffer.String()
+	assert.Contains(t, out, `ok\n[TEST] fake line`)
+	for _, line := range strings.Split(out, "\n") {
+		assert.False(t, strings.HasPrefix(line, "[TEST] fake"), line)
+	}
+}
@@ -0,0 +1,189 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+// Sink is a log destination with its own encoder, writer and filters.
+// Every log entry is written to all sinks of LoggerConfig.Sinks,
+// e.g. colored text to stdout and JSON to a file at the same time.
+type Sink struct {
+	// Name identifies the sink in error reports.
+	// Optional.
+	Name string
+
+	// Encoder appends log entries of this sink, it takes precedence over Formatter.
+	// Optional. Default value is httplog.DefaultEncoder
+	Encoder Encoder
+
+	// Formatter formats log entries of this sink, used when Encoder is not set.
+	// Optional.
+	Formatter LogFormatter
+
+	// Output is a writer where logs of this sink are written.
+	// Optional. Default value is httplog.DefaultWriter.
+	Output io.Writer
+
+	// ColorMode controls color output of this sink
+	// Default: ColorAuto (detect terminal)
+	ColorMode ColorMode
+
+	// Theme is the colors of this sink, e.g. httplog.DarkTheme(httplog.DetectColorDepth()).
+	// Optional. Default value is httplog.DefaultTheme
+	Theme *Theme
+
+	// Raw passes user-controlled fields to this sink as is, LoggerConfig.Sanitize is not applied.
+	// Use it for encoders which escape values themselves, like HAREncoder and CurlEncoder,
+	// so binary bodies and control characters reach them intact. Masking and PII scrubbing still apply.
+	// Default: false
+	Raw bool
+
+	// MinLevel is the minimum log level written to this sink.
+	// LoggerConfig.MinLevel is applied before sinks.
+	// Default: LevelDebug
+	MinLevel Level
+
+	// SampleRate is the fraction of log entries written to this sink, from 0.0 to 1.0.
+	// LoggerConfig.SampleRate is applied before sinks.
+	// Default: 0 (log all entries)
+	SampleRate float64
+
+	// DeterministicSampling uses hash-based sampling by path and method instead of random
+	// Default: false (random sampling)
+	DeterministicSampling bool
+
+	// OnError is called when the sink fails to write a log entry or its encoder panics.
+	// Other sinks are not affected by the failure.
+	// Optional. Default: errors are printed to httplog.DefaultErrorWriter
+	OnError func(err error)
+}
+
+// sinkWriter is a Sink with resolved defaults
+type sinkWriter struct {
+	name                  string
+	encoder               Encoder
+	out                   io.Writer
+	colorMode             ColorMode
+	theme                 *Theme
+	raw                   bool
+	minLevel              Level
+	sampleRate            float64
+	deterministicSampling bool
+	onError               func(err error)
+
+	// logChan is the queue of async logging, every sink has its own,
+	// so a slow sink doesn't hold the others
+	logChan chan LogFormatterParams
+}
+
+func newSinkWriter(s Sink) *sinkWriter {
+	w := &sinkWriter{
+		name:                  s.Name,
+		encoder:               s.Encoder,
+		out:                   s.Output,
+		theme:                 s.Theme,
+		raw:                   s.Raw,
+		minLevel:              s.MinLevel,
+		sampleRate:            s.SampleRate,
+		deterministicSampling: s.DeterministicSampling,
+		onError:               s.OnError,
+	}
+	if w.encoder == nil {
+		w.encoder = DefaultEncoder
+		if s.Formatter != nil {
+			w.encoder = FormatterEncoder(s.Formatter)
+		}
+	}
+	if w.out == nil {
+		w.out = DefaultWriter
+	}
+	w.colorMode = resolveColorMode(s.ColorMode, w.out)
+	if w.onError == nil {
+		w.onError = func(err error) {
+			fmt.Fprintln(DefaultErrorWriter, err)
+		}
+	}
+	return w
+}
+
+// accept returns true if the entry passes level and sampling filters of the sink
+func (s *sinkWriter) accept(p *LogFormatterParams) bool {
+	if p.Level < s.minLevel {
+		return false
+	}
+	if s.sampleRate <= 0 || s.sampleRate >= 1.0 {
+		return true
+	}
+	if s.deterministicSampling {
+		path := p.Path
+		if p.Request != nil {
+			path = p.Request.URL.Path
+		}
+		return float64(fnv32a(p.Method, path))/float64(^uint32(0)) <= s.sampleRate
+	}
+	return rand.Float64() <= s.sampleRate
+}
+
+// write encodes p into buf and writes it to the sink output, failures are reported to onError.
+// It returns buf for reuse.
+func (s *sinkWriter) write(buf []byte, p *LogFormatterParams) []byte {
+	defer func() {
+		if r := recover(); r != nil {
+			s.onError(fmt.Errorf("httplog: sink %q: encoder panic: %v", s.name, r))
+		}
+	}()
+	p.colorMode = s.colorMode
+	p.theme = s.theme
+	buf = s.encoder.Encode(buf[:0], p)
+	if len(buf) > 0 {
+		if _, err := s.out.Write(buf); err != nil {
+			s.onError(fmt.Errorf("httplog: sink %q: %w", s.name, err))
+		}
+	}
+	return buf
+}
+
+// log writes p to the sink, or queues a copy of it in async mode
+func (s *sinkWriter) log(p *LogFormatterParams) {
+	if !s.accept(p) {
+		return
+	}
+	if s.logChan != nil {
+		select {
+		case s.logChan <- *p:
+			// Successfully queued
+		default:
+			// Buffer full, drop log (or could block here)
+		}
+		return
+	}
+	buf := acquireBuffer()
+	*buf = s.write(*buf, p)
+	releaseBuffer(buf)
+}
+
+// startAsync starts background goroutine writing queued entries
+func (s *sinkWriter) startAsync(bufferSize int) {
+	s.logChan = make(chan LogFormatterParams, bufferSize)
+	go func() {
+		var buf []byte
+		for param := range s.logChan {
+			buf = s.write(buf, &param)
+			if cap(buf) > maxPooledBufferSize {
+				buf = nil
+			}
+		}
+	}()
+}
+
+func (s *sinkWriter) close() {
+	if s.logChan != nil {
+		close(s.logChan)
+	}
+}
@@ -0,0 +1,196 @@
+package httplog
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serveWithConfig(t *testing.T, conf LoggerConfig, status int, paths ...string) *LoggingMiddleware {
+	t.Helper()
+	logger, err := LoggerWithConfig(conf)
+	assert.NoError(t, err)
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	for _, path := range paths {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	return logger
+}
+
+func TestSinksFanOut(t *testing.T) {
+	text, short := new(bytes.Buffer), new(bytes.Buffer)
+	serveWithConfig(t, LoggerConfig{
+		Sinks: []Sink{
+			{Output: text, ColorMode: ColorForce},
+			{Output: short, Encoder: ShortEncoder, ColorMode: ColorDisable},
+		},
+	}, http.StatusOK, "/example")
+
+	assert.Contains(t, text.String(), "\x1b[97;42m 200 \x1b[0m")
+	assert.Contains(t, text.String(), `"/example"`)
+	assert.Equal(t, "[]  200 | \"/example\"\n", short.String())
+}
+
+func TestSinksMinLevel(t *testing.T) {
+	all, errorsOnly := new(bytes.Buffer), new(bytes.Buffer)
+	conf := LoggerConfig{
+		Sinks: []Sink{
+			{Output: all, Encoder: ShortEncoder},
+			{Output: errorsOnly, Encoder: ShortEncoder, MinLevel: LevelError},
+		},
+	}
+	serveWithConfig(t, conf, http.StatusOK, "/ok")
+	serveWithConfig(t, conf, http.StatusInternalServerError, "/fail")
+
+	assert.Equal(t, "[]  200 | \"/ok\"\n[]  500 | \"/fail\"\n", all.String())
+	assert.Equal(t, "[]  500 | \"/fail\"\n", errorsOnly.String())
+
+	// global MinLevel is applied before sinks
+	all.Reset()
+	conf.MinLevel = LevelWarn
+	serveWithConfig(t, conf, http.StatusOK, "/ok")
+	assert.Empty(t, all.String())
+}
+
+func TestSinksSampling(t *testing.T) {
+	all, sampled := new(bytes.Buffer), new(bytes.Buffer)
+	paths := make([]string, 100)
+	for i := range paths {
+		paths[i] = "/users/" + strings.Repeat("x", i)
+	}
+	conf := LoggerConfig{
+		Sinks: []Sink{
+			{Output: all, Encoder: ShortEncoder},
+			{Output: sampled, Encoder: ShortEncoder, SampleRate: 0.3, DeterministicSampling: true},
+		},
+	}
+	serveWithConfig(t, conf, http.StatusOK, paths...)
+	assert.Equal(t, 100, strings.Count(all.String(), "\n"))
+	n := strings.Count(sampled.String(), "\n")
+	assert.True(t, n > 0 && n < 100, "sampled %d of 100", n)
+
+	// deterministic sampling gives the same result
+	again := sampled.String()
+	sampled.Reset()
+	serveWithConfig(t, conf, http.StatusOK, paths...)
+	assert.Equal(t, again, sampled.String())
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write(b []byte) (int, error) { return 0, w.err }
+
+func TestSinksFailuresAreIsolated(t *testing.T) {
+	out := new(bytes.Buffer)
+	var reported []error
+	onError := func(err error) { reported = append(reported, err) }
+
+	serveWithConfig(t, LoggerConfig{
+		Sinks: []Sink{
+			{Name: "broken", Output: failingWriter{errors.New("disk full")}, OnError: onError},
+			{Name: "panic", Encoder: EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+				panic("boom")
+			}), OnError: onError},
+			{Output: out, Encoder: ShortEncoder},
+		},
+	}, http.StatusOK, "/example")
+
+	assert.Equal(t, "[]  200 | \"/example\"\n", out.String())
+	if assert.Len(t, reported, 2) {
+		assert.EqualError(t, reported[0], `httplog: sink "broken": disk full`)
+		assert.EqualError(t, reported[1], `httplog: sink "panic": encoder panic: boom`)
+	}
+}
+
+func TestSinksDefaultErrorWriter(t *testing.T) {
+	errOut := new(bytes.Buffer)
+	defaultErrorWriter := DefaultErrorWriter
+	DefaultErrorWriter = errOut
+	defer func() { DefaultErrorWriter = defaultErrorWriter }()
+
+	serveWithConfig(t, LoggerConfig{
+		Sinks: []Sink{{Name: "file", Output: failingWriter{errors.New("disk full")}}},
+	}, http.StatusOK, "/example")
+	assert.Equal(t, "httplog: sink \"file\": disk full\n", errOut.String())
+}
+
+func TestSinksAsync(t *testing.T) {
+	fast := &lockedBuffer{}
+	block := make(chan struct{})
+	slow := EncoderFunc(func(buf []byte, p *LogFormatterParams) []byte {
+		<-block
+		return buf
+	})
+	logger := serveWithConfig(t, LoggerConfig{
+		AsyncLogging: true,
+		Sinks: []Sink{
+			{Encoder: slow},
+			{Output: fast, Encoder: ShortEncoder},
+		},
+	}, http.StatusOK, "/example")
+	defer logger.Close()
+	defer close(block)
+
+	// blocked sink doesn't hold the others
+	assert.Eventually(t, func() bool {
+		return strings.Contains(fast.String(), "/example")
+	}, time.Second, 5*time.Millisecond)
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSlogSink(t *testing.T) {
+	text, structured := new(bytes.Buffer), new(bytes.Buffer)
+	slogger := slog.New(slog.NewJSONHandler(structured, nil))
+	serveWithConfig(t, LoggerConfig{
+		Sinks: []Sink{
+			{Output: text, Encoder: ShortEncoder},
+			SlogSink(slogger, slog.LevelInfo, "HTTP"),
+		},
+		Enrichers: []Enricher{func(p *LogFormatterParams) { p.AddField("tenant", "acme") }},
+	}, http.StatusOK, "/example")
+
+	assert.Equal(t, "[]  200 | \"/example\"\n", text.String())
+	assert.Contains(t, structured.String(), `"msg":"HTTP"`)
+	assert.Contains(t, structured.String(), `"path":"/example"`)
+	assert.Contains(t, structured.String(), `"tenant":"acme"`)
+}
+
+func TestValidateConfigSinks(t *testing.T) {
+	err := ValidateConfig(LoggerConfig{Sinks: []Sink{{}, {SampleRate: 1.5}}})
+	assert.EqualError(t, err, "invalid Sinks[1].SampleRate: 1.500000 (must be between 0.0 and 1.0)")
+
+	err = ValidateConfig(LoggerConfig{Sinks: []Sink{{}}, Output: new(bytes.Buffer)})
+	assert.EqualError(t, err, "invalid Sinks: Output is set per sink, it can't be used with Sinks")
+	err = ValidateConfig(LoggerConfig{Sinks: []Sink{{}}, Formatter: ShortLogFormatter})
+	assert.EqualError(t, err, "invalid Sinks: Formatter is set per sink, it can't be used with Sinks")
+	err = ValidateConfig(LoggerConfig{Sinks: []Sink{{}}, ColorMode: ColorForce, Theme: DefaultTheme})
+	assert.EqualError(t, err, "invalid Sinks: ColorMode is set per sink, it can't be used with Sinks")
+	err = ValidateConfig(LoggerConfig{Sinks: []Sink{{}}, Template: "{{.Method}}"})
+	assert.EqualError(t, err, "invalid Sinks: Template is set per sink, it can't be used with Sinks")
+}
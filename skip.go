@@ -0,0 +1,65 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// requestSkipper matches requests which are not logged by method, path, host and headers
+type requestSkipper struct {
+	methods map[string]bool
+	paths   []*regexp.Regexp
+	hosts   []*regexp.Regexp
+	headers map[string]*regexp.Regexp
+}
+
+// newRequestSkipper compiles skip rules, config should be validated before
+func newRequestSkipper(conf LoggerConfig) *requestSkipper {
+	s := &requestSkipper{
+		methods: make(map[string]bool, len(conf.SkipMethods)),
+		headers: make(map[string]*regexp.Regexp, len(conf.SkipHeaders)),
+	}
+	for _, m := range conf.SkipMethods {
+		s.methods[strings.ToUpper(m)] = true
+	}
+	for _, p := range conf.SkipPaths {
+		s.paths = append(s.paths, regexp.MustCompile(p))
+	}
+	for _, p := range conf.SkipHosts {
+		s.hosts = append(s.hosts, regexp.MustCompile(p))
+	}
+	for name, p := range conf.SkipHeaders {
+		s.headers[http.CanonicalHeaderKey(name)] = regexp.MustCompile(p)
+	}
+	return s
+}
+
+// match returns true if request should not be logged
+func (s *requestSkipper) match(r *http.Request) bool {
+	if s.methods[r.Method] {
+		return true
+	}
+	for _, re := range s.paths {
+		if re.MatchString(r.URL.Path) {
+			return true
+		}
+	}
+	for _, re := range s.hosts {
+		if re.MatchString(r.Host) {
+			return true
+		}
+	}
+	for name, re := range s.headers {
+		for _, v := range r.Header[name] {
+			if re.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
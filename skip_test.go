@@ -0,0 +1,106 @@
+package httplog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerWithConfigSkipMatchers(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger, err := HandlerWithConfig(LoggerConfig{
+		Output:      buffer,
+		SkipMethods: []string{"options"},
+		SkipHosts:   []string{`^internal\.`},
+		SkipHeaders: map[string]string{"x-synthetic": ".*"},
+		SkipFunc: func(r *http.Request) bool {
+			return r.URL.Query().Get("nolog") == "1"
+		},
+	}, testHandler200("ok"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		req     func() *http.Request
+		skipped bool
+	}{
+		{"logged", func() *http.Request { return newRequest("GET", "/") }, false},
+		{"method", func() *http.Request { return newRequest("OPTIONS", "/") }, true},
+		{"host", func() *http.Request {
+			r := newRequest("GET", "/")
+			r.Host = "internal.example.com"
+			return r
+		}, true},
+		{"header", func() *http.Request {
+			r := newRequest("GET", "/")
+			r.Header.Set("X-Synthetic", "")
+			return r
+		}, true},
+		{"func", func() *http.Request { return newRequest("GET", "/?nolog=1") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer.Reset()
+			PerformRequestWithRequest(logger, tt.req())
+			assert.Equal(t, tt.skipped, buffer.Len() == 0)
+		})
+	}
+}
+
+func TestLoggerWithConfigSkipBeforeCapture(t *testing.T) {
+	var gotWriter http.ResponseWriter
+	var bodyRead bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotWriter = w
+		bodyRead = r.Body == http.NoBody
+	})
+
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output:              new(bytes.Buffer),
+		CaptureRequestBody:  true,
+		CaptureResponseBody: true,
+		SkipPaths:           []string{"/healthz"},
+	}, handler)
+
+	w := PerformRequest(logger, "GET", "/healthz")
+	// handler gets the original writer and request body is not replaced
+	assert.Equal(t, w, gotWriter)
+	assert.True(t, bodyRead)
+
+	PerformRequest(logger, "GET", "/logged")
+	_, wrapped := gotWriter.(ResponseWriter)
+	assert.True(t, wrapped)
+}
+
+func TestLoggerWithConfigDropFunc(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	var dropped LogFormatterParams
+	logger, _ := HandlerWithConfig(LoggerConfig{
+		Output: buffer,
+		DropFunc: func(param LogFormatterParams) bool {
+			dropped = param
+			return param.StatusCode < 400 && param.Latency < time.Second
+		},
+	}, testHandler200("ok"))
+
+	PerformRequest(logger, "GET", "/fast")
+	assert.Empty(t, buffer.String())
+	assert.Equal(t, "/fast", dropped.Path)
+	assert.Equal(t, http.StatusOK, dropped.StatusCode)
+}
+
+func TestLoggerWithConfigInvalidSkipMatchers(t *testing.T) {
+	_, err := LoggerWithConfig(LoggerConfig{SkipHosts: []string{"[invalid"}})
+	assert.ErrorContains(t, err, "invalid SkipHosts[0]")
+
+	_, err = LoggerWithConfig(LoggerConfig{SkipHeaders: map[string]string{"X-Test": "[invalid"}})
+	assert.ErrorContains(t, err, "invalid SkipHeaders[X-Test]")
+}
+
+func newRequest(method, target string) *http.Request {
+	return httptest.NewRequest(method, target, nil)
+}
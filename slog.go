@@ -1,7 +1,9 @@
 package httplog
 
 import (
+	"io"
 	"log/slog"
+	"sort"
 )
 
 // Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
@@ -15,7 +17,8 @@ import (
 //   - message: Log message prefix (e.g., "HTTP Request")
 //
 // The formatter extracts trace ID from context (if present) and logs
-// structured attributes: method, path, status, latency, client_ip, body_size
+// structured attributes: method, path, scheme, host, url, status, latency, client_ip, body_size,
+// and extra fields added by enrichers with AddField
 //
 // Example:
 //
@@ -25,7 +28,41 @@ import (
 //	}
 //	middleware, _ := httplog.LoggerWithConfig(conf)
 func SlogLogger(logger *slog.Logger, level slog.Level, message string) LogFormatter {
+	encode := slogEncode(logger, level, message)
 	return func(param LogFormatterParams) string {
+		encode(nil, &param)
+		// Return empty string as slog handles output
+		return ""
+	}
+}
+
+// SlogEncoder is the Encoder version of SlogLogger, it appends nothing to the buffer
+// as slog handles output, so no output is written to LoggerConfig.Output.
+func SlogEncoder(logger *slog.Logger, level slog.Level, message string) Encoder {
+	return slogEncode(logger, level, message)
+}
+
+// SlogSink is a sink which passes log entries to slog logger, use it in LoggerConfig.Sinks
+// next to text or JSON outputs.
+//
+// Example:
+//
+//	conf := httplog.LoggerConfig{
+//	    Sinks: []httplog.Sink{
+//	        {Output: os.Stdout},
+//	        httplog.SlogSink(slogger, slog.LevelInfo, "HTTP"),
+//	    },
+//	}
+func SlogSink(logger *slog.Logger, level slog.Level, message string) Sink {
+	return Sink{
+		Name:    "slog",
+		Encoder: SlogEncoder(logger, level, message),
+		Output:  io.Discard,
+	}
+}
+
+func slogEncode(logger *slog.Logger, level slog.Level, message string) EncoderFunc {
+	return func(buf []byte, param *LogFormatterParams) []byte {
 		// Map httplog.Level to slog.Level
 		var slogLevel slog.Level
 		switch param.Level {
@@ -51,6 +88,9 @@ func SlogLogger(logger *slog.Logger, level slog.Level, message string) LogFormat
 		attrs := []slog.Attr{
 			slog.String("method", param.Method),
 			slog.String("path", param.Path),
+			slog.String("scheme", param.Scheme),
+			slog.String("host", param.Host),
+			slog.String("url", param.FullURL),
 			slog.Int("status", param.StatusCode),
 			slog.Duration("latency", param.Latency),
 			slog.String("client_ip", param.ClientIP),
@@ -62,11 +102,75 @@ func SlogLogger(logger *slog.Logger, level slog.Level, message string) LogFormat
 			attrs = append(attrs, slog.String("router", param.RouterName))
 		}
 
+		// Add response timeline
+		if param.TTFB > 0 {
+			attrs = append(attrs, slog.Duration("ttfb", param.TTFB))
+		}
+		if param.Flushes > 0 {
+			attrs = append(attrs, slog.Int("flushes", param.Flushes))
+		}
+		if len(param.Informational) > 0 {
+			attrs = append(attrs, slog.Any("informational", param.Informational))
+		}
+		if len(param.Trailer) > 0 {
+			attrs = append(attrs, slog.Any("trailer", param.Trailer))
+		}
+
+		// Add failure details if request didn't complete normally
+		if param.Error != nil {
+			attrs = append(attrs,
+				slog.String("error", param.Error.Error()),
+				slog.Bool("client_canceled", param.ClientCanceled),
+				slog.Int64("bytes_expected", param.BytesExpected),
+				slog.Int64("bytes_written", param.BytesWritten),
+			)
+		}
+
+		// Add client location if GeoIP enricher is configured
+		if param.Geo != nil {
+			attrs = append(attrs, slog.Group("geo",
+				slog.String("country_code", param.Geo.CountryCode),
+				slog.String("country", param.Geo.Country),
+				slog.String("city", param.Geo.City),
+				slog.Uint64("asn", uint64(param.Geo.ASN)),
+				slog.String("as_org", param.Geo.ASOrg),
+			))
+		}
+
+		// Add client info if User-Agent was parsed
+		if param.UserAgent != nil {
+			attrs = append(attrs, slog.Group("user_agent",
+				slog.String("class", string(param.UserAgent.Class)),
+				slog.String("name", param.UserAgent.Name),
+				slog.String("version", param.UserAgent.Version),
+				slog.String("os", param.UserAgent.OS),
+				slog.String("os_version", param.UserAgent.OSVersion),
+				slog.String("device", string(param.UserAgent.Device)),
+			))
+		}
+
+		// Add PII redaction counts if anything was masked
+		if len(param.Redactions) > 0 {
+			names := make([]string, 0, len(param.Redactions))
+			for name := range param.Redactions {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			redactions := make([]any, 0, len(names))
+			for _, name := range names {
+				redactions = append(redactions, slog.Int(name, param.Redactions[name]))
+			}
+			attrs = append(attrs, slog.Group("redactions", redactions...))
+		}
+
+		// Add extra fields of enrichers
+		for _, f := range param.Fields {
+			attrs = append(attrs, slog.Any(f.Key, f.Value))
+		}
+
 		// Log with context (for trace ID extraction if middleware is present)
 		logger.LogAttrs(ctx, slogLevel, message, attrs...)
-
-		// Return empty string as slog handles output
-		return ""
+		return buf
 	}
 }
 
@@ -0,0 +1,256 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Theme is a set of ANSI escape sequences used by formatters when color output is enabled.
+// Build colors with ANSIColor, Color256 and TrueColor, empty value means no color.
+type Theme struct {
+	// Status code colors by class
+	Status2xx, Status3xx, Status4xx, Status5xx string
+
+	// Method colors, MethodOther is used for the rest
+	MethodGet, MethodPost, MethodPut, MethodDelete, MethodPatch, MethodHead, MethodOptions, MethodOther string
+
+	// Latency color
+	Latency string
+
+	// Header key and value colors of header formatters
+	HeaderKey, HeaderValue string
+
+	// Body kind colors of body formatters
+	BodyEmpty, BodyText, BodyJSON string
+
+	// Reset resets all attributes
+	Reset string
+}
+
+// DefaultTheme is 16-color theme of default formatters
+var DefaultTheme = &Theme{
+	Status2xx:     green,
+	Status3xx:     white,
+	Status4xx:     yellow,
+	Status5xx:     red,
+	MethodGet:     blue,
+	MethodPost:    cyan,
+	MethodPut:     yellow,
+	MethodDelete:  red,
+	MethodPatch:   green,
+	MethodHead:    magenta,
+	MethodOptions: white,
+	MethodOther:   reset,
+	HeaderKey:     "\033[1;34m",
+	HeaderValue:   "\033[;32m",
+	BodyEmpty:     yellow,
+	BodyText:      blue,
+	BodyJSON:      green,
+	Reset:         reset,
+}
+
+// ColorDepth is the number of colors supported by terminal
+type ColorDepth int
+
+const (
+	// ColorDepth16 is basic ANSI colors
+	ColorDepth16 ColorDepth = iota
+
+	// ColorDepth256 is xterm 256-color palette
+	ColorDepth256
+
+	// ColorDepthTrueColor is 24-bit RGB colors
+	ColorDepthTrueColor
+)
+
+// DetectColorDepth detects terminal color depth by COLORTERM, FORCE_COLOR and TERM environment variables
+func DetectColorDepth() ColorDepth {
+	switch os.Getenv("FORCE_COLOR") {
+	case "2":
+		return ColorDepth256
+	case "3":
+		return ColorDepthTrueColor
+	}
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return ColorDepthTrueColor
+	}
+	if strings.Contains(os.Getenv("TERM"), "256color") {
+		return ColorDepth256
+	}
+	return ColorDepth16
+}
+
+// ANSIColor returns SGR sequence of codes, e.g. ANSIColor(97, 42) is white on green
+func ANSIColor(codes ...int) string {
+	var b strings.Builder
+	b.WriteString("\033[")
+	for i, c := range codes {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(strconv.Itoa(c))
+	}
+	b.WriteByte('m')
+	return b.String()
+}
+
+// Color256 returns sequence of xterm 256-color palette foreground and background, -1 keeps default
+func Color256(fg, bg int) string {
+	var codes []int
+	if fg >= 0 {
+		codes = append(codes, 38, 5, fg)
+	}
+	if bg >= 0 {
+		codes = append(codes, 48, 5, bg)
+	}
+	return ANSIColor(codes...)
+}
+
+// TrueColor returns sequence of 24-bit foreground and background, given as 0xRRGGBB, -1 keeps default
+func TrueColor(fg, bg int) string {
+	var codes []int
+	if fg >= 0 {
+		codes = append(codes, 38, 2, fg>>16&0xff, fg>>8&0xff, fg&0xff)
+	}
+	if bg >= 0 {
+		codes = append(codes, 48, 2, bg>>16&0xff, bg>>8&0xff, bg&0xff)
+	}
+	return ANSIColor(codes...)
+}
+
+// paletteColor is a color in every color depth: ANSI foreground code, xterm 256 index and RGB
+type paletteColor struct {
+	ansi, xterm, rgb int
+}
+
+// noColor keeps default terminal color
+var noColor = paletteColor{-1, -1, -1}
+
+// sequence returns foreground and background sequence in depth
+func sequence(depth ColorDepth, fg, bg paletteColor) string {
+	switch depth {
+	case ColorDepth256:
+		return Color256(fg.xterm, bg.xterm)
+	case ColorDepthTrueColor:
+		return TrueColor(fg.rgb, bg.rgb)
+	}
+	var codes []int
+	if fg.ansi >= 0 {
+		codes = append(codes, fg.ansi)
+	}
+	if bg.ansi >= 0 {
+		// background codes are foreground + 10
+		codes = append(codes, bg.ansi+10)
+	}
+	return ANSIColor(codes...)
+}
+
+var (
+	paletteBlack     = paletteColor{30, 16, 0x000000}
+	paletteWhite     = paletteColor{97, 231, 0xffffff}
+	paletteGray      = paletteColor{90, 245, 0x8a8a8a}
+	paletteLightGray = paletteColor{37, 250, 0xbcbcbc}
+	paletteDarkGray  = paletteColor{90, 240, 0x585858}
+	paletteGreen     = paletteColor{32, 114, 0x87d787}
+	paletteDarkGreen = paletteColor{32, 28, 0x008700}
+	paletteBlue      = paletteColor{34, 75, 0x5fafff}
+	paletteDarkBlue  = paletteColor{34, 25, 0x005faf}
+	paletteCyan      = paletteColor{36, 80, 0x5fd7d7}
+	paletteDarkCyan  = paletteColor{36, 30, 0x008787}
+	paletteYellow    = paletteColor{33, 221, 0xffd75f}
+	paletteBrown     = paletteColor{33, 130, 0xaf5f00}
+	paletteRed       = paletteColor{31, 160, 0xd70000}
+	paletteDarkRed   = paletteColor{31, 124, 0xaf0000}
+	paletteMagenta   = paletteColor{35, 177, 0xd787ff}
+	palettePurple    = paletteColor{35, 90, 0x870087}
+)
+
+// DarkTheme returns theme for dark terminal background in color depth
+func DarkTheme(depth ColorDepth) *Theme {
+	badge := func(bg paletteColor) string { return sequence(depth, paletteBlack, bg) }
+	fg := func(c paletteColor) string { return sequence(depth, c, noColor) }
+	return &Theme{
+		Status2xx:     badge(paletteGreen),
+		Status3xx:     badge(paletteLightGray),
+		Status4xx:     badge(paletteYellow),
+		Status5xx:     sequence(depth, paletteWhite, paletteRed),
+		MethodGet:     badge(paletteBlue),
+		MethodPost:    badge(paletteCyan),
+		MethodPut:     badge(paletteYellow),
+		MethodDelete:  sequence(depth, paletteWhite, paletteRed),
+		MethodPatch:   badge(paletteGreen),
+		MethodHead:    badge(paletteMagenta),
+		MethodOptions: badge(paletteLightGray),
+		MethodOther:   reset,
+		Latency:       fg(paletteGray),
+		HeaderKey:     fg(paletteBlue),
+		HeaderValue:   fg(paletteGreen),
+		BodyEmpty:     fg(paletteYellow),
+		BodyText:      fg(paletteBlue),
+		BodyJSON:      fg(paletteGreen),
+		Reset:         reset,
+	}
+}
+
+// LightTheme returns theme for light terminal background in color depth
+func LightTheme(depth ColorDepth) *Theme {
+	badge := func(bg paletteColor) string { return sequence(depth, paletteWhite, bg) }
+	fg := func(c paletteColor) string { return sequence(depth, c, noColor) }
+	return &Theme{
+		Status2xx:     badge(paletteDarkGreen),
+		Status3xx:     badge(paletteDarkGray),
+		Status4xx:     badge(paletteBrown),
+		Status5xx:     badge(paletteDarkRed),
+		MethodGet:     badge(paletteDarkBlue),
+		MethodPost:    badge(paletteDarkCyan),
+		MethodPut:     badge(paletteBrown),
+		MethodDelete:  badge(paletteDarkRed),
+		MethodPatch:   badge(paletteDarkGreen),
+		MethodHead:    badge(palettePurple),
+		MethodOptions: badge(paletteDarkGray),
+		MethodOther:   reset,
+		Latency:       fg(paletteDarkGray),
+		HeaderKey:     fg(paletteDarkBlue),
+		HeaderValue:   fg(paletteDarkGreen),
+		BodyEmpty:     fg(paletteBrown),
+		BodyText:      fg(paletteDarkBlue),
+		BodyJSON:      fg(paletteDarkGreen),
+		Reset:         reset,
+	}
+}
+
+// resolveColorMode resolves ColorAuto by environment and output:
+// NO_COLOR disables colors, FORCE_COLOR and CLICOLOR_FORCE enable them, empty values are ignored,
+// otherwise colors are enabled for terminals, except TERM=dumb.
+// It only turns colors on or off, color depth is up to Theme.
+func resolveColorMode(mode ColorMode, out io.Writer) ColorMode {
+	if mode != ColorAuto {
+		return mode
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return ColorDisable
+	}
+	if v := os.Getenv("FORCE_COLOR"); v != "" {
+		if v == "0" || v == "false" {
+			return ColorDisable
+		}
+		return ColorForce
+	}
+	if v := os.Getenv("CLICOLOR_FORCE"); v != "" && v != "0" {
+		return ColorForce
+	}
+	if w, ok := out.(*os.File); ok && os.Getenv("TERM") != "dumb" &&
+		(isatty.IsTerminal(w.Fd()) || isatty.IsCygwinTerminal(w.Fd())) {
+		return ColorForce
+	}
+	return ColorDisable
+}
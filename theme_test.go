@@ -0,0 +1,147 @@
+package httplog
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColorSequences(t *testing.T) {
+	assert.Equal(t, "\x1b[97;42m", ANSIColor(97, 42))
+	assert.Equal(t, "\x1b[38;5;114m", Color256(114, -1))
+	assert.Equal(t, "\x1b[38;5;16;48;5;114m", Color256(16, 114))
+	assert.Equal(t, "\x1b[48;2;255;135;0m", TrueColor(-1, 0xff8700))
+	assert.Equal(t, "\x1b[38;2;0;95;175;48;2;255;255;255m", TrueColor(0x005faf, 0xffffff))
+}
+
+func TestDetectColorDepth(t *testing.T) {
+	tests := []struct {
+		name                        string
+		forceColor, colorTerm, term string
+		want                        ColorDepth
+	}{
+		{"basic terminal", "", "", "xterm", ColorDepth16},
+		{"256 color terminal", "", "", "xterm-256color", ColorDepth256},
+		{"truecolor", "", "truecolor", "xterm-256color", ColorDepthTrueColor},
+		{"24bit", "", "24bit", "", ColorDepthTrueColor},
+		{"FORCE_COLOR level 2", "2", "", "", ColorDepth256},
+		{"FORCE_COLOR level 3", "3", "", "xterm", ColorDepthTrueColor},
+		{"FORCE_COLOR level 1", "1", "", "xterm-256color", ColorDepth256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FORCE_COLOR", tt.forceColor)
+			t.Setenv("COLORTERM", tt.colorTerm)
+			t.Setenv("TERM", tt.term)
+			assert.Equal(t, tt.want, DetectColorDepth())
+		})
+	}
+}
+
+func TestResolveColorModeEnvironment(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		mode ColorMode
+		want ColorMode
+	}{
+		{"not a terminal", nil, ColorAuto, ColorDisable},
+		{"FORCE_COLOR", map[string]string{"FORCE_COLOR": "1"}, ColorAuto, ColorForce},
+		{"FORCE_COLOR empty", map[string]string{"FORCE_COLOR": ""}, ColorAuto, ColorDisable},
+		{"FORCE_COLOR empty is ignored", map[string]string{"FORCE_COLOR": "", "CLICOLOR_FORCE": "1"}, ColorAuto, ColorForce},
+		{"FORCE_COLOR=0", map[string]string{"FORCE_COLOR": "0", "CLICOLOR_FORCE": "1"}, ColorAuto, ColorDisable},
+		{"NO_COLOR over FORCE_COLOR", map[string]string{"FORCE_COLOR": "true", "NO_COLOR": "1"}, ColorAuto, ColorDisable},
+		{"NO_COLOR over CLICOLOR_FORCE", map[string]string{"CLICOLOR_FORCE": "1", "NO_COLOR": "1"}, ColorAuto, ColorDisable},
+		{"CLICOLOR_FORCE", map[string]string{"CLICOLOR_FORCE": "1"}, ColorAuto, ColorForce},
+		{"CLICOLOR_FORCE=0", map[string]string{"CLICOLOR_FORCE": "0"}, ColorAuto, ColorDisable},
+		{"explicit mode ignores environment", map[string]string{"FORCE_COLOR": "1"}, ColorDisable, ColorDisable},
+		{"explicit force ignores NO_COLOR", map[string]string{"NO_COLOR": "1"}, ColorForce, ColorForce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FORCE_COLOR", "")
+			t.Setenv("NO_COLOR", "")
+			t.Setenv("CLICOLOR_FORCE", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			assert.Equal(t, tt.want, resolveColorMode(tt.mode, new(bytes.Buffer)))
+		})
+	}
+}
+
+func TestThemeDefaultKeepsClassicColors(t *testing.T) {
+	p := &LogFormatterParams{StatusCode: http.StatusOK, Method: http.MethodGet}
+	assert.Same(t, DefaultTheme, p.Theme())
+	assert.Equal(t, green, p.StatusCodeColor())
+	assert.Equal(t, blue, p.MethodColor())
+	assert.Equal(t, "", p.LatencyColor())
+	assert.Equal(t, reset, p.ResetColor())
+}
+
+func TestThemeBuiltIn(t *testing.T) {
+	for _, depth := range []ColorDepth{ColorDepth16, ColorDepth256, ColorDepthTrueColor} {
+		for _, theme := range []*Theme{DarkTheme(depth), LightTheme(depth)} {
+			for _, c := range []string{
+				theme.Status2xx, theme.Status3xx, theme.Status4xx, theme.Status5xx,
+				theme.MethodGet, theme.MethodPost, theme.MethodPut, theme.MethodDelete,
+				theme.MethodPatch, theme.MethodHead, theme.MethodOptions,
+				theme.Latency, theme.HeaderKey, theme.HeaderValue,
+				theme.BodyEmpty, theme.BodyText, theme.BodyJSON,
+			} {
+				assert.Regexp(t, `^\x1b\[[0-9;]+m$`, c)
+			}
+		}
+	}
+	assert.Equal(t, "\x1b[30;42m", DarkTheme(ColorDepth16).Status2xx)
+	assert.Equal(t, "\x1b[38;5;16;48;5;114m", DarkTheme(ColorDepth256).Status2xx)
+	assert.Equal(t, "\x1b[38;2;0;135;0m", LightTheme(ColorDepthTrueColor).HeaderValue)
+}
+
+func TestThemeInFormatters(t *testing.T) {
+	theme := &Theme{
+		Status2xx:   "<2xx>",
+		MethodGet:   "<get>",
+		Latency:     "<latency>",
+		HeaderKey:   "<key>",
+		HeaderValue: "<value>",
+		BodyEmpty:   "<empty>",
+		Reset:       "</>",
+	}
+	out := new(bytes.Buffer)
+	serveWithConfig(t, LoggerConfig{
+		Output:    out,
+		ColorMode: ColorForce,
+		Theme:     theme,
+		Encoder:   ChainEncoder(DefaultEncoder, ResponseHeaderEncoder, RequestBodyEncoder),
+	}, http.StatusOK, "/themed")
+
+	assert.Contains(t, out.String(), "|<2xx> 200 </>| <latency>")
+	assert.Contains(t, out.String(), "|<get> GET     </>")
+	assert.Contains(t, out.String(), "<empty> EMPTY BODY </>")
+	assert.NotContains(t, out.String(), "\x1b[")
+
+	// every sink has its own theme
+	themed, classic := new(bytes.Buffer), new(bytes.Buffer)
+	serveWithConfig(t, LoggerConfig{
+		Sinks: []Sink{
+			{Output: themed, ColorMode: ColorForce, Theme: theme},
+			{Output: classic, ColorMode: ColorForce},
+		},
+	}, http.StatusOK, "/themed")
+	assert.Contains(t, themed.String(), "<2xx> 200 </>")
+	assert.Contains(t, classic.String(), "\x1b[97;42m 200 \x1b[0m")
+}
+
+func TestThemeHeaderColors(t *testing.T) {
+	p := &LogFormatterParams{
+		RequestHeader: http.Header{"Accept": {"*/*"}},
+		colorMode:     ColorForce,
+	}
+	assert.Equal(t, "  \x1b[1;34m Accept \x1b[0m: \x1b[;32m [*/*] \x1b[0m\n", RequestHeaderLogFormatter(*p))
+
+	p.theme = &Theme{HeaderKey: "<key>", HeaderValue: "<value>", Reset: "</>"}
+	assert.Equal(t, "  <key> Accept </>: <value> [*/*] </>\n", RequestHeaderLogFormatter(*p))
+}
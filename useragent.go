@@ -0,0 +1,261 @@
+package httplog
+
+// Copyright 2022 Jack Rudenko. MadAppGang. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UserAgentClass is a kind of client which sent the request
+type UserAgentClass string
+
+// Supported user agent classes
+const (
+	// UserAgentBrowser is a web browser used by human
+	UserAgentBrowser UserAgentClass = "browser"
+	// UserAgentCrawler is a search engine, social network or SEO bot
+	UserAgentCrawler UserAgentClass = "crawler"
+	// UserAgentMonitor is an uptime checker, like Pingdom or UptimeRobot
+	UserAgentMonitor UserAgentClass = "monitor"
+	// UserAgentProbe is a health check of orchestrator or load balancer, like kube-probe
+	UserAgentProbe UserAgentClass = "probe"
+	// UserAgentCLI is a command line tool or HTTP library, like curl or Go-http-client
+	UserAgentCLI UserAgentClass = "cli"
+	// UserAgentUnknown is everything else, including empty User-Agent
+	UserAgentUnknown UserAgentClass = "unknown"
+)
+
+// BotUserAgents is a list of automated client classes: crawlers, uptime monitors and health check probes
+var BotUserAgents = []UserAgentClass{UserAgentCrawler, UserAgentMonitor, UserAgentProbe}
+
+// DeviceType is a type of client device
+type DeviceType string
+
+// Supported device types
+const (
+	DeviceDesktop DeviceType = "desktop"
+	DeviceMobile  DeviceType = "mobile"
+	DeviceTablet  DeviceType = "tablet"
+	DeviceBot     DeviceType = "bot"
+	DeviceOther   DeviceType = "other"
+)
+
+// UserAgentInfo is parsed User-Agent header
+type UserAgentInfo struct {
+	// Class is a kind of client
+	Class UserAgentClass
+	// Name is a browser, bot or tool name, e.g. "Chrome", "Googlebot", "curl"
+	Name string
+	// Version is Name's version
+	Version string
+	// OS is operating system name, e.g. "Windows", "macOS", "Android"
+	OS string
+	// OSVersion is OS version
+	OSVersion string
+	// Device is client device type
+	Device DeviceType
+}
+
+// IsBot returns true for crawlers, uptime monitors and health check probes
+func (ua *UserAgentInfo) IsBot() bool {
+	return ua.Class == UserAgentCrawler || ua.Class == UserAgentMonitor || ua.Class == UserAgentProbe
+}
+
+// uaRule matches a known client by substring, the first matched rule wins
+type uaRule struct {
+	token string // case insensitive substring
+	name  string
+	class UserAgentClass
+}
+
+var uaRules = []uaRule{
+	// health check probes
+	{"kube-probe", "kube-probe", UserAgentProbe},
+	{"elb-healthchecker", "ELB-HealthChecker", UserAgentProbe},
+	{"googlehc", "GoogleHC", UserAgentProbe},
+	{"consul health check", "Consul", UserAgentProbe},
+	{"envoy/hc", "Envoy", UserAgentProbe},
+	{"azure traffic manager", "Azure Traffic Manager", UserAgentProbe},
+	// uptime monitors
+	{"uptimerobot", "UptimeRobot", UserAgentMonitor},
+	{"pingdom", "Pingdom", UserAgentMonitor},
+	{"statuscake", "StatusCake", UserAgentMonitor},
+	{"site24x7", "Site24x7", UserAgentMonitor},
+	{"better uptime", "Better Uptime", UserAgentMonitor},
+	{"datadog/synthetics", "Datadog Synthetics", UserAgentMonitor},
+	{"newrelicpinger", "New Relic", UserAgentMonitor},
+	{"checkly", "Checkly", UserAgentMonitor},
+	// crawlers
+	{"googlebot", "Googlebot", UserAgentCrawler},
+	{"bingbot", "bingbot", UserAgentCrawler},
+	{"yandexbot", "YandexBot", UserAgentCrawler},
+	{"baiduspider", "Baiduspider", UserAgentCrawler},
+	{"duckduckbot", "DuckDuckBot", UserAgentCrawler},
+	{"yahoo! slurp", "Yahoo! Slurp", UserAgentCrawler},
+	{"applebot", "Applebot", UserAgentCrawler},
+	{"facebookexternalhit", "facebookexternalhit", UserAgentCrawler},
+	{"twitterbot", "Twitterbot", UserAgentCrawler},
+	{"linkedinbot", "LinkedInBot", UserAgentCrawler},
+	{"slackbot", "Slackbot", UserAgentCrawler},
+	{"ahrefsbot", "AhrefsBot", UserAgentCrawler},
+	{"semrushbot", "SemrushBot", UserAgentCrawler},
+	{"mj12bot", "MJ12bot", UserAgentCrawler},
+	{"petalbot", "PetalBot", UserAgentCrawler},
+	{"gptbot", "GPTBot", UserAgentCrawler},
+	{"claudebot", "ClaudeBot", UserAgentCrawler},
+	// command line tools and libraries
+	{"curl/", "curl", UserAgentCLI},
+	{"wget/", "Wget", UserAgentCLI},
+	{"httpie/", "HTTPie", UserAgentCLI},
+	{"go-http-client/", "Go-http-client", UserAgentCLI},
+	{"python-requests/", "python-requests", UserAgentCLI},
+	{"python-urllib", "Python-urllib", UserAgentCLI},
+	{"python-httpx/", "python-httpx", UserAgentCLI},
+	{"aiohttp/", "aiohttp", UserAgentCLI},
+	{"okhttp/", "okhttp", UserAgentCLI},
+	{"axios/", "axios", UserAgentCLI},
+	{"node-fetch", "node-fetch", UserAgentCLI},
+	{"postmanruntime/", "PostmanRuntime", UserAgentCLI},
+	{"insomnia/", "insomnia", UserAgentCLI},
+	{"libwww-perl/", "libwww-perl", UserAgentCLI},
+	{"java/", "Java", UserAgentCLI},
+}
+
+// browser rules, order matters as most browsers mimic Chrome and Safari
+var uaBrowsers = []struct {
+	name    string
+	version *regexp.Regexp
+}{
+	{"Edge", regexp.MustCompile(`(?:Edg|Edge|EdgA|EdgiOS)/([\w.]+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\w.]+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\w.]+)`)},
+	{"Yandex Browser", regexp.MustCompile(`YaBrowser/([\w.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\w.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\w.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\w.]+).*Safari/`)},
+}
+
+var (
+	uaVersionRx   = regexp.MustCompile(`/([\w.]+)`)
+	uaWindowsRx   = regexp.MustCompile(`Windows NT ([\d.]+)`)
+	uaIOSRx       = regexp.MustCompile(`(?:iPhone|CPU) OS ([\d_]+)`)
+	uaMacRx       = regexp.MustCompile(`Mac OS X ([\d_.]+)`)
+	uaAndroidRx   = regexp.MustCompile(`Android ([\d.]+)`)
+	uaGenericBot  = regexp.MustCompile(`(?i)bot\b|crawler|spider|scraper`)
+	windowsNTName = map[string]string{"10.0": "10", "6.3": "8.1", "6.2": "8", "6.1": "7"}
+)
+
+// ParseUserAgent parses User-Agent header value
+func ParseUserAgent(ua string) UserAgentInfo {
+	info := UserAgentInfo{Class: UserAgentUnknown, Device: DeviceOther}
+	if ua == "" {
+		return info
+	}
+	lower := strings.ToLower(ua)
+
+	for _, rule := range uaRules {
+		if i := strings.Index(lower, rule.token); i >= 0 {
+			info.Class = rule.class
+			info.Name = rule.name
+			rest := ua[i+len(strings.TrimSuffix(rule.token, "/")):]
+			if m := uaVersionRx.FindStringSubmatch(rest); m != nil && strings.HasPrefix(rest, "/") {
+				info.Version = m[1]
+			}
+			if info.Class != UserAgentCLI {
+				info.Device = DeviceBot
+			}
+			parseOS(ua, &info)
+			return info
+		}
+	}
+
+	if uaGenericBot.MatchString(ua) {
+		info.Class = UserAgentCrawler
+		info.Device = DeviceBot
+		return info
+	}
+
+	if !strings.HasPrefix(ua, "Mozilla/") && !strings.HasPrefix(ua, "Opera/") {
+		return info
+	}
+
+	info.Class = UserAgentBrowser
+	for _, b := range uaBrowsers {
+		if m := b.version.FindStringSubmatch(ua); m != nil {
+			info.Name = b.name
+			info.Version = m[1]
+			break
+		}
+	}
+	parseOS(ua, &info)
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		info.Device = DeviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone"):
+		info.Device = DeviceMobile
+	default:
+		info.Device = DeviceDesktop
+	}
+	return info
+}
+
+func parseOS(ua string, info *UserAgentInfo) {
+	switch {
+	case strings.Contains(ua, "Windows"):
+		info.OS = "Windows"
+		if m := uaWindowsRx.FindStringSubmatch(ua); m != nil {
+			info.OSVersion = windowsNTName[m[1]]
+		}
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		info.OS = "iOS"
+		if m := uaIOSRx.FindStringSubmatch(ua); m != nil {
+			info.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+		}
+	case strings.Contains(ua, "Mac OS X") || strings.Contains(ua, "Macintosh"):
+		info.OS = "macOS"
+		if m := uaMacRx.FindStringSubmatch(ua); m != nil {
+			info.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+		}
+	case strings.Contains(ua, "Android"):
+		info.OS = "Android"
+		if m := uaAndroidRx.FindStringSubmatch(ua); m != nil {
+			info.OSVersion = m[1]
+		}
+	case strings.Contains(ua, "CrOS"):
+		info.OS = "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		info.OS = "Linux"
+	}
+}
+
+// UserAgentEnricher is Enricher which sets LogFormatterParams.UserAgent
+func UserAgentEnricher(param *LogFormatterParams) {
+	if param.UserAgent != nil || param.Request == nil {
+		return
+	}
+	ua := ParseUserAgent(param.Request.UserAgent())
+	param.UserAgent = &ua
+}
+
+func validUserAgentClass(class UserAgentClass) bool {
+	switch class {
+	case UserAgentBrowser, UserAgentCrawler, UserAgentMonitor, UserAgentProbe, UserAgentCLI, UserAgentUnknown:
+		return true
+	}
+	return false
+}
+
+// containsUserAgentClass checks if class is in list
+func containsUserAgentClass(list []UserAgentClass, class UserAgentClass) bool {
+	for _, c := range list {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package httplog
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want UserAgentInfo
+	}{
+		{
+			name: "chrome on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Class: UserAgentBrowser, Name: "Chrome", Version: "120.0.0.0", OS: "Windows", OSVersion: "10", Device: DeviceDesktop},
+		},
+		{
+			name: "edge on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			want: UserAgentInfo{Class: UserAgentBrowser, Name: "Edge", Version: "120.0.2210.91", OS: "Windows", OSVersion: "10", Device: DeviceDesktop},
+		},
+		{
+			name: "safari on iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Class: UserAgentBrowser, Name: "Safari", Version: "17.1", OS: "iOS", OSVersion: "17.1", Device: DeviceMobile},
+		},
+		{
+			name: "safari on ipad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Class: UserAgentBrowser, Name: "Safari", Version: "16.6", OS: "iOS", OSVersion: "16.6", Device: DeviceTablet},
+		},
+		{
+			name: "firefox on mac",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: UserAgentInfo{Class: UserAgentBrowser, Name: "Firefox", Version: "121.0", OS: "macOS", OSVersion: "10.15", Device: DeviceDesktop},
+		},
+		{
+			name: "chrome on android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+			want: UserAgentInfo{Class: UserAgentBrowser, Name: "Chrome", Version: "120.0.6099.144", OS: "Android", OSVersion: "14", Device: DeviceMobile},
+		},
+		{
+			name: "samsung on android tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Class: UserAgentBrowser, Name: "Samsung Internet", Version: "23.0", OS: "Android", OSVersion: "13", Device: DeviceTablet},
+		},
+		{
+			name: "googlebot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: UserAgentInfo{Class: UserAgentCrawler, Name: "Googlebot", Version: "2.1", Device: DeviceBot},
+		},
+		{
+			name: "unknown bot",
+			ua:   "Mozilla/5.0 (compatible; SomeNewBot; +https://example.com)",
+			want: UserAgentInfo{Class: UserAgentCrawler, Device: DeviceBot},
+		},
+		{
+			name: "kube-probe",
+			ua:   "kube-probe/1.28",
+			want: UserAgentInfo{Class: UserAgentProbe, Name: "kube-probe", Version: "1.28", Device: DeviceBot},
+		},
+		{
+			name: "aws elb",
+			ua:   "ELB-HealthChecker/2.0",
+			want: UserAgentInfo{Class: UserAgentProbe, Name: "ELB-HealthChecker", Version: "2.0", Device: DeviceBot},
+		},
+		{
+			name: "uptime robot",
+			ua:   "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)",
+			want: UserAgentInfo{Class: UserAgentMonitor, Name: "UptimeRobot", Version: "2.0", Device: DeviceBot},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.4.0",
+			want: UserAgentInfo{Class: UserAgentCLI, Name: "curl", Version: "8.4.0", Device: DeviceOther},
+		},
+		{
+			name: "go http client",
+			ua:   "Go-http-client/1.1",
+			want: UserAgentInfo{Class: UserAgentCLI, Name: "Go-http-client", Version: "1.1", Device: DeviceOther},
+		},
+		{
+			name: "empty",
+			ua:   "",
+			want: UserAgentInfo{Class: UserAgentUnknown, Device: DeviceOther},
+		},
+		{
+			name: "garbage",
+			ua:   "\x1b[31mhello",
+			want: UserAgentInfo{Class: UserAgentUnknown, Device: DeviceOther},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseUserAgent(tt.ua))
+		})
+	}
+}
+
+func TestUserAgentInfoIsBot(t *testing.T) {
+	for _, class := range BotUserAgents {
+		ua := UserAgentInfo{Class: class}
+		assert.True(t, ua.IsBot(), class)
+	}
+	for _, class := range []UserAgentClass{UserAgentBrowser, UserAgentCLI, UserAgentUnknown} {
+		ua := UserAgentInfo{Class: class}
+		assert.False(t, ua.IsBot(), class)
+	}
+}
+
+func TestLoggerWithConfigUserAgents(t *testing.T) {
+	var gotParam LogFormatterParams
+	buffer := new(bytes.Buffer)
+
+	logger, err := LoggerWithConfig(LoggerConfig{
+		Output:          buffer,
+		SkipUserAgents:  []UserAgentClass{UserAgentCrawler},
+		DebugUserAgents: []UserAgentClass{UserAgentProbe},
+		MinLevel:        LevelInfo,
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return DefaultLogFormatter(param)
+		},
+	})
+	assert.NoError(t, err)
+	handler := logger.Handler
+	fail := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	// crawlers are skipped
+	PerformRequest(handler(testHandler200("ok")), "GET", "/", header{Key: "User-Agent", Value: "Googlebot/2.1"})
+	assert.Empty(t, buffer.String())
+
+	// successful health checks are down-leveled below MinLevel
+	PerformRequest(handler(testHandler200("ok")), "GET", "/healthz", header{Key: "User-Agent", Value: "kube-probe/1.28"})
+	assert.Empty(t, buffer.String())
+
+	// failed health checks keep their level
+	PerformRequest(handler(fail), "GET", "/healthz", header{Key: "User-Agent", Value: "kube-probe/1.28"})
+	assert.Contains(t, buffer.String(), "/healthz")
+	assert.Equal(t, LevelError, gotParam.Level)
+	assert.Equal(t, UserAgentProbe, gotParam.UserAgent.Class)
+
+	// parsed user agent is reused by enricher
+	buffer.Reset()
+	PerformRequest(handler(testHandler200("ok")), "GET", "/", header{Key: "User-Agent", Value: "curl/8.4.0"})
+	assert.Contains(t, buffer.String(), "200")
+	assert.Equal(t, "curl", gotParam.UserAgent.Name)
+}
+
+func TestLoggerWithConfigInvalidUserAgentClass(t *testing.T) {
+	_, err := LoggerWithConfig(LoggerConfig{SkipUserAgents: []UserAgentClass{"robots"}})
+	assert.ErrorContains(t, err, "invalid SkipUserAgents[0]")
+}
+
+func TestUserAgentEnricher(t *testing.T) {
+	var gotParam LogFormatterParams
+	handler, _ := HandlerWithConfig(LoggerConfig{
+		Output:    new(bytes.Buffer),
+		Enrichers: []Enricher{UserAgentEnricher},
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return ""
+		},
+	}, testHandler200("ok"))
+
+	PerformRequest(handler, "GET", "/", header{Key: "User-Agent", Value: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"})
+	if assert.NotNil(t, gotParam.UserAgent) {
+		assert.Equal(t, "Firefox", gotParam.UserAgent.Name)
+		assert.Equal(t, "Linux", gotParam.UserAgent.OS)
+	}
+}
@@ -2,6 +2,7 @@ package zap
 
 import (
 	"fmt"
+	"io"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -11,15 +12,39 @@ import (
 
 // ZapLogger log everything to zap logger with specific log level, if message is empty, URL is used instead
 func ZapLogger(zl *zap.Logger, level zapcore.Level, message string) httplog.LogFormatter {
+	encode := zapEncode(zl, level, message)
 	return func(params httplog.LogFormatterParams) string {
+		encode(nil, &params)
+		return ""
+	}
+}
+
+// ZapEncoder is the Encoder version of ZapLogger, it appends nothing to the buffer as zap handles output
+func ZapEncoder(zl *zap.Logger, level zapcore.Level, message string) httplog.Encoder {
+	return zapEncode(zl, level, message)
+}
+
+// ZapSink is a sink which passes log entries to zap logger, use it in httplog.LoggerConfig.Sinks
+func ZapSink(zl *zap.Logger, level zapcore.Level, message string) httplog.Sink {
+	return httplog.Sink{
+		Name:    "zap",
+		Encoder: ZapEncoder(zl, level, message),
+		Output:  io.Discard,
+	}
+}
+
+func zapEncode(zl *zap.Logger, level zapcore.Level, message string) httplog.EncoderFunc {
+	return func(buf []byte, params *httplog.LogFormatterParams) []byte {
 		if zl == nil {
-			return ""
+			return buf
 		}
-		if len(message) == 0 {
-			message = fmt.Sprintf("[%s] response %s", params.RouterName, params.Path)
+		// message is shared by all entries of the encoder, so the default one is per entry
+		msg := message
+		if len(msg) == 0 {
+			msg = fmt.Sprintf("[%s] response %s", params.RouterName, params.Path)
 		}
 
-		zl.Log(level, message,
+		fields := []zap.Field{
 			zap.String("RouterName", params.RouterName),
 			zap.Time("TimeStamp", params.TimeStamp),
 			zap.Int("StatusCode", params.StatusCode),
@@ -27,9 +52,55 @@ func ZapLogger(zl *zap.Logger, level zapcore.Level, message string) httplog.LogF
 			zap.String("ClientIP", params.ClientIP),
 			zap.String("Method", params.Method),
 			zap.String("Path", params.Path),
+			zap.String("Scheme", params.Scheme),
+			zap.String("Host", params.Host),
+			zap.String("FullURL", params.FullURL),
 			zap.Int("BodySize", params.BodySize),
-		)
-		return ""
+		}
+		if params.TTFB > 0 {
+			fields = append(fields, zap.Duration("TTFB", params.TTFB))
+		}
+		if params.Flushes > 0 {
+			fields = append(fields, zap.Int("Flushes", params.Flushes))
+		}
+		if len(params.Informational) > 0 {
+			fields = append(fields, zap.Ints("Informational", params.Informational))
+		}
+		if len(params.Trailer) > 0 {
+			fields = append(fields, zap.Any("Trailer", params.Trailer))
+		}
+		if params.Error != nil {
+			fields = append(fields,
+				zap.Error(params.Error),
+				zap.Bool("ClientCanceled", params.ClientCanceled),
+				zap.Int64("BytesExpected", params.BytesExpected),
+				zap.Int64("BytesWritten", params.BytesWritten),
+			)
+		}
+		if params.Geo != nil {
+			fields = append(fields,
+				zap.String("CountryCode", params.Geo.CountryCode),
+				zap.String("Country", params.Geo.Country),
+				zap.String("City", params.Geo.City),
+				zap.Uint("ASN", params.Geo.ASN),
+				zap.String("ASOrg", params.Geo.ASOrg),
+			)
+		}
+		if params.UserAgent != nil {
+			fields = append(fields,
+				zap.String("UAClass", string(params.UserAgent.Class)),
+				zap.String("UAName", params.UserAgent.Name),
+				zap.String("UAVersion", params.UserAgent.Version),
+				zap.String("OS", params.UserAgent.OS),
+				zap.String("OSVersion", params.UserAgent.OSVersion),
+				zap.String("Device", string(params.UserAgent.Device)),
+			)
+		}
+		for _, f := range params.Fields {
+			fields = append(fields, zap.Any(f.Key, f.Value))
+		}
+		zl.Log(level, msg, fields...)
+		return buf
 	}
 }
 